@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+type heapSnapshot struct {
+	HeapInuse  uint64 `json:"heap_inuse_bytes"`
+	HeapSys    uint64 `json:"heap_sys_bytes"`
+	StoreBytes uint64 `json:"store_bytes"`
+	Entries    int    `json:"entries"`
+}
+
+func takeHeapSnapshot(storeBytes uint64, entries int) heapSnapshot {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return heapSnapshot{
+		HeapInuse:  ms.HeapInuse,
+		HeapSys:    ms.HeapSys,
+		StoreBytes: storeBytes,
+		Entries:    entries,
+	}
+}
+
+// compactHandler rebuilds all segment maps and hands the freed memory back to
+// the OS, reporting heap and store usage before and after. A store backed by a
+// data file also has its log rewritten down to the live entries.
+func (s *Server) compactHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	// Compaction rewrites every segment map and the data file, so it counts
+	// against the write limit like any other write
+	if !s.acquireWrite(w) {
+		return
+	}
+	defer s.releaseWrite()
+	store := s.table()
+
+	before := takeHeapSnapshot(store.Size(), store.Count())
+	entries := store.Compact()
+	if l, ok := storage.Underlying(store).(interface{ CompactLog() error }); ok {
+		if err := l.CompactLog(); err != nil {
+			s.logger.Error("compacting data file", "err", err)
+			http.Error(w, "Failed to compact data file", http.StatusInternalServerError)
+			return
+		}
+	}
+	debug.FreeOSMemory()
+	after := takeHeapSnapshot(store.Size(), entries)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]heapSnapshot{
+		"before": before,
+		"after":  after,
+	})
+}
+
+// verifySizeHandler serves GET /admin/verify-size: the tracked store size next
+// to one recomputed from every entry. A mismatch means size accounting drifted.
+func (s *Server) verifySizeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.acquireScan(w, r) {
+		return
+	}
+	defer s.releaseScan()
+
+	tracked, actual, ok := s.table().VerifySize()
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tracked_bytes": tracked,
+		"actual_bytes":  actual,
+		"ok":            ok,
+	}, false)
+}
+
+// purgeHandler serves DELETE /admin/purge?older_than=24h, removing every entry
+// not written within that duration regardless of TTL. It walks the whole store,
+// so it takes a scan slot as well as a write slot.
+func (s *Server) purgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	age, err := time.ParseDuration(r.URL.Query().Get("older_than"))
+	if err != nil || age <= 0 {
+		http.Error(w, "older_than must be a positive duration such as 24h", http.StatusBadRequest)
+		return
+	}
+	if !s.acquireWrite(w) {
+		return
+	}
+	defer s.releaseWrite()
+	if !s.acquireScan(w, r) {
+		return
+	}
+	defer s.releaseScan()
+
+	purged, reclaimed := s.table().PurgeOlderThan(time.Now().Add(-age))
+	logDetail(r, "purged", purged)
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"purged":          purged,
+		"reclaimed_bytes": reclaimed,
+	}, false)
+}
+
+// clearHandler serves DELETE /admin/clear, removing every entry and its
+// history. Scans running alongside see each segment either whole or cleared
+// (see storage.SegmentedHashTable.Clear).
+func (s *Server) clearHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	if !s.acquireWrite(w) {
+		return
+	}
+	defer s.releaseWrite()
+
+	cleared := s.table().Clear()
+	logDetail(r, "cleared", cleared)
+	s.writeJSON(w, http.StatusOK, map[string]int{"cleared": cleared}, false)
+}
+
+// inspectHandler serves GET /admin/inspect/{key} with a key's internal metadata.
+// For a key that isn't stored the 404 still says which segment it would land
+// in. Only registered in debug mode.
+func (s *Server) inspectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/admin/inspect/")
+
+	store := s.table()
+	info, err := store.Inspect(key)
+	if err != nil {
+		if err == storage.ErrKeyNotFound {
+			if seg, ok := store.(interface{ SegmentIndex(string) int }); ok {
+				s.writeJSON(w, http.StatusNotFound, map[string]interface{}{
+					"error":   "Location ID not found",
+					"key":     store.NormalizeKey(key),
+					"segment": seg.SegmentIndex(key),
+				}, false)
+				return
+			}
+			http.Error(w, "Location ID not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	s.writeJSON(w, http.StatusOK, info, r.URL.Query().Get("pretty") == "true")
+}
+
+// memStatsHandler serves GET /debug/memstats: selected Go runtime memory stats
+// next to the store's own accounting, to correlate store growth with RSS.
+// Only registered in debug mode.
+func (s *Server) memStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	store := s.table()
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"heap_alloc_bytes":    ms.HeapAlloc,
+		"heap_inuse_bytes":    ms.HeapInuse,
+		"heap_idle_bytes":     ms.HeapIdle,
+		"heap_released_bytes": ms.HeapReleased,
+		"heap_sys_bytes":      ms.HeapSys,
+		"heap_objects":        ms.HeapObjects,
+		"sys_bytes":           ms.Sys,
+		"num_gc":              ms.NumGC,
+		"pause_total_ns":      ms.PauseTotalNs,
+		"goroutines":          runtime.NumGoroutine(),
+		"store_size_bytes":    store.Size(),
+		"store_max_bytes":     store.MaxSize(),
+		"store_entries":       store.Count(),
+	}, r.URL.Query().Get("pretty") == "true")
+}
@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// Swapping the size estimator after writes makes the recomputed size disagree
+// with what was charged, which is how accounting drift looks from outside
+func TestVerifySizeEndpoint(t *testing.T) {
+	var perEntry atomic.Uint64
+	perEntry.Store(100)
+	store := storage.NewSegmentedHashTable(4, 0,
+		storage.WithSizeEstimator(func(string, storage.DataEntry) uint64 { return perEntry.Load() }))
+	putKeys(t, store, seqKeys("EU", 3)...)
+	_, ts := newTestServer(t, store)
+
+	var report struct {
+		Tracked uint64 `json:"tracked_bytes"`
+		Actual  uint64 `json:"actual_bytes"`
+		OK      bool   `json:"ok"`
+	}
+	resp, body := do(t, ts, http.MethodGet, "/admin/verify-size", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &report)
+	if !report.OK || report.Tracked != 300 {
+		t.Fatalf("before drift: %+v, want ok at 300 bytes", report)
+	}
+
+	perEntry.Store(150)
+	resp, body = do(t, ts, http.MethodGet, "/admin/verify-size", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &report)
+	if report.OK || report.Tracked != 300 || report.Actual != 450 {
+		t.Errorf("after drift: %+v, want not ok, tracked 300, actual 450", report)
+	}
+}
+
+// Exports running alongside /admin/clear stay well formed, and a namespaced
+// server only clears its own namespace
+func TestClearEndpoint(t *testing.T) {
+	table := newTestStore()
+	mine, _ := storage.NewNamespaced(table, "mine")
+	other, _ := storage.NewNamespaced(table, "other")
+	putKeys(t, mine, seqKeys("EU", 200)...)
+	putKeys(t, other, seqKeys("EU", 3)...)
+	_, ts := newTestServer(t, mine)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, body := do(t, ts, http.MethodGet, "/export", "")
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("export during clear: status %d", resp.StatusCode)
+				return
+			}
+			for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+				if line != "" && !json.Valid([]byte(line)) {
+					t.Errorf("export during clear wrote %q", line)
+				}
+			}
+		}()
+	}
+	resp, body := do(t, ts, http.MethodDelete, "/admin/clear", "")
+	wg.Wait()
+	wantStatus(t, resp, body, http.StatusOK)
+	var got map[string]int
+	decode(t, body, &got)
+	if got["cleared"] != 200 {
+		t.Errorf("cleared = %d, want 200", got["cleared"])
+	}
+	if n := len(mine.GetKeys()); n != 0 {
+		t.Errorf("%d entries left in the cleared namespace", n)
+	}
+	if n := len(other.GetKeys()); n != 3 {
+		t.Errorf("%d entries left in the other namespace, want all 3", n)
+	}
+
+	resp, body = do(t, ts, http.MethodPost, "/admin/clear", "")
+	wantStatus(t, resp, body, http.StatusMethodNotAllowed)
+}
+
+// Inspecting a key that isn't stored still says which segment it would land in
+func TestInspectMissingKeySegment(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store, WithDebug())
+
+	resp, body := do(t, ts, http.MethodGet, "/admin/inspect/EU-404", "")
+	wantStatus(t, resp, body, http.StatusNotFound)
+	var got struct {
+		Key     string `json:"key"`
+		Segment int    `json:"segment"`
+	}
+	decode(t, body, &got)
+	if got.Key != "EU-404" || got.Segment != store.SegmentIndex("EU-404") {
+		t.Errorf("inspect of a missing key = %+v, want EU-404 in segment %d", got, store.SegmentIndex("EU-404"))
+	}
+
+	putKeys(t, store, "EU-404")
+	resp, body = do(t, ts, http.MethodGet, "/admin/inspect/EU-404", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &got)
+	if got.Segment != store.SegmentIndex("EU-404") {
+		t.Errorf("inspect of the stored key reports segment %d, want %d", got.Segment, store.SegmentIndex("EU-404"))
+	}
+}
+
+func TestPurgeEndpoint(t *testing.T) {
+	store := newTestStore()
+	putKeys(t, store, seqKeys("EU", 3)...)
+	_, ts := newTestServer(t, store)
+
+	var got struct {
+		Purged    int    `json:"purged"`
+		Reclaimed uint64 `json:"reclaimed_bytes"`
+	}
+	resp, body := do(t, ts, http.MethodDelete, "/admin/purge?older_than=24h", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &got)
+	if got.Purged != 0 || store.Count() != 3 {
+		t.Fatalf("purge of fresh entries: %+v, %d left; want nothing purged", got, store.Count())
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	size := store.Size()
+	resp, body = do(t, ts, http.MethodDelete, "/admin/purge?older_than=1ms", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &got)
+	if got.Purged != 3 || got.Reclaimed != size || store.Count() != 0 {
+		t.Errorf("purge of everything: %+v, %d left; want 3 purged, %d bytes", got, store.Count(), size)
+	}
+
+	for _, query := range []string{"", "?older_than=soon", "?older_than=-1h"} {
+		resp, body = do(t, ts, http.MethodDelete, "/admin/purge"+query, "")
+		wantStatus(t, resp, body, http.StatusBadRequest)
+	}
+	resp, body = do(t, ts, http.MethodPost, "/admin/purge?older_than=1h", "")
+	wantStatus(t, resp, body, http.StatusMethodNotAllowed)
+}
+
+// /admin/compact reports the store before and after, unchanged in content, and
+// rewrites the data file down to one record per live entry
+func TestCompactEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls, err := storage.OpenLogStore(path, newTestStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+	_, ts := newTestServer(t, ls)
+
+	keys := seqKeys("EU", 5)
+	for i := 0; i < 4; i++ {
+		putKeys(t, ls, keys...)
+	}
+	lines := func() int {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(b), "\n")
+	}
+	grown := lines()
+
+	resp, body := do(t, ts, http.MethodPost, "/admin/compact", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var report map[string]heapSnapshot
+	decode(t, body, &report)
+	before, after := report["before"], report["after"]
+	if before.Entries != 5 || after.Entries != 5 || before.StoreBytes != ls.Size() || after.StoreBytes != ls.Size() {
+		t.Errorf("before %+v after %+v, want 5 entries and %d bytes both times", before, after, ls.Size())
+	}
+	if before.HeapInuse == 0 || after.HeapSys == 0 {
+		t.Errorf("before %+v after %+v, want heap figures filled in", before, after)
+	}
+	// A header line plus one record per entry
+	if got := lines(); got != 6 {
+		t.Errorf("data file has %d lines after compaction (%d before), want 6", got, grown)
+	}
+
+	resp, body = do(t, ts, http.MethodGet, "/"+keys[0], "")
+	wantStatus(t, resp, body, http.StatusOK)
+}
+
+// /debug/memstats exists only in debug mode and reports runtime and store
+// figures
+func TestMemStatsEndpoint(t *testing.T) {
+	_, plain := newTestServer(t, newTestStore())
+	resp, body := do(t, plain, http.MethodGet, "/debug/memstats", "")
+	wantStatus(t, resp, body, http.StatusNotFound)
+
+	store := newTestStore()
+	putKeys(t, store, seqKeys("EU", 3)...)
+	_, ts := newTestServer(t, store, WithDebug())
+	resp, body = do(t, ts, http.MethodGet, "/debug/memstats", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var stats map[string]float64
+	decode(t, body, &stats)
+	for _, field := range []string{"heap_alloc_bytes", "heap_inuse_bytes", "heap_sys_bytes", "heap_objects", "sys_bytes", "goroutines"} {
+		if stats[field] <= 0 {
+			t.Errorf("%s = %v, want a positive figure", field, stats[field])
+		}
+	}
+	for _, field := range []string{"heap_idle_bytes", "heap_released_bytes", "num_gc", "pause_total_ns"} {
+		if _, ok := stats[field]; !ok {
+			t.Errorf("%s missing", field)
+		}
+	}
+	if stats["store_entries"] != 3 || stats["store_size_bytes"] != float64(store.Size()) || stats["store_max_bytes"] != float64(store.MaxSize()) {
+		t.Errorf("store figures %v entries, %v of %v bytes; want 3 entries, %d of %d bytes",
+			stats["store_entries"], stats["store_size_bytes"], stats["store_max_bytes"], store.Size(), store.MaxSize())
+	}
+
+	resp, body = do(t, ts, http.MethodPost, "/debug/memstats", "")
+	wantStatus(t, resp, body, http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// aggregateFields maps the field names accepted by /{key}/aggregate to the
+// reading they select
+var aggregateFields = map[string]func(storage.DataEntry) float64{
+	"seismic_activity": func(e storage.DataEntry) float64 { return float64(e.SeismicActivity) },
+	"temperature_c":    func(e storage.DataEntry) float64 { return float64(e.TemperatureC) },
+	"radiation_level":  func(e storage.DataEntry) float64 { return float64(e.RadiationLevel) },
+}
+
+// bucket accumulates the readings that fall into one window
+type bucket struct {
+	start    int64 // Unix nanos, aligned to the window
+	count    int
+	sum      float64
+	min, max float64
+}
+
+func (b *bucket) add(v float64) {
+	if b.count == 0 {
+		b.min, b.max = v, v
+	}
+	b.count++
+	b.sum += v
+	b.min = math.Min(b.min, v)
+	b.max = math.Max(b.max, v)
+}
+
+// aggregateFns computes a bucket's reported value
+var aggregateFns = map[string]func(*bucket) float64{
+	"avg":   func(b *bucket) float64 { return b.sum / float64(b.count) },
+	"min":   func(b *bucket) float64 { return b.min },
+	"max":   func(b *bucket) float64 { return b.max },
+	"count": func(b *bucket) float64 { return float64(b.count) },
+}
+
+type aggregatePoint struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Value       float64   `json:"value"`
+}
+
+// aggregateSeries buckets entries into fixed windows aligned to the Unix epoch
+// and reduces each non-empty bucket with fn. History is kept oldest first, so
+// buckets come out in time order.
+func aggregateSeries(entries []storage.DataEntry, field func(storage.DataEntry) float64, window time.Duration, fn func(*bucket) float64) []aggregatePoint {
+	var buckets []*bucket
+	for _, e := range entries {
+		start := e.LastUpdated - e.LastUpdated%int64(window)
+		if len(buckets) == 0 || buckets[len(buckets)-1].start != start {
+			buckets = append(buckets, &bucket{start: start})
+		}
+		buckets[len(buckets)-1].add(field(e))
+	}
+
+	points := make([]aggregatePoint, len(buckets))
+	for i, b := range buckets {
+		points[i] = aggregatePoint{BucketStart: time.Unix(0, b.start).UTC(), Value: fn(b)}
+	}
+	return points
+}
+
+// handleAggregate serves GET /{key}/aggregate?field=temperature_c&window=5m&fn=avg,
+// downsampling the key's retained history into per-window aggregates. Empty
+// windows are left out. fn defaults to avg.
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request, locationID string) {
+	store := s.table()
+	if !store.HistoryEnabled() {
+		http.Error(w, "History is not enabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	field, ok := aggregateFields[q.Get("field")]
+	if !ok {
+		http.Error(w, "field must be seismic_activity, temperature_c or radiation_level", http.StatusBadRequest)
+		return
+	}
+	window, err := time.ParseDuration(q.Get("window"))
+	if err != nil || window <= 0 {
+		http.Error(w, "window must be a positive duration such as 5m", http.StatusBadRequest)
+		return
+	}
+	name := q.Get("fn")
+	if name == "" {
+		name = "avg"
+	}
+	fn, ok := aggregateFns[name]
+	if !ok {
+		http.Error(w, "fn must be avg, min, max or count", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := store.History(locationID)
+	if err != nil {
+		if err == storage.ErrKeyNotFound {
+			http.Error(w, "Location ID not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(aggregateSeries(entries, field, window, fn))
+}
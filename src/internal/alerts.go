@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+const (
+	StatusNormal   = "normal"
+	StatusWarning  = "warning"
+	StatusCritical = "critical"
+)
+
+// AlertThreshold marks a reading as warning/critical once it reaches the given value
+type AlertThreshold struct {
+	Warning  float32 `json:"warning"`
+	Critical float32 `json:"critical"`
+}
+
+// AlertThresholds are keyed by JSON field name (seismic_activity, temperature_c,
+// radiation_level). Fields without an entry never raise the status.
+type AlertThresholds map[string]AlertThreshold
+
+// entryResponse is the GET body when a derived status is being reported
+type entryResponse struct {
+	storage.DataEntry
+	Status string `json:"status"`
+}
+
+func sensorReadings(e storage.DataEntry) map[string]float32 {
+	return map[string]float32{
+		"seismic_activity": e.SeismicActivity,
+		"temperature_c":    e.TemperatureC,
+		"radiation_level":  e.RadiationLevel,
+	}
+}
+
+// Status returns the worst status any configured field of the entry reaches
+func (t AlertThresholds) Status(e storage.DataEntry) string {
+	status := StatusNormal
+	for field, value := range sensorReadings(e) {
+		th, ok := t[field]
+		if !ok {
+			continue
+		}
+		if value >= th.Critical {
+			return StatusCritical
+		}
+		if value >= th.Warning {
+			status = StatusWarning
+		}
+	}
+	return status
+}
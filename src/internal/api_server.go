@@ -2,10 +2,17 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
-	"regexp"
+	"net/http/pprof"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
@@ -18,129 +25,876 @@ type RequestData struct {
 	RadiationLevel  float32 `json:"radiation_level"`
 }
 
-type Server struct {
-	store    *storage.SegmentedHashTable
-	memPool  *storage.PoolManager
-	isReady  bool
-	keyRegex *regexp.Regexp
+// sensorPresence mirrors RequestData's readings as pointers so a strict PUT can
+// tell a missing field from a genuine zero
+type sensorPresence struct {
+	SeismicActivity *float32 `json:"seismic_activity"`
+	TemperatureC    *float32 `json:"temperature_c"`
+	RadiationLevel  *float32 `json:"radiation_level"`
+}
+
+// missing lists the JSON names of the readings the body left out
+func (p sensorPresence) missing() []string {
+	var names []string
+	if p.SeismicActivity == nil {
+		names = append(names, "seismic_activity")
+	}
+	if p.TemperatureC == nil {
+		names = append(names, "temperature_c")
+	}
+	if p.RadiationLevel == nil {
+		names = append(names, "radiation_level")
+	}
+	return names
+}
+
+// storeRef lets an interface value sit behind an atomic.Pointer
+type storeRef struct {
+	storage.Store
 }
 
-func CreateServer(store *storage.SegmentedHashTable, memPool *storage.PoolManager) *Server {
-	keyRegex := regexp.MustCompile(`^[A-Z]+-[a-zA-Z0-9]{1,6}$`)
+type Server struct {
+	store   atomic.Pointer[storeRef] // swappable, see SwapStore
+	memPool *storage.PoolManager
+	isReady atomic.Bool
+	loading atomic.Bool // startup load in progress, data endpoints answer 503
+	metrics serverMetrics
+
+	startTime time.Time // when CreateServer ran, reported on /metrics
+
+	logger       *slog.Logger
+	logSampleN   int                      // log 1 in N successful requests
+	routeLogging map[string]RouteLogLevel // per-pattern success logging
+	slowRequest  time.Duration            // successful requests slower than this log at warn, 0 disables
+
+	scanSem          chan struct{} // bounds concurrent full-store scans
+	scanQueueTimeout time.Duration
+	writeSem         chan struct{} // bounds concurrent writes, nil when unlimited
+	rateLimit        *rateLimiter  // per-client token buckets, nil when off
+
+	defaultOnMiss bool            // serve a zero entry instead of 404 for unknown keys
+	thresholds    AlertThresholds // when set, GET adds a derived "status" field
+	readingPlaces int             // decimals reads round readings to, -1 leaves them exact
+	maxServeAge   time.Duration   // GET answers 410 for entries older than this, 0 disables
+
+	capacityHeaders bool // add X-Store-* usage headers to key GET/PUT responses
+
+	encodeBufferSize int // size of pooled GET encode buffers, 0 disables pooling
+	exportBufferSize int // size of the pooled buffer /export batches lines in, 0 disables pooling
+	streamThreshold  int // responses larger than this are sent chunked, 0 never
 
-	return &Server{
-		store:    store,
-		memPool:  memPool,
-		isReady:  true,
-		keyRegex: keyRegex,
+	raw *storage.BlobTable // serves /raw/{key} when set
+
+	faults *faultInjector // nil unless fault injection is enabled
+	debug  bool           // registers diagnostic endpoints
+
+	rootIndex bool // GET / lists the endpoints instead of answering 400
+
+	separateAdmin bool // admin routes are served by AdminHandler only
+
+	maxVersion int // ModificationCount rolls over to 1 after this, 0 only at overflow
+
+	maxRequestTimeout time.Duration // cap on client-requested X-Timeout-Ms budgets
+
+	maxResults int // cap on entries per list-type response, 0 disables
+	maxBatch   int // cap on ops per POST /batch, 0 disables
+
+	rejectNilUUID   bool // refuse writes whose id is 00000000-0000-0000-0000-000000000000
+	omitNilID       bool // GET leaves "id" out when it is the nil UUID
+	requireReadings bool // PUT answers 422 unless the body has all three readings
+
+	apiKeys *apiKeys  // nil unless API-key auth is enabled
+	audit   *auditLog // recent mutations for /admin/audit, nil when disabled
+
+	servers httpServers // listeners to stop on Shutdown
+	regions regionCache // last /regions scan
+
+	capacityGate      *readinessGate // nil unless capacity affects readiness
+	capacityThreshold float64        // fraction of MaxSize considered "full"
+}
+
+func CreateServer(store storage.Store, memPool *storage.PoolManager, opts ...ServerOption) *Server {
+	s := &Server{
+		memPool:           memPool,
+		scanSem:           make(chan struct{}, 4),
+		scanQueueTimeout:  time.Second,
+		logger:            slog.Default(),
+		logSampleN:        1,
+		routeLogging:      make(map[string]RouteLogLevel, len(defaultRouteLogging)),
+		encodeBufferSize:  defaultEncodeBufferSize,
+		exportBufferSize:  defaultExportBufferSize,
+		streamThreshold:   defaultStreamThreshold,
+		maxRequestTimeout: defaultMaxRequestTimeout,
+		maxResults:        defaultMaxResults,
+		startTime:         time.Now(),
+		readingPlaces:     -1,
+		maxBatch:          defaultMaxBatch,
+		rootIndex:         true,
+	}
+	s.store.Store(&storeRef{store})
+	s.isReady.Store(true)
+	for pattern, level := range defaultRouteLogging {
+		s.routeLogging[pattern] = level
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
+
+// table returns the live store. Handlers should call it once per request so
+// they work against a single dataset even if SwapStore runs concurrently.
+func (s *Server) table() storage.Store {
+	return s.store.Load().Store
+}
+
+// SwapStore atomically replaces the live store, e.g. to cut over to a freshly
+// loaded dataset, and returns the previous one. In-flight requests finish against
+// whichever table they started with, so every reader sees either the whole old or
+// the whole new dataset. Change-feed subscribers stay attached to the old table.
+func (s *Server) SwapStore(store storage.Store) storage.Store {
+	return s.store.Swap(&storeRef{store}).Store
 }
 
 func (s *Server) SetReady(ready bool) {
-	s.isReady = ready
+	s.isReady.Store(ready)
 }
 
-func (s *Server) Start(port int) error {
-	http.HandleFunc("/health", s.healthHandler)
-	http.HandleFunc("/", s.mainHandler)
+// SetLoading marks a startup load (snapshot or log replay) as in progress. While
+// set, readiness reports 503 and so does every data endpoint, so the server can
+// listen for health checks before the store is complete.
+func (s *Server) SetLoading(loading bool) {
+	s.loading.Store(loading)
+}
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+// Handler builds a fresh mux with every route plus the shared middleware. Each
+// call returns an independent handler, so several servers (or tests) can coexist
+// in one process without fighting over http.DefaultServeMux.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.healthHandler)
+	mux.HandleFunc("/health/ready", s.readyHandler)
+	mux.HandleFunc("/ping", s.pingHandler)
+	mux.HandleFunc("/export", s.exportHandler)
+	mux.HandleFunc("/export.csv", s.csvExportHandler)
+	mux.HandleFunc("/import", s.importHandler)
+	mux.HandleFunc("/txn", s.txnHandler)
+	mux.HandleFunc("/batch", s.batchHandler)
+	mux.HandleFunc("/changes", s.changesHandler)
+	mux.HandleFunc("/ws", s.wsHandler)
+	mux.HandleFunc("/range", s.rangeHandler)
+	mux.HandleFunc("/regions", s.regionsHandler)
+	mux.HandleFunc("/prefix/", s.prefixHandler)
+	if s.raw != nil {
+		mux.HandleFunc("/raw/", s.rawHandler)
+	}
+	if s.separateAdmin {
+		// Keep these from being read as keys
+		mux.HandleFunc("/metrics", http.NotFound)
+		mux.HandleFunc("/admin/", http.NotFound)
+		mux.HandleFunc("/debug/", http.NotFound)
+	} else {
+		s.registerAdmin(mux)
+	}
+	mux.HandleFunc("/", s.mainHandler)
+
+	return s.wrap(mux)
+}
+
+// AdminHandler serves metrics and the /admin/ and /debug/ routes, plus health
+// checks and pprof, for a separate admin listener (see WithSeparateAdmin)
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.healthHandler)
+	mux.HandleFunc("/health/ready", s.readyHandler)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	s.registerAdmin(mux)
+	return s.wrap(mux)
 }
 
+// registerAdmin adds the operator-only routes to mux
+func (s *Server) registerAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.HandleFunc("/admin/compact", s.compactHandler)
+	mux.HandleFunc("/admin/verify-size", s.verifySizeHandler)
+	mux.HandleFunc("/admin/purge", s.purgeHandler)
+	mux.HandleFunc("/admin/clear", s.clearHandler)
+	if s.faults != nil {
+		mux.HandleFunc("/admin/faults", s.faultsHandler)
+	}
+	if s.audit != nil {
+		mux.HandleFunc("/admin/audit", s.auditHandler)
+	}
+	if s.debug {
+		mux.HandleFunc("/admin/inspect/", s.inspectHandler)
+		mux.HandleFunc("/admin/config", s.configHandler)
+		mux.HandleFunc("/debug/memstats", s.memStatsHandler)
+	}
+}
+
+// wrap applies the middleware every listener shares, gRPC included (see
+// grpcMiddleware)
+func (s *Server) wrap(next http.Handler) http.Handler {
+	chain := s.logRequests(s.auditMutations(s.recoverPanics(s.limitRate(s.requireAPIKey(s.gateLoading(next))))))
+	mux, ok := next.(*http.ServeMux)
+	if !ok {
+		return chain
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Resolve the route up front so requests turned away before reaching
+		// the mux (401, 429, ...) are still logged and audited against it
+		_, r.Pattern = mux.Handler(r)
+		chain.ServeHTTP(w, r)
+	})
+}
+
+// pingHandler returns the server clock in Unix nanoseconds and echoes the
+// client's ?t= so sensors can measure RTT and clock skew. No store access.
+func (s *Server) pingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"server_time_ns": time.Now().UnixNano(),
+		"t":              r.URL.Query().Get("t"),
+	})
+}
+
+// healthHandler is the liveness probe: 200 whenever the process can answer.
+// Loading, capacity and the rest only affect readiness (/health/ready), so a
+// liveness probe never restarts a server that is busy replaying its log.
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodGet)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "OK")
+}
 
-	if s.isReady {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "OK")
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		fmt.Fprintf(w, "Service unavailable")
+// acquireScan takes a scan slot, waiting at most scanQueueTimeout. When it returns
+// false a 429 has already been written and the caller should bail out.
+func (s *Server) acquireScan(w http.ResponseWriter, r *http.Request) bool {
+	timer := time.NewTimer(s.scanQueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.scanSem <- struct{}{}:
+		s.metrics.activeScans.Add(1)
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	s.metrics.rejectedScans.Add(1)
+	http.Error(w, "Too many concurrent scans", http.StatusTooManyRequests)
+	return false
+}
+
+func (s *Server) releaseScan() {
+	s.metrics.activeScans.Add(-1)
+	<-s.scanSem
+}
+
+// exportHandler streams every entry as newline-delimited JSON, a page at a
+// time once the store outgrows maxResults (see planExport)
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.acquireScan(w, r) {
+		return
+	}
+	defer s.releaseScan()
+
+	store := s.table()
+	page := s.planExport(w, r, store)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	// Lines collect in a pooled buffer and go out a buffer-full at a time, so a
+	// large export neither allocates per entry nor writes per entry
+	buf, flushAt, release := s.exportBuffer()
+	defer release()
+	var out io.Writer = w
+	if buf != nil {
+		out = buf
+	}
+
+	enc := json.NewEncoder(out)
+	exported := 0
+	clientGone := false
+	var row storage.DataEntry // encoded by pointer so entries aren't boxed one by one
+	emit := func(entry storage.DataEntry) bool {
+		row = s.shown(entry)
+		if enc.Encode(&row) != nil {
+			clientGone = true
+			return false
+		}
+		exported++
+		if buf != nil && buf.Len() >= flushAt {
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				clientGone = true
+				return false
+			}
+			buf.Reset()
+		}
+		return true
+	}
+	page.each(store, emit)
+	if buf != nil && !clientGone {
+		w.Write(buf.Bytes())
+	}
+	logDetail(r, "results", exported, "truncated", page.next != "")
+}
+
+// exportPage is what one export request sends
+type exportPage struct {
+	paged   bool
+	entries []storage.DataEntry // the page, when paged
+	next    string              // first key left out, empty when nothing was
+}
+
+// planExport decides what an export sends. A store of up to maxResults entries
+// (counted up front) streams whole in storage order. A larger one, or a request
+// continuing from ?cursor=, is exported a page at a time in key order like
+// /range, and a truncated page is marked with X-Truncated and X-Next-Cursor.
+// Call it before writing the response header.
+func (s *Server) planExport(w http.ResponseWriter, r *http.Request, store storage.Store) exportPage {
+	cursor := r.URL.Query().Get("cursor")
+	if cursor == "" && (s.maxResults <= 0 || store.Count() <= s.maxResults) {
+		return exportPage{}
+	}
+	entries, next := rangePage(store, cursor, "\xff", s.pageLimit(0))
+	if next != "" {
+		markTruncated(w, next)
+	}
+	return exportPage{paged: true, entries: entries, next: next}
+}
+
+// each calls fn for every entry the export sends, stopping early if fn
+// returns false
+func (p exportPage) each(store storage.Store, fn func(storage.DataEntry) bool) {
+	if !p.paged {
+		// ForEach has already released the segment lock when it calls fn
+		store.ForEach(func(_ string, entry storage.DataEntry) bool { return fn(entry) })
+		return
+	}
+	for _, entry := range p.entries {
+		if !fn(entry) {
+			return
+		}
 	}
 }
 
+// changesHandler streams the store's change feed as Server-Sent Events. Delivery is
+// best-effort: slow clients silently miss events rather than stalling writers.
+func (s *Server) changesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := s.table().Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	stopping := s.servers.stopping()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-stopping:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			payload, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, payload); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Sub-resources of a key that mainHandler routes on, as in /{key}/history
+var keySubresources = []string{"history", "aggregate"}
+
+// errMultiSegment is returned by keyFromPath for paths like /a/b/c, which don't
+// name a key at all
+var errMultiSegment = errors.New("path has more than one key segment")
+
+// keyFromPath extracts the key from /{key}, /{key}/history or /{key}/aggregate,
+// returning the sub-resource name (or "") alongside it. One trailing slash is
+// ignored, so /EU-A1/ addresses EU-A1. Percent-encoding is decoded only after
+// the suffix is split off, so an encoded slash (%2F) stays part of the key
+// instead of being mistaken for a path separator, while a literal slash left in
+// the key segment is refused with errMultiSegment.
+func keyFromPath(r *http.Request) (key, sub string, err error) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+	path = strings.TrimSuffix(path, "/")
+	for _, name := range keySubresources {
+		if rest, ok := strings.CutSuffix(path, "/"+name); ok {
+			path, sub = rest, name
+			break
+		}
+	}
+	if strings.Contains(path, "/") {
+		return "", "", errMultiSegment
+	}
+	key, err = url.PathUnescape(path)
+	return key, sub, err
+}
+
 func (s *Server) mainHandler(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/")
+	path, sub, err := keyFromPath(r)
+	if err == errMultiSegment {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "Invalid key encoding", http.StatusBadRequest)
+		return
+	}
+
+	if path == "" && sub == "" {
+		s.handleRoot(w, r)
+		return
+	}
+
+	if sub != "" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if sub == "aggregate" {
+			s.handleAggregate(w, r, path)
+		} else {
+			s.handleHistory(w, r, path)
+		}
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", strings.Join(keyMethods, ", "))
+		w.Header().Set("Accept-Patch", mergePatchType)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Normalize up front so the stored LocationId matches the canonical key
+	path = s.table().NormalizeKey(path)
+
+	r, cancel, ok := s.withClientDeadline(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
 
 	switch r.Method {
-	case http.MethodGet:
+	case http.MethodGet, http.MethodHead:
+		if s.capacityHeaders {
+			setCapacityHeaders(w, s.table())
+		}
+		// net/http drops the body for HEAD, leaving GET's headers
 		s.handleGet(w, r, path)
-	case http.MethodPut:
-		s.handlePut(w, r, path)
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		if !s.acquireWrite(w) {
+			return
+		}
+		defer s.releaseWrite()
+		switch r.Method {
+		case http.MethodPut:
+			s.handlePut(w, r, path)
+		case http.MethodPatch:
+			s.handlePatch(w, r, path)
+		default:
+			s.handleDelete(w, r, path)
+		}
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, keyMethods...)
+	}
+}
+
+// setCapacityHeaders advertises how full the store is so clients can back off
+// before they start seeing 507s
+func setCapacityHeaders(w http.ResponseWriter, store storage.Store) {
+	used, max := store.Size(), store.MaxSize()
+	w.Header().Set("X-Store-Used-Bytes", strconv.FormatUint(used, 10))
+	w.Header().Set("X-Store-Max-Bytes", strconv.FormatUint(max, 10))
+	if max > 0 {
+		w.Header().Set("X-Store-Used-Percent", strconv.FormatFloat(float64(used)*100/float64(max), 'f', 1, 64))
 	}
 }
 
 func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, locationID string) {
-	data, err := s.store.Get(locationID)
+	var data storage.DataEntry
+	var err error
+	if !callWithDeadline(r.Context(), func() { data, err = s.table().Get(locationID) }) {
+		gatewayTimeout(w)
+		return
+	}
+	if err == storage.ErrKeyNotFound && s.defaultOnMiss {
+		data = storage.DataEntry{LocationId: locationID}
+	} else if err != nil {
+		if err == storage.ErrKeyNotFound {
+			http.Error(w, "Location ID not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if s.maxServeAge > 0 && err == nil && time.Since(time.Unix(0, data.LastUpdated)) > s.maxServeAge {
+		// Still stored, just too old to be served as a current reading
+		http.Error(w, "Location data is stale", http.StatusGone)
+		return
+	}
+
+	// Rounding only changes what is shown; alerts and the ETag use exact values
+	view := s.shown(data)
+	var out interface{} = view
+	if s.thresholds != nil {
+		out = entryResponse{DataEntry: view, Status: s.thresholds.Status(data)}
+	}
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		projected, err := projectFields(view, fields)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.thresholds != nil {
+			projected["status"], _ = json.Marshal(s.thresholds.Status(data))
+		}
+		out = projected
+	}
+	if s.omitNilID && data.Id == uuid.Nil {
+		out = hideID(out)
+	}
+
+	if err == nil {
+		w.Header().Set("ETag", entryETag(data))
+		w.Header().Set("Last-Modified", lastModified(data).Format(http.TimeFormat))
+		// If-None-Match takes precedence when present (RFC 9110 13.1.3)
+		if ims := r.Header.Get("If-Modified-Since"); ims != "" && r.Header.Get("If-None-Match") == "" && notModifiedSince(ims, data) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	// The ETag names the entry's version, so it is the same whether the body is
+	// indented or compressed
+	w.Header().Add("Vary", "Accept-Encoding")
+	if acceptsGzip(r) {
+		gz := compress(w)
+		defer gz.Close()
+		w = gz
+	}
+	// Indented output is only for humans poking at the API with curl
+	s.writeJSON(w, http.StatusOK, out, r.URL.Query().Get("pretty") == "true")
+}
+
+// handleDelete removes an entry. With If-Match it only deletes the version the
+// client last saw, answering 412 if the entry has changed since.
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, locationID string) {
+	ifMatch := r.Header.Get("If-Match")
+	var err error
+	write := func(gate *commitGate) {
+		err = s.table().DeleteIf(locationID, func(current storage.DataEntry) error {
+			if ifMatch != "" && !etagMatches(ifMatch, current) {
+				return storage.ErrVersionMismatch
+			}
+			return gate.commit()
+		})
+	}
+	if !callWriteWithDeadline(r.Context(), write) {
+		gatewayTimeout(w)
+		return
+	}
 	if err != nil {
 		if err == storage.ErrKeyNotFound {
 			http.Error(w, "Location ID not found", http.StatusNotFound)
+		} else if err == storage.ErrVersionMismatch {
+			http.Error(w, "Version mismatch", http.StatusPreconditionFailed)
 		} else {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Fields a GET may project with ?fields=; id is always included
+var projectableFields = map[string]bool{
+	"seismic_activity":   true,
+	"temperature_c":      true,
+	"radiation_level":    true,
+	"location_id":        true,
+	"modification_count": true,
+}
+
+// projectFields keeps only the requested JSON fields of an entry, plus its id
+func projectFields(data storage.DataEntry, fields string) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
 
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	out := map[string]json.RawMessage{"id": all["id"]}
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		if name == "id" {
+			continue
+		}
+		if !projectableFields[name] {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		out[name] = all[name]
 	}
+	return out, nil
+}
+
+var (
+	errInvalidUUID = errors.New("invalid UUID format")
+	errNilUUID     = errors.New("nil UUID is not allowed")
+)
+
+// parseID parses a reading's id, refusing the nil UUID when strict UUID checks
+// are on since it almost always means the client never set one
+func (s *Server) parseID(raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, errInvalidUUID
+	}
+	if s.rejectNilUUID && id == uuid.Nil {
+		return uuid.Nil, errNilUUID
+	}
+	return id, nil
+}
+
+// hideID drops "id" from a GET response body. For struct bodies an outer nil
+// Id shadows the embedded one, so it is omitted without disturbing field order.
+func hideID(out interface{}) interface{} {
+	switch v := out.(type) {
+	case storage.DataEntry:
+		return struct {
+			storage.DataEntry
+			Id *uuid.UUID `json:"id,omitempty"`
+		}{DataEntry: v}
+	case entryResponse:
+		return struct {
+			entryResponse
+			Id *uuid.UUID `json:"id,omitempty"`
+		}{entryResponse: v}
+	case map[string]json.RawMessage:
+		delete(v, "id")
+	}
+	return out
 }
 
 func (s *Server) handlePut(w http.ResponseWriter, r *http.Request, locationID string) {
+	if err := storage.ValidateKey(locationID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store := s.table()
 	var reqData RequestData
 
-	d := json.NewDecoder(r.Body)
-	err := d.Decode(&reqData)
-
+	var body json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err == nil {
+		err = json.Unmarshal(body, &reqData)
+	}
 	if err != nil {
-		fmt.Printf("Error while decoding json: %v\n", err)
+		s.logger.Debug("error while decoding json", "err", err)
 		http.Error(w, "Invalid UUID format", http.StatusBadRequest)
 		return
 	}
+	if s.requireReadings {
+		var present sensorPresence
+		json.Unmarshal(body, &present) // already known to decode
+		if missing := present.missing(); len(missing) > 0 {
+			http.Error(w, "Missing required fields: "+strings.Join(missing, ", "), http.StatusUnprocessableEntity)
+			return
+		}
+	}
 
-	id, err := uuid.Parse(reqData.ID)
+	id, err := s.parseID(reqData.ID)
 	if err != nil {
-		http.Error(w, "Invalid UUID format", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var data storage.DataEntry
-	existingData, err := s.store.Get(locationID)
-	if err == nil {
-		data = existingData
-		data.ModificationCount++
-	} else if err == storage.ErrKeyNotFound {
-		data = storage.DataEntry{
-			Id:                id,
-			ModificationCount: 1,
-			LocationId:        locationID,
-		}
-	} else {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	schemaVersion, err := parseSchemaVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	expiresAt, err := parseTTLHeader(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	createOnly := r.Header.Get("If-None-Match") == "*"
 
-	data.SeismicActivity = reqData.SeismicActivity
-	data.TemperatureC = reqData.TemperatureC
-	data.RadiationLevel = reqData.RadiationLevel
+	// The existence check, version bump and write share one segment lock, so
+	// of two racing creates one creates and the other updates what it wrote
+	var data storage.DataEntry
+	apply := func(current storage.DataEntry, exists bool) (storage.DataEntry, error) {
+		next := current
+		if exists {
+			if createOnly {
+				return storage.DataEntry{}, storage.ErrKeyExists
+			}
+			next.ModificationCount = s.nextVersion(next.ModificationCount)
+		} else {
+			next = storage.DataEntry{
+				Id:                id,
+				ModificationCount: 1,
+				LocationId:        locationID,
+			}
+		}
+		next.SeismicActivity = reqData.SeismicActivity
+		next.TemperatureC = reqData.TemperatureC
+		next.RadiationLevel = reqData.RadiationLevel
+		next.SchemaVersion = schemaVersion
+		next.ExpiresAt = expiresAt
+		return next, next.Validate()
+	}
 
-	err = s.store.Put(locationID, data)
+	write := func(gate *commitGate) {
+		if s.faults != nil && s.faults.beforePut() {
+			err = storage.ErrInsufficientMemory
+			return
+		}
+		data, err = store.Update(locationID, func(current storage.DataEntry, exists bool) (storage.DataEntry, error) {
+			next, err := apply(current, exists)
+			if err == nil {
+				err = gate.commit()
+			}
+			return next, err
+		})
+	}
+	if !callWriteWithDeadline(r.Context(), write) {
+		gatewayTimeout(w)
+		return
+	}
+	// Set after the write so the numbers include it, and on a 507 as well
+	if s.capacityHeaders {
+		setCapacityHeaders(w, store)
+	}
 	if err != nil {
-		if err == storage.ErrInsufficientMemory {
+		var verr *storage.ValidationError
+		if errors.As(err, &verr) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if err == storage.ErrInsufficientMemory {
 			http.Error(w, "Insufficient storage", http.StatusInsufficientStorage)
+		} else if err == storage.ErrQuotaExceeded {
+			http.Error(w, "Region quota exceeded", http.StatusTooManyRequests)
+		} else if err == storage.ErrKeyExists {
+			http.Error(w, "Location ID already exists", http.StatusPreconditionFailed)
 		} else {
 			http.Error(w, "Write rejected", http.StatusInternalServerError)
 		}
 		return
 	}
 
+	// RFC 7240: clients can ask for the stored entry to save a follow-up GET
+	if preferRepresentation(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Preference-Applied", "return=representation")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newStoredEntry(data))
+		return
+	}
+
 	w.WriteHeader(http.StatusCreated)
 }
+
+// parseTTLHeader returns the ExpiresAt a write's X-TTL-Seconds asks for. Each
+// write sets its own expiry; without the header it is 0 and the table default
+// applies.
+func parseTTLHeader(r *http.Request) (int64, error) {
+	raw := r.Header.Get("X-TTL-Seconds")
+	if raw == "" {
+		return 0, nil
+	}
+	ttl, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || ttl < 0 {
+		return 0, errors.New("X-TTL-Seconds must be a non-negative integer")
+	}
+	if ttl == 0 {
+		return storage.NeverExpires, nil
+	}
+	return time.Now().Add(time.Duration(ttl) * time.Second).UnixNano(), nil
+}
+
+// parseSchemaVersion returns the payload schema version a write's
+// X-Schema-Version declares. Without the header it is 0 and the store records
+// storage.DefaultSchemaVersion.
+func parseSchemaVersion(r *http.Request) (int, error) {
+	raw := r.Header.Get("X-Schema-Version")
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 {
+		return 0, errors.New("X-Schema-Version must be a positive integer")
+	}
+	return v, nil
+}
+
+// storedEntry is an entry as the store holds it, including the timestamps a
+// plain GET leaves out, for write responses that echo what was stored
+type storedEntry struct {
+	storage.DataEntry
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // absent when the entry never expires
+}
+
+func newStoredEntry(e storage.DataEntry) storedEntry {
+	out := storedEntry{DataEntry: e, UpdatedAt: time.Unix(0, e.LastUpdated).UTC()}
+	if e.ExpiresAt > 0 && e.ExpiresAt != storage.NeverExpires {
+		expires := time.Unix(0, e.ExpiresAt).UTC()
+		out.ExpiresAt = &expires
+	}
+	return out
+}
+
+func preferRepresentation(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "return=representation") {
+				return true
+			}
+		}
+	}
+	return false
+}
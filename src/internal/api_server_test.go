@@ -0,0 +1,403 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+func TestPutReturnRepresentation(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	if body != "" {
+		t.Errorf("PUT without Prefer returned body %q, want none", body)
+	}
+
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading,
+		"Prefer", "return=representation", "X-TTL-Seconds", "60")
+	wantStatus(t, resp, body, http.StatusCreated)
+	if got := resp.Header.Get("Preference-Applied"); got != "return=representation" {
+		t.Errorf("Preference-Applied = %q", got)
+	}
+	var got struct {
+		LocationId        string     `json:"location_id"`
+		ModificationCount int        `json:"modification_count"`
+		SchemaVersion     int        `json:"schema_version"`
+		UpdatedAt         time.Time  `json:"updated_at"`
+		ExpiresAt         *time.Time `json:"expires_at"`
+	}
+	decode(t, body, &got)
+	if got.LocationId != "EU-A1" || got.ModificationCount != 2 || got.SchemaVersion != 1 {
+		t.Errorf("representation = %+v, want EU-A1 at version 2, schema 1", got)
+	}
+	if time.Since(got.UpdatedAt) > time.Minute {
+		t.Errorf("updated_at = %v, want the time of the write", got.UpdatedAt)
+	}
+	if got.ExpiresAt == nil || got.ExpiresAt.Sub(got.UpdatedAt).Round(time.Second) != time.Minute {
+		t.Errorf("expires_at = %v, want updated_at + 60s", got.ExpiresAt)
+	}
+}
+
+func TestGetMiss(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+	resp, body := do(t, ts, http.MethodGet, "/EU-NONE", "")
+	wantStatus(t, resp, body, http.StatusNotFound)
+
+	_, ts = newTestServer(t, newTestStore(), WithDefaultOnMiss())
+	resp, body = do(t, ts, http.MethodGet, "/EU-NONE", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var got map[string]any
+	decode(t, body, &got)
+	if got["location_id"] != "EU-NONE" || got["temperature_c"] != 0.0 || got["modification_count"] != 0.0 {
+		t.Errorf("default entry = %v, want zeros for EU-NONE", got)
+	}
+	if resp.Header.Get("ETag") != "" {
+		t.Errorf("default entry has ETag %q, but nothing is stored", resp.Header.Get("ETag"))
+	}
+}
+
+func TestPutIfNoneMatchCreatesOnce(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading, "If-None-Match", "*")
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading, "If-None-Match", "*")
+	wantStatus(t, resp, body, http.StatusPreconditionFailed)
+
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	if etag := resp.Header.Get("ETag"); etag != `"1"` {
+		t.Errorf("ETag after a refused create = %s, want \"1\"", etag)
+	}
+}
+
+func TestMaxServeAge(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store, WithMaxServeAge(50*time.Millisecond))
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+
+	time.Sleep(100 * time.Millisecond)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusGone)
+	if _, err := store.Get("EU-A1"); err != nil {
+		t.Errorf("stale entry was dropped from the store: %v", err)
+	}
+
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+}
+
+func TestCapacityHeaders(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store, WithCapacityHeaders())
+
+	for _, method := range []string{http.MethodPut, http.MethodGet} {
+		body := ""
+		if method == http.MethodPut {
+			body = testReading
+		}
+		resp, got := do(t, ts, method, "/EU-A1", body)
+		if resp.StatusCode >= 300 {
+			wantStatus(t, resp, got, http.StatusOK)
+		}
+		if used := resp.Header.Get("X-Store-Used-Bytes"); used != strconv.FormatUint(store.Size(), 10) || store.Size() == 0 {
+			t.Errorf("%s X-Store-Used-Bytes = %q, want %d", method, used, store.Size())
+		}
+		if max := resp.Header.Get("X-Store-Max-Bytes"); max != strconv.FormatUint(store.MaxSize(), 10) {
+			t.Errorf("%s X-Store-Max-Bytes = %q, want %d", method, max, store.MaxSize())
+		}
+		if resp.Header.Get("X-Store-Used-Percent") == "" {
+			t.Errorf("%s has no X-Store-Used-Percent", method)
+		}
+	}
+
+	for _, path := range []string{"/EU-A1/history", "/health"} {
+		resp, _ := do(t, ts, http.MethodGet, path, "")
+		if used := resp.Header.Get("X-Store-Used-Bytes"); used != "" {
+			t.Errorf("GET %s carries X-Store-Used-Bytes %q; only key GET/PUT should", path, used)
+		}
+	}
+	resp, body := do(t, ts, http.MethodOptions, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusNoContent)
+	if used := resp.Header.Get("X-Store-Used-Bytes"); used != "" {
+		t.Errorf("OPTIONS carries X-Store-Used-Bytes %q", used)
+	}
+
+	_, ts = newTestServer(t, store)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	if used := resp.Header.Get("X-Store-Used-Bytes"); used != "" {
+		t.Errorf("capacity headers are off by default, got X-Store-Used-Bytes %q", used)
+	}
+}
+
+func TestKeyCaseOverHTTP(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore(storage.WithKeyCase(storage.KeyCaseUpper)))
+	for _, path := range []string{"/EU-A1", "/eu-a1"} {
+		resp, body := do(t, ts, http.MethodPut, path, testReading)
+		wantStatus(t, resp, body, http.StatusCreated)
+	}
+	resp, body := do(t, ts, http.MethodGet, "/Eu-a1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var got storage.DataEntry
+	decode(t, body, &got)
+	if got.LocationId != "EU-A1" || got.ModificationCount != 2 {
+		t.Errorf("got %s at version %d, want both writes on EU-A1", got.LocationId, got.ModificationCount)
+	}
+
+	_, ts = newTestServer(t, newTestStore())
+	for _, path := range []string{"/EU-A1", "/eu-a1"} {
+		resp, body := do(t, ts, http.MethodPut, path, testReading)
+		wantStatus(t, resp, body, http.StatusCreated)
+	}
+	resp, body = do(t, ts, http.MethodGet, "/eu-a1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &got)
+	if got.LocationId != "eu-a1" || got.ModificationCount != 1 {
+		t.Errorf("got %s at version %d, want a separate eu-a1 entry without normalization", got.LocationId, got.ModificationCount)
+	}
+}
+
+func TestDeleteIfMatch(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store)
+
+	resp, body := do(t, ts, http.MethodDelete, "/EU-A1", "", "If-Match", `"1"`)
+	wantStatus(t, resp, body, http.StatusNotFound)
+
+	do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	do(t, ts, http.MethodPut, "/EU-A1", testReading)
+
+	resp, body = do(t, ts, http.MethodDelete, "/EU-A1", "", "If-Match", `"1"`)
+	wantStatus(t, resp, body, http.StatusPreconditionFailed)
+	if _, err := store.Get("EU-A1"); err != nil {
+		t.Fatalf("stale If-Match deleted the entry: %v", err)
+	}
+
+	resp, body = do(t, ts, http.MethodDelete, "/EU-A1", "", "If-Match", `"2"`)
+	wantStatus(t, resp, body, http.StatusNoContent)
+	if _, err := store.Get("EU-A1"); err != storage.ErrKeyNotFound {
+		t.Errorf("Get after a matching delete: %v, want ErrKeyNotFound", err)
+	}
+}
+
+// The nil UUID is an ordinary id unless strict UUIDs are on, and then every
+// write path refuses it
+func TestStrictUUIDs(t *testing.T) {
+	const nilID = "00000000-0000-0000-0000-000000000000"
+	reading := strings.Replace(testReading, "6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e", nilID, 1)
+	line := strings.Replace(importLine("EU-B1"), "6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e", nilID, 1)
+	batch := `{"ops":[{"op":"put","key":"EU-C1","entry":` + reading + `}]}`
+
+	_, ts := newTestServer(t, newTestStore())
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", reading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodPost, "/import", line)
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodPost, "/batch", batch)
+	wantStatus(t, resp, body, http.StatusOK)
+	if !strings.Contains(body, `"succeeded":1`) {
+		t.Errorf("batch with the nil UUID = %s, want it accepted", body)
+	}
+
+	store := newTestStore()
+	_, ts = newTestServer(t, store, WithStrictUUIDs())
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", reading)
+	wantStatus(t, resp, body, http.StatusBadRequest)
+	if !strings.Contains(body, errNilUUID.Error()) {
+		t.Errorf("PUT body %q, want it to name the nil UUID", body)
+	}
+	resp, body = do(t, ts, http.MethodPost, "/import", line)
+	wantStatus(t, resp, body, http.StatusBadRequest)
+	var result importResult
+	decode(t, body, &result)
+	if result.Failure == nil || result.Failure.Code != codeValidationFailed {
+		t.Errorf("import failure = %+v, want %s", result.Failure, codeValidationFailed)
+	}
+	resp, body = do(t, ts, http.MethodPost, "/batch", batch)
+	wantStatus(t, resp, body, http.StatusOK)
+	if !strings.Contains(body, `"failed":1`) {
+		t.Errorf("batch with the nil UUID = %s, want it refused", body)
+	}
+	if n := store.Count(); n != 0 {
+		t.Errorf("strict store holds %d entries, want none", n)
+	}
+}
+
+// Strict mode refuses a PUT missing any reading; lenient mode stores 0 for it
+func TestRequiredReadings(t *testing.T) {
+	const id = `"id":"6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e"`
+	bodies := map[string]string{
+		"seismic_activity": `{` + id + `,"temperature_c":21.25,"radiation_level":0.5}`,
+		"temperature_c":    `{` + id + `,"seismic_activity":1.5,"radiation_level":0.5}`,
+		"radiation_level":  `{` + id + `,"seismic_activity":1.5,"temperature_c":21.25}`,
+	}
+	strict := newTestStore()
+	_, strictTS := newTestServer(t, strict, WithRequiredReadings())
+	_, lenientTS := newTestServer(t, newTestStore())
+	for field, body := range bodies {
+		resp, got := do(t, strictTS, http.MethodPut, "/EU-A1", body)
+		wantStatus(t, resp, got, http.StatusUnprocessableEntity)
+		if !strings.Contains(got, field) {
+			t.Errorf("422 body %q doesn't name the missing %s", got, field)
+		}
+
+		resp, got = do(t, lenientTS, http.MethodPut, "/EU-"+field, body)
+		wantStatus(t, resp, got, http.StatusCreated)
+		resp, got = do(t, lenientTS, http.MethodGet, "/EU-"+field, "")
+		wantStatus(t, resp, got, http.StatusOK)
+		var entry map[string]any
+		decode(t, got, &entry)
+		if entry[field] != 0.0 {
+			t.Errorf("lenient PUT without %s stored %v, want 0", field, entry[field])
+		}
+	}
+	if n := strict.Count(); n != 0 {
+		t.Errorf("strict store holds %d entries after refused PUTs", n)
+	}
+
+	// Present zeros are genuine readings
+	resp, body := do(t, strictTS, http.MethodPut, "/EU-A1", `{`+id+`,"seismic_activity":0,"temperature_c":0,"radiation_level":0}`)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, strictTS, http.MethodPut, "/EU-A2", `{}`)
+	wantStatus(t, resp, body, http.StatusUnprocessableEntity)
+}
+
+// A nil id is left out only when asked, in every GET body shape, while a real
+// id is always sent
+func TestOmitNilID(t *testing.T) {
+	realID := uuid.MustParse("6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e")
+	newStore := func() *storage.SegmentedHashTable {
+		store := newTestStore()
+		store.Put("EU-NIL", storage.DataEntry{LocationId: "EU-NIL", ModificationCount: 1})
+		store.Put("EU-REAL", storage.DataEntry{Id: realID, LocationId: "EU-REAL", ModificationCount: 1})
+		return store
+	}
+	thresholds := AlertThresholds{"radiation_level": {Warning: 5, Critical: 10}}
+	idOf := func(t *testing.T, ts *httptest.Server, path string) (string, bool) {
+		t.Helper()
+		resp, body := do(t, ts, http.MethodGet, path, "")
+		wantStatus(t, resp, body, http.StatusOK)
+		var got map[string]any
+		decode(t, body, &got)
+		id, ok := got["id"].(string)
+		return id, ok
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []ServerOption
+	}{
+		{"plain", nil},
+		{"with status", []ServerOption{WithAlertThresholds(thresholds)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ts := newTestServer(t, newStore(), append(tc.opts, WithOmitNilID())...)
+			for _, path := range []string{"/EU-NIL", "/EU-NIL?fields=id,location_id"} {
+				if id, ok := idOf(t, ts, path); ok {
+					t.Errorf("GET %s: id %q sent for a nil UUID", path, id)
+				}
+			}
+			for _, path := range []string{"/EU-REAL", "/EU-REAL?fields=id,location_id"} {
+				if id, _ := idOf(t, ts, path); id != realID.String() {
+					t.Errorf("GET %s: id %q, want %s", path, id, realID)
+				}
+			}
+
+			_, ts = newTestServer(t, newStore(), tc.opts...)
+			if id, _ := idOf(t, ts, "/EU-NIL"); id != uuid.Nil.String() {
+				t.Errorf("GET /EU-NIL by default: id %q, want the nil UUID", id)
+			}
+		})
+	}
+}
+
+// putConcurrently sends n simultaneous PUTs of a reading to path and returns
+// their status codes
+func putConcurrently(s *Server, path string, n int, header ...string) []int {
+	codes := make([]int, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(testReading))
+			for j := 0; j+1 < len(header); j += 2 {
+				req.Header.Set(header[j], header[j+1])
+			}
+			rec := httptest.NewRecorder()
+			<-start
+			s.Handler().ServeHTTP(rec, req)
+			codes[i] = rec.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return codes
+}
+
+// Racing creates of one new key don't lose writes: one creates it and every
+// other PUT updates it, so the count ends at exactly N
+func TestConcurrentCreates(t *testing.T) {
+	const n = 64
+	store := newTestStore()
+	s, _ := newTestServer(t, store)
+
+	for i, code := range putConcurrently(s, "/EU-RACE", n) {
+		if code != http.StatusCreated {
+			t.Errorf("PUT %d: status %d, want 201", i, code)
+		}
+	}
+	entry, err := store.Get("EU-RACE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ModificationCount != n {
+		t.Errorf("modification_count = %d after %d concurrent PUTs, want %d", entry.ModificationCount, n, n)
+	}
+}
+
+// With If-None-Match: * exactly one of the racing creates wins and the rest
+// get 412 without touching the entry
+func TestConcurrentCreateOnly(t *testing.T) {
+	const n = 64
+	store := newTestStore()
+	s, _ := newTestServer(t, store)
+
+	created := 0
+	for i, code := range putConcurrently(s, "/EU-RACE", n, "If-None-Match", "*") {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusPreconditionFailed:
+		default:
+			t.Errorf("PUT %d: status %d, want 201 or 412", i, code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d of %d create-only PUTs succeeded, want exactly 1", created, n)
+	}
+	entry, err := store.Get("EU-RACE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ModificationCount != 1 {
+		t.Errorf("modification_count = %d, want 1: a losing create-only PUT wrote", entry.ModificationCount)
+	}
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default number of entries returned by /admin/audit
+const defaultAuditLimit = 100
+
+// auditEntry is one recorded mutation
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Key    string    `json:"key,omitempty"` // set for /{key} requests
+	Client string    `json:"client"`
+	Status int       `json:"status"`
+}
+
+// auditLog is a fixed-size ring of the most recent mutations, kept for people
+// investigating incidents. Unlike the change feed it also records rejected
+// writes, and it can be read back at any time.
+type auditLog struct {
+	mu      sync.Mutex
+	entries []auditEntry
+	next    int  // slot the next entry goes in
+	full    bool // entries has wrapped at least once
+}
+
+func newAuditLog(size int) *auditLog {
+	return &auditLog{entries: make([]auditEntry, size)}
+}
+
+func (a *auditLog) record(e auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries[a.next] = e
+	a.next = (a.next + 1) % len(a.entries)
+	if a.next == 0 {
+		a.full = true
+	}
+}
+
+// recent returns up to limit entries, most recent first
+func (a *auditLog) recent(limit int) []auditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := a.next
+	if a.full {
+		n = len(a.entries)
+	}
+	n = min(n, limit)
+	out := make([]auditEntry, n)
+	for i := range out {
+		out[i] = a.entries[(a.next-1-i+len(a.entries))%len(a.entries)]
+	}
+	return out
+}
+
+// auditMutations records every non-read request in the audit log once it has
+// been answered, including ones rejected by auth or validation
+func (s *Server) auditMutations(next http.Handler) http.Handler {
+	if s.audit == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isRead(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		e := auditEntry{
+			Time:   time.Now().UTC(),
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Client: r.RemoteAddr,
+			Status: rec.status,
+		}
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			e.Client = host
+		}
+		if r.Pattern == "/" {
+			e.Key, _, _ = keyFromPath(r)
+		}
+		s.audit.record(e)
+	})
+}
+
+// auditHandler serves GET /admin/audit?limit=N, the most recent mutations first
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	limit := defaultAuditLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	s.writeJSON(w, http.StatusOK, s.audit.recent(limit), false)
+}
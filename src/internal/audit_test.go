@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAuditLogWraps(t *testing.T) {
+	a := newAuditLog(3)
+	if got := a.recent(10); len(got) != 0 {
+		t.Fatalf("empty log returned %d entries", len(got))
+	}
+	for i := 0; i < 5; i++ {
+		a.record(auditEntry{Key: fmt.Sprintf("EU-%d", i)})
+	}
+	got := a.recent(10)
+	if len(got) != 3 {
+		t.Fatalf("%d entries after wrapping a ring of 3, want 3", len(got))
+	}
+	for i, want := range []string{"EU-4", "EU-3", "EU-2"} {
+		if got[i].Key != want {
+			t.Errorf("entry %d = %s, want %s (most recent first)", i, got[i].Key, want)
+		}
+	}
+	if got := a.recent(2); len(got) != 2 || got[0].Key != "EU-4" {
+		t.Errorf("recent(2) = %+v, want EU-4 and EU-3", got)
+	}
+}
+
+func TestAuditEndpoint(t *testing.T) {
+	keys := []APIKey{{Key: "writer-key", Role: RoleReadWrite}}
+	_, ts := newTestServer(t, newTestStore(), WithAuditLog(2), WithAPIKeys(keys, true))
+	auth := []string{"X-API-Key", "writer-key"}
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading, auth...)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodDelete, "/EU-A9", "", auth...)
+	wantStatus(t, resp, body, http.StatusNotFound)
+	resp, body = do(t, ts, http.MethodDelete, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+
+	resp, body = do(t, ts, http.MethodGet, "/admin/audit", "")
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+	resp, body = do(t, ts, http.MethodGet, "/admin/audit?limit=0", "", auth...)
+	wantStatus(t, resp, body, http.StatusBadRequest)
+
+	resp, body = do(t, ts, http.MethodGet, "/admin/audit", "", auth...)
+	wantStatus(t, resp, body, http.StatusOK)
+	var got []auditEntry
+	decode(t, body, &got)
+	// The ring of 2 has dropped the PUT; reads are never recorded
+	want := []auditEntry{
+		{Method: http.MethodDelete, Key: "EU-A1", Status: http.StatusUnauthorized},
+		{Method: http.MethodDelete, Key: "EU-A9", Status: http.StatusNotFound},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("audit = %+v, want %d entries", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Method != w.Method || got[i].Key != w.Key || got[i].Status != w.Status || got[i].Client != "127.0.0.1" || got[i].Time.IsZero() {
+			t.Errorf("entry %d = %+v, want %s %s %d from 127.0.0.1", i, got[i], w.Method, w.Key, w.Status)
+		}
+	}
+
+	resp, body = do(t, ts, http.MethodGet, "/admin/audit?limit=1", "", auth...)
+	wantStatus(t, resp, body, http.StatusOK)
+	got = nil
+	decode(t, body, &got)
+	if len(got) != 1 || got[0].Key != "EU-A1" {
+		t.Errorf("limit=1 returned %+v, want the latest entry", got)
+	}
+}
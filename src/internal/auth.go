@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// APIKeyRole is what an API key may do
+type APIKeyRole int
+
+const (
+	RoleReadWrite APIKeyRole = iota // any request, the default
+	RoleRead                        // GET, HEAD and OPTIONS only; writes get 403
+)
+
+// APIKey is one configured key and its role
+type APIKey struct {
+	Key  string
+	Role APIKeyRole
+}
+
+// ParseAPIKey parses "key" or "key:role", where role is read or write
+// (read-write). A bare key is read-write.
+func ParseAPIKey(spec string) (APIKey, error) {
+	key, role, found := strings.Cut(strings.TrimSpace(spec), ":")
+	if key == "" {
+		return APIKey{}, fmt.Errorf("API key %q: empty key", spec)
+	}
+	switch {
+	case !found || role == "write":
+		return APIKey{Key: key, Role: RoleReadWrite}, nil
+	case role == "read":
+		return APIKey{Key: key, Role: RoleRead}, nil
+	}
+	return APIKey{}, fmt.Errorf("API key %q: unknown role %q", spec, role)
+}
+
+// apiKeys is the set of keys accepted by requireAPIKey
+type apiKeys struct {
+	keys        []APIKey
+	publicReads bool // GET/HEAD outside /admin/ and /debug/ need no key
+}
+
+// LoadAPIKeys reads API keys in ParseAPIKey form from path, one per line;
+// blank lines and lines starting with '#' are skipped
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []APIKey
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := ParseAPIKey(line)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
+
+// lookup finds key's role, comparing against every configured key in constant
+// time so response timing doesn't reveal how much of a guess was right
+func (a *apiKeys) lookup(key string) (role APIKeyRole, ok bool) {
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k.Key)) == 1 {
+			role, ok = k.Role, true
+		}
+	}
+	return role, ok
+}
+
+// isRead reports whether r only reads, which is all a read key may do
+func isRead(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// requestAPIKey returns the key from "Authorization: Bearer <key>" or X-API-Key
+func requestAPIKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// needsAPIKey reports whether r must carry a key. Probes are always open so
+// orchestrators don't need credentials; reads are open when publicReads is set,
+// except under /admin/ and /debug/.
+func (a *apiKeys) needsAPIKey(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/health", "/health/ready", "/ping":
+		return false
+	}
+	if strings.HasPrefix(r.URL.Path, "/admin/") || strings.HasPrefix(r.URL.Path, "/debug/") {
+		return true
+	}
+	return !isRead(r) || !a.publicReads
+}
+
+// requireAPIKey answers 401 to requests that need a key and don't carry a
+// valid one, and 403 to writes made with a read-only key. A no-op when no keys
+// are configured.
+func (s *Server) requireAPIKey(next http.Handler) http.Handler {
+	if s.apiKeys == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.apiKeys.needsAPIKey(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		role, ok := s.apiKeys.lookup(requestAPIKey(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="datahub"`)
+			http.Error(w, "Missing or invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if role == RoleRead && !isRead(r) {
+			http.Error(w, "API key is read-only", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
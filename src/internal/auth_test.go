@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := []APIKey{{Key: "writer-key", Role: RoleReadWrite}, {Key: "reader-key", Role: RoleRead}}
+	for _, publicReads := range []bool{true, false} {
+		_, ts := newTestServer(t, newTestStore(), WithAPIKeys(keys, publicReads))
+		resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading, "X-API-Key", "writer-key")
+		wantStatus(t, resp, body, http.StatusCreated)
+
+		readStatus := http.StatusUnauthorized
+		if publicReads {
+			readStatus = http.StatusOK
+		}
+		cases := []struct {
+			name           string
+			method, path   string
+			body           string
+			header         []string
+			want           int
+			wantChallenged bool
+		}{
+			{"probe without a key", http.MethodGet, "/health", "", nil, http.StatusOK, false},
+			{"read without a key", http.MethodGet, "/EU-A1", "", nil, readStatus, !publicReads},
+			{"write without a key", http.MethodPut, "/EU-A1", testReading, nil, http.StatusUnauthorized, true},
+			{"write with a wrong key", http.MethodDelete, "/EU-A1", "", []string{"X-API-Key", "guess"}, http.StatusUnauthorized, true},
+			{"admin without a key", http.MethodGet, "/admin/verify-size", "", nil, http.StatusUnauthorized, true},
+			{"admin with a bearer key", http.MethodGet, "/admin/verify-size", "", []string{"Authorization", "Bearer writer-key"}, http.StatusOK, false},
+			{"write with a bearer key", http.MethodPut, "/EU-A2", testReading, []string{"Authorization", "Bearer writer-key"}, http.StatusCreated, false},
+			{"read with a read key", http.MethodGet, "/EU-A1", "", []string{"X-API-Key", "reader-key"}, http.StatusOK, false},
+			{"write with a read key", http.MethodPut, "/EU-A1", testReading, []string{"X-API-Key", "reader-key"}, http.StatusForbidden, false},
+			{"delete with a read key", http.MethodDelete, "/EU-A1", "", []string{"Authorization", "Bearer reader-key"}, http.StatusForbidden, false},
+			{"batch with a read key", http.MethodPost, "/batch", `{"ops":[]}`, []string{"X-API-Key", "reader-key"}, http.StatusForbidden, false},
+		}
+		for _, tc := range cases {
+			resp, body := do(t, ts, tc.method, tc.path, tc.body, tc.header...)
+			if resp.StatusCode != tc.want {
+				t.Errorf("public reads %v, %s: status %d, want %d (%q)", publicReads, tc.name, resp.StatusCode, tc.want, body)
+			}
+			if challenged := resp.Header.Get("WWW-Authenticate") != ""; challenged != tc.wantChallenged {
+				t.Errorf("public reads %v, %s: WWW-Authenticate present %v", publicReads, tc.name, challenged)
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// Stable per-record error codes shared by /batch and /import, so clients can
+// branch on them instead of parsing messages
+const (
+	codeInvalidKey          = "invalid_key"
+	codeInvalidJSON         = "invalid_json"
+	codeValidationFailed    = "validation_failed"
+	codeNotFound            = "not_found"
+	codeInsufficientStorage = "insufficient_storage"
+	codeQuotaExceeded       = "quota_exceeded"
+	codeInternal            = "internal_error"
+)
+
+// Default cap on ops per POST /batch
+const defaultMaxBatch = 10000
+
+// errBatchTooLarge means a batch body held more ops than allowed
+var errBatchTooLarge = errors.New("batch too large")
+
+// recordStatus is the outcome of one record in a batch or import. Status is
+// the HTTP status the record would have got as a single request; Code is one of
+// the code* constants and is empty on success.
+type recordStatus struct {
+	Index  int    `json:"index"` // position in the batch, or line number for imports
+	Key    string `json:"key,omitempty"`
+	Status int    `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// failure fills in Status, Code and Error for err
+func (rs *recordStatus) failure(err error) {
+	var verr *storage.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		rs.Status, rs.Code = http.StatusBadRequest, codeValidationFailed
+	case err == storage.ErrKeyNotFound:
+		rs.Status, rs.Code = http.StatusNotFound, codeNotFound
+	case err == storage.ErrInsufficientMemory:
+		rs.Status, rs.Code = http.StatusInsufficientStorage, codeInsufficientStorage
+	case err == storage.ErrQuotaExceeded:
+		rs.Status, rs.Code = http.StatusTooManyRequests, codeQuotaExceeded
+	default:
+		rs.Status, rs.Code = http.StatusInternalServerError, codeInternal
+	}
+	rs.Error = err.Error()
+}
+
+type batchResponse struct {
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Results   []recordStatus `json:"results"`
+}
+
+// batchHandler serves POST /batch: the same {"ops": [...]} body as /txn, but each
+// op is applied independently and reported with its own status and code. The
+// response is 200 whenever the body itself was understood. X-Schema-Version
+// applies to every put in the batch.
+func (s *Server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.acquireWrite(w) {
+		return
+	}
+	defer s.releaseWrite()
+	schemaVersion, err := parseSchemaVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ops, err := decodeBatchOps(r.Body, s.maxBatch)
+	if err == errBatchTooLarge {
+		http.Error(w, fmt.Sprintf("A batch holds at most %d ops", s.maxBatch), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, "Invalid batch body", http.StatusBadRequest)
+		return
+	}
+	if len(ops) == 0 {
+		http.Error(w, "A batch needs at least one op", http.StatusBadRequest)
+		return
+	}
+
+	store := s.table()
+	resp := batchResponse{Results: make([]recordStatus, len(ops))}
+	// Consecutive puts are written together through PutBatch; a delete flushes
+	// the puts before it so ops still take effect in order
+	var pending []storage.BatchRecord
+	var pendingIdx []int
+	flush := func() {
+		for j, err := range store.PutBatch(pending) {
+			rs := &resp.Results[pendingIdx[j]]
+			if err != nil {
+				rs.failure(err)
+			} else {
+				rs.Status = http.StatusOK
+			}
+		}
+		pending, pendingIdx = pending[:0], pendingIdx[:0]
+	}
+	for i, in := range ops {
+		rs := &resp.Results[i]
+		rs.Index, rs.Key = i, store.NormalizeKey(in.Key)
+		if err := storage.ValidateKey(rs.Key); err != nil {
+			rs.Status, rs.Code, rs.Error = http.StatusBadRequest, codeInvalidKey, err.Error()
+			continue
+		}
+		switch {
+		case in.Op == "delete":
+			flush()
+			if err := store.Delete(rs.Key); err != nil {
+				rs.failure(err)
+			} else {
+				rs.Status = http.StatusNoContent
+			}
+		case in.Op == "put" && in.Entry != nil:
+			if rec, ok := s.batchPut(rs, *in.Entry, schemaVersion); ok {
+				pending = append(pending, rec)
+				pendingIdx = append(pendingIdx, i)
+			}
+		default:
+			rs.Status, rs.Code, rs.Error = http.StatusBadRequest, codeValidationFailed, "op must be put (with an entry) or delete"
+		}
+	}
+	flush()
+	for _, rs := range resp.Results {
+		if rs.Code == "" {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, resp, false)
+}
+
+// decodeBatchOps reads the ops of a {"ops": [...]} body one at a time, failing
+// with errBatchTooLarge as soon as there are more than max (0 for no limit), so
+// an oversized batch is refused without reading the rest of it
+func decodeBatchOps(body io.Reader, max int) ([]txnOpRequest, error) {
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	var ops []txnOpRequest
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok != "ops" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return nil, err
+		}
+		for dec.More() {
+			if max > 0 && len(ops) == max {
+				return nil, errBatchTooLarge
+			}
+			var op txnOpRequest
+			if err := dec.Decode(&op); err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+	return ops, expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("expected %v, got %v", want, tok)
+	}
+	return nil
+}
+
+// batchPut turns one put into a record with PUT /{key} semantics, or records
+// why it can't be written in rs and returns false. schemaVersion is the batch's
+// X-Schema-Version, 0 if it sent none.
+func (s *Server) batchPut(rs *recordStatus, reading RequestData, schemaVersion int) (storage.BatchRecord, bool) {
+	id, err := s.parseID(reading.ID)
+	if err != nil {
+		rs.Status, rs.Code, rs.Error = http.StatusBadRequest, codeValidationFailed, err.Error()
+		return storage.BatchRecord{}, false
+	}
+	key := rs.Key
+	return storage.BatchRecord{Key: key, Update: func(current storage.DataEntry, exists bool) (storage.DataEntry, error) {
+		data := current
+		if exists {
+			data.ModificationCount = s.nextVersion(data.ModificationCount)
+		} else {
+			data = storage.DataEntry{Id: id, ModificationCount: 1, LocationId: key}
+		}
+		data.SeismicActivity = reading.SeismicActivity
+		data.TemperatureC = reading.TemperatureC
+		data.RadiationLevel = reading.RadiationLevel
+		data.SchemaVersion = schemaVersion
+		data.ExpiresAt = 0
+		return data, data.Validate()
+	}}, true
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// Each kind of failure is reported on its own record with a stable code, and
+// doesn't stop the records around it
+func TestBatchRecordCodes(t *testing.T) {
+	// Room for two entries at 100 bytes each
+	store := storage.NewSegmentedHashTable(4, 200, storage.WithSizeEstimator(func(string, storage.DataEntry) uint64 { return 100 }))
+	_, ts := newTestServer(t, store)
+
+	resp, body := do(t, ts, http.MethodPost, "/batch", `{"ops":[
+		{"op":"put","key":"EU-A1","entry":`+testReading+`},
+		{"op":"put","key":"bad key","entry":`+testReading+`},
+		{"op":"delete","key":"EU-404"},
+		{"op":"put","key":"EU-A2","entry":{"id":"not-a-uuid"}},
+		{"op":"put","key":"EU-A2"},
+		{"op":"put","key":"EU-A2","entry":`+testReading+`},
+		{"op":"put","key":"EU-A3","entry":`+testReading+`},
+		{"op":"delete","key":"EU-A1"}]}`)
+	wantStatus(t, resp, body, http.StatusOK)
+	var got batchResponse
+	decode(t, body, &got)
+
+	want := []struct {
+		status int
+		code   string
+	}{
+		{http.StatusOK, ""},
+		{http.StatusBadRequest, codeInvalidKey},
+		{http.StatusNotFound, codeNotFound},
+		{http.StatusBadRequest, codeValidationFailed},
+		{http.StatusBadRequest, codeValidationFailed},
+		{http.StatusOK, ""},
+		{http.StatusInsufficientStorage, codeInsufficientStorage},
+		{http.StatusNoContent, ""},
+	}
+	if len(got.Results) != len(want) {
+		t.Fatalf("%d results, want %d: %s", len(got.Results), len(want), body)
+	}
+	for i, w := range want {
+		rs := got.Results[i]
+		if rs.Index != i || rs.Status != w.status || rs.Code != w.code {
+			t.Errorf("record %d: index %d status %d code %q, want status %d code %q", i, rs.Index, rs.Status, rs.Code, w.status, w.code)
+		}
+		if (rs.Code == "") != (rs.Error == "") {
+			t.Errorf("record %d: code %q with error %q", i, rs.Code, rs.Error)
+		}
+	}
+	if got.Succeeded != 3 || got.Failed != 5 {
+		t.Errorf("succeeded %d failed %d, want 3 and 5", got.Succeeded, got.Failed)
+	}
+}
+
+// Puts are written in groups, but a later put to the same key still sees an
+// earlier one and a delete between them still lands in between
+func TestBatchKeepsOpOrder(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store)
+
+	resp, body := do(t, ts, http.MethodPost, "/batch", `{"ops":[
+		{"op":"put","key":"EU-A1","entry":`+testReading+`},
+		{"op":"put","key":"EU-A1","entry":`+testReading+`},
+		{"op":"put","key":"EU-A2","entry":`+testReading+`},
+		{"op":"delete","key":"EU-A2"},
+		{"op":"put","key":"EU-A2","entry":`+testReading+`}]}`)
+	wantStatus(t, resp, body, http.StatusOK)
+	var got batchResponse
+	decode(t, body, &got)
+	if got.Succeeded != 5 {
+		t.Fatalf("succeeded %d, want 5: %s", got.Succeeded, body)
+	}
+	for key, want := range map[string]int{"EU-A1": 2, "EU-A2": 1} {
+		entry, err := store.Get(key)
+		if err != nil || entry.ModificationCount != want {
+			t.Errorf("Get(%s) = version %d, %v; want version %d", key, entry.ModificationCount, err, want)
+		}
+	}
+}
+
+// /import reports a failing line with the same status and code a batch would
+func TestImportRecordCodes(t *testing.T) {
+	cases := []struct {
+		name   string
+		line   string
+		status int
+		code   string
+	}{
+		{"invalid JSON", "{not json\n", http.StatusBadRequest, codeInvalidJSON},
+		{"invalid key", importLine("bad key"), http.StatusBadRequest, codeInvalidKey},
+		{"validation", strings.Replace(importLine("EU-A2"), `"modification_count":4`, `"modification_count":-1`, 1), http.StatusBadRequest, codeValidationFailed},
+		{"full store", importLine("EU-A2") + importLine("EU-A3"), http.StatusInsufficientStorage, codeInsufficientStorage},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := storage.NewSegmentedHashTable(4, 200, storage.WithSizeEstimator(func(string, storage.DataEntry) uint64 { return 100 }))
+			_, ts := newTestServer(t, store)
+			resp, body := do(t, ts, http.MethodPost, "/import", importLine("EU-A1")+tc.line)
+			wantStatus(t, resp, body, tc.status)
+			var result importResult
+			decode(t, body, &result)
+			if result.Failure == nil {
+				t.Fatalf("no failure reported: %s", body)
+			}
+			if result.Failure.Status != tc.status || result.Failure.Code != tc.code {
+				t.Errorf("failure status %d code %q, want %d %q", result.Failure.Status, result.Failure.Code, tc.status, tc.code)
+			}
+		})
+	}
+}
+
+// endlessOps is a {"ops": [...]} body that never ends, so a handler only
+// returns if it stops reading once the op limit is passed
+type endlessOps struct {
+	started bool
+	pending string
+}
+
+func (b *endlessOps) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if b.pending == "" {
+			b.pending = `{"op":"delete","key":"EU-A1"},`
+			if !b.started {
+				b.started, b.pending = true, `{"ops":[`
+			}
+		}
+		c := copy(p[n:], b.pending)
+		b.pending = b.pending[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// postEndless posts an endless op list to path, failing the test if the
+// handler doesn't give up on its own
+func postEndless(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, &endlessOps{}))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("POST %s kept reading past the op limit", path)
+	}
+	return rec
+}
+
+func TestBatchTooLarge(t *testing.T) {
+	s, ts := newTestServer(t, newTestStore(), WithMaxBatchSize(3))
+	resp, body := do(t, ts, http.MethodPost, "/batch", `{"ops":[
+		{"op":"put","key":"EU-A1","entry":`+testReading+`},
+		{"op":"put","key":"EU-A2","entry":`+testReading+`},
+		{"op":"put","key":"EU-A3","entry":`+testReading+`},
+		{"op":"put","key":"EU-A4","entry":`+testReading+`}]}`)
+	wantStatus(t, resp, body, http.StatusRequestEntityTooLarge)
+	if n := s.table().Count(); n != 0 {
+		t.Errorf("%d entries stored from a rejected batch, want 0", n)
+	}
+
+	if rec := postEndless(t, s, "/batch"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("endless batch: status %d, want 413", rec.Code)
+	}
+}
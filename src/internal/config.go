@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// configHandler serves GET /admin/config: the effective server and store
+// configuration, so a deployment can be checked against what its flags and
+// environment were meant to set. Secrets are never included: API keys are
+// reported by count and the hash salt only as set. Only registered in debug
+// mode, and behind API-key auth like every /admin/ route.
+func (s *Server) configHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	store := s.table()
+
+	server := map[string]interface{}{
+		"max_scans":                cap(s.scanSem),
+		"scan_queue_timeout_ns":    s.scanQueueTimeout,
+		"max_inflight_writes":      cap(s.writeSem),
+		"max_request_timeout_ns":   s.maxRequestTimeout,
+		"max_serve_age_ns":         s.maxServeAge,
+		"slow_request_ns":          s.slowRequest,
+		"log_sample":               s.logSampleN,
+		"max_results":              s.maxResults,
+		"max_batch":                s.maxBatch,
+		"max_version":              s.maxVersion,
+		"reading_precision":        s.readingPlaces,
+		"encode_buffer_bytes":      s.encodeBufferSize,
+		"export_buffer_bytes":      s.exportBufferSize,
+		"stream_threshold_bytes":   s.streamThreshold,
+		"default_on_miss":          s.defaultOnMiss,
+		"alert_thresholds":         s.thresholds,
+		"capacity_headers":         s.capacityHeaders,
+		"capacity_ready_threshold": s.capacityThreshold,
+		"root_index":               s.rootIndex,
+		"separate_admin":           s.separateAdmin,
+		"strict_uuids":             s.rejectNilUUID,
+		"omit_nil_id":              s.omitNilID,
+		"require_readings":         s.requireReadings,
+		"raw_store":                s.raw != nil,
+		"fault_injection":          s.faults != nil,
+		"debug":                    s.debug,
+	}
+	if s.rateLimit != nil {
+		server["rate_limit"] = map[string]interface{}{"per_second": s.rateLimit.rate, "burst": s.rateLimit.burst}
+	}
+	if s.audit != nil {
+		server["audit_size"] = len(s.audit.entries)
+	}
+	if s.apiKeys != nil {
+		server["api_keys"] = map[string]interface{}{"count": len(s.apiKeys.keys), "public_reads": s.apiKeys.publicReads}
+	}
+
+	out := map[string]interface{}{"server": server}
+	if ns, ok := store.(interface{ Namespace() string }); ok {
+		out["namespace"] = ns.Namespace()
+	}
+	if c, ok := storage.Underlying(store).(interface{ Config() storage.TableConfig }); ok {
+		out["store"] = c.Config()
+	}
+	s.writeJSON(w, http.StatusOK, out, r.URL.Query().Get("pretty") == "true")
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// The reported configuration is what the store and server were built with,
+// and no secret appears in it
+func TestConfigEndpoint(t *testing.T) {
+	table := storage.NewSegmentedHashTable(8, 1<<20,
+		storage.WithDefaultTTL(time.Hour),
+		storage.WithHistory(5),
+		storage.WithHashSalt("secret-salt"),
+		storage.WithKeyCase(storage.KeyCaseLower))
+	store, _ := storage.NewNamespaced(table, "tenant")
+	keys := []APIKey{{Key: "secret-admin-key", Role: RoleReadWrite}}
+	_, ts := newTestServer(t, store, WithDebug(),
+		WithAPIKeys(keys, true),
+		WithRateLimit(50, 10),
+		WithMaxResults(250),
+		WithReadingPrecision(2),
+		WithAuditLog(16),
+		WithMaxInflightWrites(3))
+
+	resp, body := do(t, ts, http.MethodGet, "/admin/config", "")
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+
+	resp, body = do(t, ts, http.MethodGet, "/admin/config", "", "X-API-Key", "secret-admin-key")
+	wantStatus(t, resp, body, http.StatusOK)
+	for _, secret := range []string{"secret-admin-key", "secret-salt"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("config exposes %q: %s", secret, body)
+		}
+	}
+
+	var got struct {
+		Namespace string `json:"namespace"`
+		Server    struct {
+			MaxResults        int  `json:"max_results"`
+			ReadingPrecision  int  `json:"reading_precision"`
+			AuditSize         int  `json:"audit_size"`
+			MaxInflightWrites int  `json:"max_inflight_writes"`
+			Debug             bool `json:"debug"`
+			RateLimit         struct {
+				PerSecond float64 `json:"per_second"`
+				Burst     int     `json:"burst"`
+			} `json:"rate_limit"`
+			APIKeys struct {
+				Count       int  `json:"count"`
+				PublicReads bool `json:"public_reads"`
+			} `json:"api_keys"`
+		} `json:"server"`
+		Store storage.TableConfig `json:"store"`
+	}
+	decode(t, body, &got)
+	if got.Namespace != "tenant" {
+		t.Errorf("namespace = %q, want tenant", got.Namespace)
+	}
+	srv := got.Server
+	if srv.MaxResults != 250 || srv.ReadingPrecision != 2 || srv.AuditSize != 16 || srv.MaxInflightWrites != 3 || !srv.Debug {
+		t.Errorf("server config = %+v", srv)
+	}
+	if srv.RateLimit.PerSecond != 50 || srv.RateLimit.Burst != 10 {
+		t.Errorf("rate_limit = %+v, want 50/s burst 10", srv.RateLimit)
+	}
+	if srv.APIKeys.Count != 1 || !srv.APIKeys.PublicReads {
+		t.Errorf("api_keys = %+v, want 1 key with public reads", srv.APIKeys)
+	}
+	if want := table.Config(); got.Store.Segments != 8 || got.Store.MaxSizeBytes != 1<<20 ||
+		got.Store.DefaultTTL != time.Hour || got.Store.HistoryLen != 5 || !got.Store.HashSalted ||
+		got.Store.KeyCase != "lower" || got.Store.SegmentHash != want.SegmentHash {
+		t.Errorf("store config = %+v, want %+v", got.Store, want)
+	}
+}
+
+// Outside debug mode there is no config endpoint
+func TestConfigEndpointNeedsDebug(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+	resp, body := do(t, ts, http.MethodGet, "/admin/config", "")
+	if resp.StatusCode == http.StatusOK {
+		t.Errorf("/admin/config without debug: 200 %q", body)
+	}
+}
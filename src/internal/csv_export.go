@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+type csvColumn struct {
+	name  string
+	value func(e storage.DataEntry) string
+}
+
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
+
+var csvColumns = []csvColumn{
+	{"id", func(e storage.DataEntry) string { return e.Id.String() }},
+	{"location_id", func(e storage.DataEntry) string { return e.LocationId }},
+	{"seismic_activity", func(e storage.DataEntry) string { return formatFloat(e.SeismicActivity) }},
+	{"temperature_c", func(e storage.DataEntry) string { return formatFloat(e.TemperatureC) }},
+	{"radiation_level", func(e storage.DataEntry) string { return formatFloat(e.RadiationLevel) }},
+	{"modification_count", func(e storage.DataEntry) string { return strconv.Itoa(e.ModificationCount) }},
+	{"schema_version", func(e storage.DataEntry) string { return strconv.Itoa(e.SchemaVersion) }},
+}
+
+// selectCSVColumns resolves ?fields=a,b into columns, keeping the requested order.
+// An empty filter selects every column.
+func selectCSVColumns(fields string) ([]csvColumn, bool) {
+	if fields == "" {
+		return csvColumns, true
+	}
+	var cols []csvColumn
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, col := range csvColumns {
+			if col.name == name {
+				cols = append(cols, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return cols, true
+}
+
+// csvExportHandler streams every entry as a CSV row, flushing as it goes, and
+// pages like /export once the store outgrows maxResults
+func (s *Server) csvExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	cols, ok := selectCSVColumns(r.URL.Query().Get("fields"))
+	if !ok {
+		http.Error(w, "Unknown field", http.StatusBadRequest)
+		return
+	}
+	if !s.acquireScan(w, r) {
+		return
+	}
+	defer s.releaseScan()
+
+	store := s.table()
+	page := s.planExport(w, r, store)
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	row := make([]string, len(cols))
+	for i, col := range cols {
+		row[i] = col.name
+	}
+	cw.Write(row)
+
+	page.each(store, func(entry storage.DataEntry) bool {
+		entry = s.shown(entry)
+		for i, col := range cols {
+			row[i] = col.value(entry)
+		}
+		cw.Write(row)
+		cw.Flush()
+		return cw.Error() == nil
+	})
+	cw.Flush()
+}
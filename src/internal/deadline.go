@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Clients may state their own latency budget in milliseconds with this header
+const requestTimeoutHeader = "X-Timeout-Ms"
+
+// Default upper bound for client-requested timeouts
+const defaultMaxRequestTimeout = 30 * time.Second
+
+// withClientDeadline applies the X-Timeout-Ms budget (clamped to
+// maxRequestTimeout) to the request context. It answers 400 itself and returns
+// false when the header is malformed.
+func (s *Server) withClientDeadline(w http.ResponseWriter, r *http.Request) (*http.Request, context.CancelFunc, bool) {
+	raw := r.Header.Get(requestTimeoutHeader)
+	if raw == "" {
+		return r, func() {}, true
+	}
+	ms, err := strconv.Atoi(raw)
+	if err != nil || ms <= 0 {
+		http.Error(w, "Invalid "+requestTimeoutHeader, http.StatusBadRequest)
+		return nil, nil, false
+	}
+	timeout := time.Duration(ms) * time.Millisecond
+	if s.maxRequestTimeout > 0 && timeout > s.maxRequestTimeout {
+		timeout = s.maxRequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel, true
+}
+
+// callWithDeadline runs fn, giving up once ctx's deadline passes. On false the
+// caller must not touch anything fn writes to: fn may still be running. Only
+// for reads; writes use callWriteWithDeadline so a 504 never hides a write
+// that landed.
+func callWithDeadline(ctx context.Context, fn func()) bool {
+	if _, ok := ctx.Deadline(); !ok {
+		fn()
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func gatewayTimeout(w http.ResponseWriter) {
+	http.Error(w, "Request deadline exceeded", http.StatusGatewayTimeout)
+}
+
+// errWriteAbandoned is returned through the store by a write whose caller gave
+// up waiting before it got to commit
+var errWriteAbandoned = errors.New("write abandoned after deadline")
+
+// Lifecycle of a commitGate
+const (
+	gatePending int32 = iota
+	gateCommitted
+	gateAbandoned
+)
+
+// commitGate settles the race between a write reaching its commit point and
+// its caller's deadline: whichever comes first wins, so a write is either
+// answered with 504 and never applied, or applied and answered normally
+type commitGate struct {
+	state atomic.Int32
+}
+
+// commit claims the write for committing. Writes call it under the store lock
+// right before changing anything, and back out with its error if the caller
+// has already given up.
+func (g *commitGate) commit() error {
+	if g.state.CompareAndSwap(gatePending, gateCommitted) || g.state.Load() == gateCommitted {
+		return nil
+	}
+	return errWriteAbandoned
+}
+
+// callWriteWithDeadline is callWithDeadline for writes. fn must call
+// gate.commit before it changes the store. On false nothing was written, and
+// fn, if still running, will not write; once the write has committed the
+// deadline no longer applies and this waits for fn to return.
+func callWriteWithDeadline(ctx context.Context, fn func(gate *commitGate)) bool {
+	gate := &commitGate{}
+	if _, ok := ctx.Deadline(); !ok {
+		fn(gate)
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	done := make(chan struct{})
+	go func() {
+		fn(gate)
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		if gate.state.CompareAndSwap(gatePending, gateAbandoned) {
+			return false
+		}
+		<-done
+		return true
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// slowStore waits before every write reaches the table, standing in for a
+// write stuck behind a busy segment lock
+type slowStore struct {
+	storage.Store
+	delay time.Duration
+}
+
+func (s slowStore) Update(key string, fn func(storage.DataEntry, bool) (storage.DataEntry, error)) (storage.DataEntry, error) {
+	time.Sleep(s.delay)
+	return s.Store.Update(key, fn)
+}
+
+func (s slowStore) DeleteIf(key string, check func(storage.DataEntry) error) error {
+	time.Sleep(s.delay)
+	return s.Store.DeleteIf(key, check)
+}
+
+func (s slowStore) Apply(ops []storage.TxnOp) error {
+	time.Sleep(s.delay)
+	return s.Store.Apply(ops)
+}
+
+// A write answered with 504 must not land afterwards
+func TestDeadlineAbandonsWrites(t *testing.T) {
+	table := newTestStore()
+	_, ts := newTestServer(t, slowStore{table, 100 * time.Millisecond})
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading, requestTimeoutHeader, "20")
+	wantStatus(t, resp, body, http.StatusGatewayTimeout)
+	resp, body = do(t, ts, http.MethodPost, "/txn",
+		`{"ops":[{"op":"put","key":"EU-A2","entry":`+testReading+`}]}`, requestTimeoutHeader, "20")
+	wantStatus(t, resp, body, http.StatusGatewayTimeout)
+	time.Sleep(200 * time.Millisecond)
+	for _, key := range []string{"EU-A1", "EU-A2"} {
+		if _, err := table.Get(key); err != storage.ErrKeyNotFound {
+			t.Errorf("%s after a 504: %v, want it never written", key, err)
+		}
+	}
+
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodDelete, "/EU-A1", "", requestTimeoutHeader, "20")
+	wantStatus(t, resp, body, http.StatusGatewayTimeout)
+	time.Sleep(200 * time.Millisecond)
+	if _, err := table.Get("EU-A1"); err != nil {
+		t.Errorf("EU-A1 deleted after the DELETE got 504: %v", err)
+	}
+
+	// A budget that covers the delay is met
+	resp, body = do(t, ts, http.MethodDelete, "/EU-A1", "", requestTimeoutHeader, "2000")
+	wantStatus(t, resp, body, http.StatusNoContent)
+}
+
+func TestMaxRequestTimeout(t *testing.T) {
+	_, ts := newTestServer(t, slowStore{newTestStore(), 100 * time.Millisecond}, WithMaxRequestTimeout(20*time.Millisecond))
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading, requestTimeoutHeader, "60000")
+	wantStatus(t, resp, body, http.StatusGatewayTimeout)
+
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading, requestTimeoutHeader, "soon")
+	wantStatus(t, resp, body, http.StatusBadRequest)
+}
+
+func TestCommitGate(t *testing.T) {
+	var g commitGate
+	if err := g.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.commit(); err != nil {
+		t.Errorf("second commit of a committed gate: %v", err)
+	}
+	if g.state.CompareAndSwap(gatePending, gateAbandoned) {
+		t.Error("a committed gate was abandoned")
+	}
+
+	var abandoned commitGate
+	abandoned.state.Store(gateAbandoned)
+	if err := abandoned.commit(); err != errWriteAbandoned {
+		t.Errorf("commit after abandon: %v, want errWriteAbandoned", err)
+	}
+}
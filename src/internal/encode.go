@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Default size of the pooled buffers GET responses are encoded into; a single
+// entry is ~200 bytes so this rarely has to grow
+const defaultEncodeBufferSize = 512
+
+// Default size above which encoded responses are streamed chunked, and how
+// many bytes are written between flushes to the client
+const (
+	defaultStreamThreshold = 64 * 1024
+	streamChunkSize        = 32 * 1024
+)
+
+// Default size of the pooled buffer /export batches NDJSON lines in
+const defaultExportBufferSize = 32 * 1024
+
+// writeJSON encodes v into a buffer borrowed from the PoolManager and writes it
+// with the given status. While the encoding stays under the stream threshold
+// it is held back, so an encode failure can still become a clean 500. Past the
+// threshold the response goes out with chunked transfer encoding and the rest
+// is encoded straight to the client, see streamWriter. With indent set the
+// output is human-readable.
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}, indent bool) {
+	var buf *bytes.Buffer
+	if s.memPool != nil && s.encodeBufferSize > 0 {
+		pooled := s.memPool.GetBuffer(s.encodeBufferSize)
+		// If encoding outgrows the pooled slice, bytes.Buffer moves to its own
+		// allocation and the original slice goes back to the pool untouched
+		defer s.memPool.PutBuffer(pooled)
+		buf = bytes.NewBuffer((*pooled)[:0])
+	} else {
+		buf = new(bytes.Buffer)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	sw := &streamWriter{w: w, status: status, buf: buf, threshold: s.streamThreshold}
+	if err := encodeJSON(sw, v, indent); err != nil {
+		if !sw.streaming {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+		// Too late for a status; the client sees a truncated body
+		s.logger.Warn("response cut short", "err", err)
+		return
+	}
+	sw.finish()
+}
+
+// encodeJSON writes v to w as json.Encoder would. A top-level slice is encoded
+// one element at a time, so a long list never exists whole in memory.
+func encodeJSON(w io.Writer, v interface{}, indent bool) error {
+	rv := reflect.ValueOf(v)
+	_, custom := v.(json.Marshaler)
+	if custom || rv.Kind() != reflect.Slice || rv.IsNil() || rv.Type().Elem().Kind() == reflect.Uint8 {
+		enc := json.NewEncoder(w)
+		if indent {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(v)
+	}
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		var b []byte
+		var err error
+		if indent {
+			b, err = json.MarshalIndent(rv.Index(i).Interface(), "  ", "  ")
+		} else {
+			b, err = json.Marshal(rv.Index(i).Interface())
+		}
+		if err != nil {
+			return err
+		}
+		sep := ","
+		switch {
+		case indent && i == 0:
+			sep = "\n  "
+		case indent:
+			sep = ",\n  "
+		case i == 0:
+			sep = ""
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	end := "]\n"
+	if indent && rv.Len() > 0 {
+		end = "\n]\n"
+	}
+	_, err := io.WriteString(w, end)
+	return err
+}
+
+// streamWriter holds a response in buf until it grows past threshold (never,
+// when threshold is 0), then sends the status and everything so far and
+// passes later writes straight through, flushing every streamChunkSize bytes.
+// Without a Content-Length, net/http frames the response with chunked
+// transfer encoding.
+type streamWriter struct {
+	w         http.ResponseWriter
+	status    int
+	buf       *bytes.Buffer
+	threshold int
+	streaming bool
+	unflushed int
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if !sw.streaming {
+		if sw.threshold <= 0 || sw.buf.Len()+len(p) <= sw.threshold {
+			return sw.buf.Write(p)
+		}
+		sw.streaming = true
+		sw.w.Header().Del("Content-Length")
+		sw.w.WriteHeader(sw.status)
+		if _, err := sw.send(sw.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		sw.buf.Reset()
+	}
+	return sw.send(p)
+}
+
+// send writes p to the client, flushing at each streamChunkSize boundary
+func (sw *streamWriter) send(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n, err := sw.w.Write(p[:min(len(p), streamChunkSize-sw.unflushed)])
+		written += n
+		if err != nil {
+			return written, err // client went away
+		}
+		if sw.unflushed += n; sw.unflushed == streamChunkSize {
+			sw.flush()
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (sw *streamWriter) flush() {
+	if flusher, ok := sw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	sw.unflushed = 0
+}
+
+// finish sends a response that never reached the threshold in one write, or
+// flushes the tail of a streamed one
+func (sw *streamWriter) finish() {
+	if sw.streaming {
+		sw.flush()
+		return
+	}
+	sw.w.WriteHeader(sw.status)
+	sw.w.Write(sw.buf.Bytes())
+}
+
+// acceptsGzip reports whether r's Accept-Encoding lists gzip without q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if q, err := strconv.ParseFloat(v, 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter compresses everything written to it on its way to the client.
+// Content-Length is dropped when the header goes out since it would describe
+// the uncompressed body; Close must be called to flush the gzip trailer.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+// compress sets Content-Encoding: gzip and returns a writer compressing onto w
+func compress(w http.ResponseWriter) *gzipWriter {
+	w.Header().Set("Content-Encoding", "gzip")
+	return &gzipWriter{ResponseWriter: w, gz: gzip.NewWriter(w)}
+}
+
+func (g *gzipWriter) WriteHeader(status int) {
+	g.Header().Del("Content-Length")
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipWriter) Write(p []byte) (int, error) {
+	return g.gz.Write(p)
+}
+
+// Flush pushes what has been compressed so far to the client, so streamed
+// responses still arrive in pieces
+func (g *gzipWriter) Flush() {
+	g.gz.Flush()
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (g *gzipWriter) Close() error {
+	return g.gz.Close()
+}
+
+// exportBuffer borrows a buffer from the PoolManager for /export to encode
+// entries into, and returns it with the fill level at which it should be
+// written out and reset, leaving room for one more entry. It returns nil when
+// pooling is off; release must be called either way.
+func (s *Server) exportBuffer() (buf *bytes.Buffer, flushAt int, release func()) {
+	if s.memPool == nil || s.exportBufferSize <= 0 {
+		return nil, 0, func() {}
+	}
+	pooled := s.memPool.GetBuffer(s.exportBufferSize)
+	flushAt = max(s.exportBufferSize-defaultEncodeBufferSize, s.exportBufferSize/2)
+	return bytes.NewBuffer((*pooled)[:0]), flushAt, func() { s.memPool.PutBuffer(pooled) }
+}
@@ -0,0 +1,274 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// discardWriter is a ResponseWriter that allocates nothing, so benchmarks
+// measure only the encoding path
+type discardWriter struct{ h http.Header }
+
+func (d *discardWriter) Header() http.Header         { return d.h }
+func (d *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discardWriter) WriteHeader(int)             {}
+
+// BenchmarkWriteJSON compares allocations for a single-entry GET response
+// encoded into a pooled buffer and into a fresh one
+func BenchmarkWriteJSON(b *testing.B) {
+	entry := storage.DataEntry{LocationId: "EU-A1", TemperatureC: 21.25, SeismicActivity: 1.5, RadiationLevel: 0.5, ModificationCount: 3}
+	for _, tc := range []struct {
+		name string
+		size int
+	}{
+		{"pooled", defaultEncodeBufferSize},
+		{"unpooled", 0},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			s := CreateServer(newTestStore(), storage.NewPoolManager(), WithEncodeBufferSize(tc.size))
+			w := &discardWriter{h: make(http.Header)}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s.writeJSON(w, http.StatusOK, entry, false)
+			}
+		})
+	}
+}
+
+// BenchmarkExport compares allocations for a 100k-entry /export with lines
+// batched in a pooled buffer and encoded straight to the response
+func BenchmarkExport(b *testing.B) {
+	const n = 100000
+	store := storage.NewSegmentedHashTable(16, 0)
+	for _, entry := range largeList(n) {
+		store.Put(entry.LocationId, entry)
+	}
+	for _, tc := range []struct {
+		name string
+		size int
+	}{
+		{"pooled", defaultExportBufferSize},
+		{"unpooled", 0},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			s := CreateServer(store, storage.NewPoolManager(), WithExportBufferSize(tc.size), WithMaxResults(0))
+			req := httptest.NewRequest(http.MethodGet, "/export", nil)
+			w := &discardWriter{h: make(http.Header)}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s.exportHandler(w, req)
+			}
+		})
+	}
+}
+
+// brokenWriter is a client that went away: every Write fails, and is counted
+type brokenWriter struct {
+	discardWriter
+	writes int
+}
+
+func (w *brokenWriter) Write([]byte) (int, error) {
+	w.writes++
+	return 0, errors.New("broken pipe")
+}
+
+// Once a write to the client fails, the export stops writing, including the
+// final partial buffer
+func TestExportStopsWhenClientGoes(t *testing.T) {
+	store := newTestStore()
+	for _, entry := range largeList(5000) {
+		store.Put(entry.LocationId, entry)
+	}
+	for _, size := range []int{4096, 0} {
+		s := CreateServer(store, storage.NewPoolManager(), WithExportBufferSize(size), WithMaxResults(0))
+		w := &brokenWriter{discardWriter: discardWriter{h: make(http.Header)}}
+		s.exportHandler(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+		if w.writes != 1 {
+			t.Errorf("export buffer %d: %d writes to a gone client, want 1", size, w.writes)
+		}
+	}
+}
+
+// flushCounter records each Write and Flush a response goes out in
+type flushCounter struct {
+	*httptest.ResponseRecorder
+	writes, flushes int
+	maxWrite        int
+	beforeFlush     int // bytes written before the first flush
+}
+
+func (f *flushCounter) Write(p []byte) (int, error) {
+	f.writes++
+	f.maxWrite = max(f.maxWrite, len(p))
+	if f.flushes == 0 {
+		f.beforeFlush += len(p)
+	}
+	return f.ResponseRecorder.Write(p)
+}
+
+func (f *flushCounter) Flush() {
+	f.flushes++
+	f.ResponseRecorder.Flush()
+}
+
+func largeList(n int) []storage.DataEntry {
+	entries := make([]storage.DataEntry, n)
+	for i := range entries {
+		entries[i] = storage.DataEntry{LocationId: fmt.Sprintf("EU-%d", i), TemperatureC: 21.25, ModificationCount: 1}
+	}
+	return entries
+}
+
+// Output is byte for byte what json.Encoder gives, whether it is held back or
+// streamed
+func TestWriteJSONMatchesEncoder(t *testing.T) {
+	values := map[string]interface{}{
+		"entry":      storage.DataEntry{LocationId: "EU-A1"},
+		"map":        map[string]int{"b": 2, "a": 1},
+		"empty list": []storage.DataEntry{},
+		"nil list":   []storage.DataEntry(nil),
+		"bytes":      []byte("raw"),
+		"list":       largeList(3),
+		"large list": largeList(5000),
+	}
+	for name, v := range values {
+		for _, indent := range []bool{false, true} {
+			var want bytes.Buffer
+			enc := json.NewEncoder(&want)
+			if indent {
+				enc.SetIndent("", "  ")
+			}
+			enc.Encode(v)
+
+			s := CreateServer(newTestStore(), storage.NewPoolManager(), WithStreamThreshold(1024))
+			rec := httptest.NewRecorder()
+			s.writeJSON(rec, http.StatusOK, v, indent)
+			if rec.Body.String() != want.String() {
+				t.Errorf("%s (indent %v): got %.200q, want %.200q", name, indent, rec.Body.String(), want.String())
+			}
+		}
+	}
+}
+
+// Past the threshold the response starts reaching the client before it is
+// fully encoded, in flushed pieces no larger than a chunk
+func TestWriteJSONStreams(t *testing.T) {
+	const threshold = 4096
+	s := CreateServer(newTestStore(), storage.NewPoolManager(), WithStreamThreshold(threshold))
+	w := &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+	s.writeJSON(w, http.StatusOK, largeList(5000), false)
+
+	size := w.Body.Len()
+	if w.Code != http.StatusOK || size < 10*streamChunkSize {
+		t.Fatalf("status %d, %d bytes; want a large 200", w.Code, size)
+	}
+	if w.flushes < size/streamChunkSize {
+		t.Errorf("%d flushes for %d bytes, want one every %d bytes", w.flushes, size, streamChunkSize)
+	}
+	if w.maxWrite > streamChunkSize || w.beforeFlush > streamChunkSize {
+		t.Errorf("largest write %d bytes, %d before the first flush; want at most %d", w.maxWrite, w.beforeFlush, streamChunkSize)
+	}
+
+	// Under the threshold it goes out in one write, unflushed
+	w = &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+	s.writeJSON(w, http.StatusOK, largeList(3), false)
+	if w.writes != 1 || w.flushes != 0 {
+		t.Errorf("small response: %d writes, %d flushes, want 1 and 0", w.writes, w.flushes)
+	}
+}
+
+func TestWriteJSONChunkedOverHTTP(t *testing.T) {
+	s := CreateServer(newTestStore(), storage.NewPoolManager(), WithStreamThreshold(4096))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		s.writeJSON(w, http.StatusCreated, largeList(n), false)
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		n       int
+		chunked bool
+	}{{3, false}, {5000, true}} {
+		resp, body := do(t, ts, http.MethodGet, fmt.Sprintf("/?n=%d", tc.n), "")
+		wantStatus(t, resp, body, http.StatusCreated)
+		chunked := len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked"
+		if chunked != tc.chunked || chunked == (resp.ContentLength >= 0) {
+			t.Errorf("%d entries: transfer encoding %v, content length %d; want chunked %v", tc.n, resp.TransferEncoding, resp.ContentLength, tc.chunked)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type %q", ct)
+		}
+		var got []storage.DataEntry
+		decode(t, body, &got)
+		if len(got) != tc.n {
+			t.Errorf("decoded %d entries, want %d", len(got), tc.n)
+		}
+	}
+}
+
+// ?pretty=true indents a GET body, and combines with gzip: the compressed
+// body decompresses to the same indented JSON, and the ETag is the one the
+// plain response carries
+func TestGetPrettyAndGzip(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	// An explicit Accept-Encoding stops the client from decompressing for us
+	plain, compact := do(t, ts, http.MethodGet, "/EU-A1", "", "Accept-Encoding", "identity")
+	wantStatus(t, plain, compact, http.StatusOK)
+	if plain.Header.Get("Content-Encoding") != "" || strings.Count(compact, "\n") != 1 {
+		t.Errorf("default GET: Content-Encoding %q, body %q; want compact and uncompressed", plain.Header.Get("Content-Encoding"), compact)
+	}
+	var want bytes.Buffer
+	json.Indent(&want, []byte(compact), "", "  ")
+
+	for _, tc := range []struct {
+		name, accept string
+		gzipped      bool
+	}{
+		{"identity", "identity", false},
+		{"gzip", "gzip, deflate", true},
+		{"gzip refused", "gzip;q=0", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := do(t, ts, http.MethodGet, "/EU-A1?pretty=true", "", "Accept-Encoding", tc.accept)
+			wantStatus(t, resp, body, http.StatusOK)
+			if got := resp.Header.Get("Content-Encoding") == "gzip"; got != tc.gzipped {
+				t.Fatalf("Content-Encoding %q, want gzip %v", resp.Header.Get("Content-Encoding"), tc.gzipped)
+			}
+			if tc.gzipped {
+				gz, err := gzip.NewReader(strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(gz)
+				if err != nil {
+					t.Fatalf("reading gzip body: %v", err)
+				}
+				body = string(b)
+			}
+			if body != want.String() {
+				t.Errorf("body %q, want %q", body, want.String())
+			}
+			if etag := resp.Header.Get("ETag"); etag == "" || etag != plain.Header.Get("ETag") {
+				t.Errorf("ETag %q, want the plain response's %q", etag, plain.Header.Get("ETag"))
+			}
+			if !strings.Contains(resp.Header.Get("Vary"), "Accept-Encoding") {
+				t.Errorf("Vary = %q, want Accept-Encoding", resp.Header.Get("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package internal_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal"
+)
+
+func ExampleNewTestServer() {
+	ts := internal.NewTestServer()
+	defer ts.Close()
+
+	body := `{"id":"6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e","seismic_activity":1.5,"temperature_c":21.25,"radiation_level":0.5}`
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/EU-A1", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	resp.Body.Close()
+	fmt.Println("PUT", resp.Status)
+
+	resp, err = http.Get(ts.URL + "/EU-A1")
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+	fmt.Println("GET", resp.Status, resp.Header.Get("ETag"))
+	// Output:
+	// PUT 201 Created
+	// GET 200 OK "1"
+}
+
+// Every NewTestServer has its own mux and store, so servers can run side by
+// side and a key written to one is unknown to the other
+func ExampleNewTestServer_independent() {
+	a := internal.NewTestServer()
+	defer a.Close()
+	b := internal.NewTestServer()
+	defer b.Close()
+
+	body := `{"id":"6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e","seismic_activity":1.5,"temperature_c":21.25,"radiation_level":0.5}`
+	req, _ := http.NewRequest(http.MethodPut, a.URL+"/EU-A1", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	resp.Body.Close()
+
+	for _, ts := range []string{a.URL, b.URL} {
+		resp, err := http.Get(ts + "/EU-A1")
+		if err != nil {
+			panic(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		fmt.Println(resp.StatusCode)
+	}
+	// Output:
+	// 200
+	// 404
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// faultConfig drives synthetic PUT failures so clients can exercise their retry
+// and backoff logic. Only reachable when the server is built with WithFaultInjection.
+type faultConfig struct {
+	ErrorPercent   int `json:"error_percent"`   // share of PUTs answered with 507
+	LatencyPercent int `json:"latency_percent"` // share of PUTs delayed by LatencyMs
+	LatencyMs      int `json:"latency_ms"`
+}
+
+type faultInjector struct {
+	cfg atomic.Pointer[faultConfig]
+}
+
+// beforePut applies any configured latency and reports whether the write should
+// be rejected as if the store were full
+func (f *faultInjector) beforePut() bool {
+	cfg := f.cfg.Load()
+	if cfg == nil {
+		return false
+	}
+	if cfg.LatencyMs > 0 && rand.Intn(100) < cfg.LatencyPercent {
+		time.Sleep(time.Duration(cfg.LatencyMs) * time.Millisecond)
+	}
+	return rand.Intn(100) < cfg.ErrorPercent
+}
+
+func (s *Server) faultsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var cfg faultConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, "Invalid fault config", http.StatusBadRequest)
+			return
+		}
+		if cfg.ErrorPercent < 0 || cfg.ErrorPercent > 100 ||
+			cfg.LatencyPercent < 0 || cfg.LatencyPercent > 100 || cfg.LatencyMs < 0 {
+			http.Error(w, "Percentages must be 0-100 and latency non-negative", http.StatusBadRequest)
+			return
+		}
+		s.faults.cfg.Store(&cfg)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	cfg := s.faults.cfg.Load()
+	if cfg == nil {
+		cfg = &faultConfig{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cfg)
+}
@@ -0,0 +1,311 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcStore serves storepb.Store against the same live store as the HTTP API
+type grpcStore struct {
+	storepb.UnimplementedStoreServer
+	s *Server
+}
+
+// GRPCServer returns a gRPC server exposing Get/Put/Delete on this server's
+// store. Calls pass through the same middleware as the HTTP API, and Put and
+// Delete take the same write slots, so loading, API keys and roles, rate
+// limits, the audit log and request logging apply alike.
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.UnaryInterceptor(s.grpcMiddleware))
+	gs := grpc.NewServer(opts...)
+	storepb.RegisterStoreServer(gs, &grpcStore{s: s})
+	return gs
+}
+
+// StartGRPC serves the gRPC API on port until the listener fails or Shutdown is
+// called, in which case it returns nil
+func (s *Server) StartGRPC(port int) error {
+	return s.startGRPC(port)
+}
+
+// StartGRPCTLS is StartGRPC over TLS, configured as StartTLS is. With
+// WithClientCAs, calls without a valid client certificate are refused at the
+// handshake, as they are over HTTPS.
+func (s *Server) StartGRPCTLS(port int, certFile, keyFile string, opts ...TLSOption) error {
+	cfg, err := serverTLSConfig(certFile, keyFile, opts...)
+	if err != nil {
+		return err
+	}
+	return s.startGRPC(port, grpc.Creds(credentials.NewTLS(cfg)))
+}
+
+func (s *Server) startGRPC(port int, opts ...grpc.ServerOption) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	gs := s.GRPCServer(opts...)
+	s.servers.mu.Lock()
+	if s.servers.closed {
+		s.servers.mu.Unlock()
+		lis.Close()
+		return nil
+	}
+	s.servers.grpc = append(s.servers.grpc, gs)
+	s.servers.mu.Unlock()
+
+	// Serve returns nil once GracefulStop or Stop has been called
+	return gs.Serve(lis)
+}
+
+// grpcMethods maps each Store RPC onto the HTTP method of its REST
+// counterpart, so HTTP middleware judges a call as it would that request
+var grpcMethods = map[string]string{
+	storepb.Store_Get_FullMethodName:    http.MethodGet,
+	storepb.Store_Put_FullMethodName:    http.MethodPut,
+	storepb.Store_Delete_FullMethodName: http.MethodDelete,
+}
+
+// grpcRequest describes a call as the equivalent HTTP request on /{key}:
+// metadata become headers, so "authorization: Bearer <key>" and "x-api-key"
+// carry an API key as they do over HTTP
+func grpcRequest(ctx context.Context, req any, fullMethod string) *http.Request {
+	var key string
+	if k, ok := req.(interface{ GetKey() string }); ok {
+		key = k.GetKey()
+	}
+	r := &http.Request{
+		Method:     grpcMethods[fullMethod],
+		URL:        &url.URL{Path: "/" + key, RawPath: "/" + url.PathEscape(key)},
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     make(http.Header),
+		Pattern:    "/",
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for name, values := range md {
+		for _, v := range values {
+			r.Header.Add(name, v)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	return r.WithContext(ctx)
+}
+
+// grpcMiddleware runs each call through wrap as its grpcRequest. The call only
+// proceeds if the middleware passes the request on; otherwise the status it
+// answered with becomes the call's error. The call's outcome is written back as
+// the equivalent HTTP status for logging and auditing.
+func (s *Server) grpcMiddleware(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var resp any
+	var err error
+	called := false
+	rec := &grpcRecorder{header: make(http.Header)}
+	r := grpcRequest(ctx, req, info.FullMethod)
+	s.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		// Stands if the handler panics and recoverPanics answers for it
+		err = status.Error(codes.Internal, "internal server error")
+		resp, err = handler(r.Context(), req)
+		w.WriteHeader(httpStatus(r.Method, err))
+	})).ServeHTTP(rec, r)
+	if !called {
+		return nil, status.Error(grpcCode(rec.status), strings.TrimSpace(rec.body.String()))
+	}
+	return resp, err
+}
+
+// grpcRecorder keeps what middleware answers when it turns a call away
+type grpcRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *grpcRecorder) Header() http.Header { return rec.header }
+
+func (rec *grpcRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+}
+
+func (rec *grpcRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+// grpcCode maps an HTTP status middleware answered with onto a gRPC code
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// httpStatus is the HTTP status a call's outcome corresponds to
+func httpStatus(method string, err error) int {
+	switch status.Code(err) {
+	case codes.OK:
+		switch method {
+		case http.MethodPut:
+			return http.StatusCreated
+		case http.MethodDelete:
+			return http.StatusNoContent
+		}
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func (g *grpcStore) Get(ctx context.Context, req *storepb.GetRequest) (*storepb.GetResponse, error) {
+	store := g.s.table()
+	entry, err := store.Get(store.NormalizeKey(req.GetKey()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &storepb.GetResponse{Entry: toProto(g.s.shown(entry))}, nil
+}
+
+// writeSlot takes one of the write slots HTTP writes share
+func (g *grpcStore) writeSlot() error {
+	if !g.s.tryAcquireWrite() {
+		return status.Error(codes.ResourceExhausted, "too many concurrent writes")
+	}
+	return nil
+}
+
+func (g *grpcStore) Put(ctx context.Context, req *storepb.PutRequest) (*storepb.PutResponse, error) {
+	if err := g.writeSlot(); err != nil {
+		return nil, err
+	}
+	defer g.s.releaseWrite()
+
+	store := g.s.table()
+	key := store.NormalizeKey(req.GetKey())
+	if err := storage.ValidateKey(key); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	in := req.GetEntry()
+	if in == nil {
+		return nil, status.Error(codes.InvalidArgument, "entry required")
+	}
+	if g.s.requireReadings {
+		present := sensorPresence{SeismicActivity: in.SeismicActivity, TemperatureC: in.TemperatureC, RadiationLevel: in.RadiationLevel}
+		if missing := present.missing(); len(missing) > 0 {
+			return nil, status.Error(codes.InvalidArgument, "missing required fields: "+strings.Join(missing, ", "))
+		}
+	}
+	id, err := g.s.parseID(in.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// Declared with x-schema-version metadata, as with the HTTP header
+	schemaVersion, err := parseSchemaVersion(grpcRequest(ctx, req, storepb.Store_Put_FullMethodName))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Same create-or-bump semantics as handlePut, but under one segment lock
+	stored, err := store.Update(key, func(current storage.DataEntry, exists bool) (storage.DataEntry, error) {
+		data := current
+		if exists {
+			data.ModificationCount = g.s.nextVersion(data.ModificationCount)
+		} else {
+			data = storage.DataEntry{Id: id, ModificationCount: 1, LocationId: key}
+		}
+		data.SeismicActivity = in.GetSeismicActivity()
+		data.TemperatureC = in.GetTemperatureC()
+		data.RadiationLevel = in.GetRadiationLevel()
+		data.SchemaVersion = schemaVersion
+		data.ExpiresAt = 0
+		return data, data.Validate()
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &storepb.PutResponse{Entry: toProto(stored)}, nil
+}
+
+func (g *grpcStore) Delete(ctx context.Context, req *storepb.DeleteRequest) (*storepb.DeleteResponse, error) {
+	if err := g.writeSlot(); err != nil {
+		return nil, err
+	}
+	defer g.s.releaseWrite()
+
+	store := g.s.table()
+	if err := store.Delete(store.NormalizeKey(req.GetKey())); err != nil {
+		return nil, grpcError(err)
+	}
+	return &storepb.DeleteResponse{}, nil
+}
+
+// grpcError maps storage errors onto gRPC status codes the way the HTTP API
+// maps them onto status codes
+func grpcError(err error) error {
+	var verr *storage.ValidationError
+	switch {
+	case err == storage.ErrKeyNotFound:
+		return status.Error(codes.NotFound, "location ID not found")
+	case err == storage.ErrInsufficientMemory:
+		return status.Error(codes.ResourceExhausted, "insufficient storage")
+	case err == storage.ErrQuotaExceeded:
+		return status.Error(codes.ResourceExhausted, "region quota exceeded")
+	case errors.As(err, &verr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal server error")
+	}
+}
+
+func toProto(e storage.DataEntry) *storepb.DataEntry {
+	return &storepb.DataEntry{
+		Id:                e.Id.String(),
+		SeismicActivity:   &e.SeismicActivity,
+		TemperatureC:      &e.TemperatureC,
+		RadiationLevel:    &e.RadiationLevel,
+		LocationId:        e.LocationId,
+		ModificationCount: int64(e.ModificationCount),
+	}
+}
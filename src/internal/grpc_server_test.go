@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newGRPCClient serves s's gRPC API in memory and returns a client for it
+func newGRPCClient(t testing.TB, s *Server) storepb.StoreClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := s.GRPCServer()
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return storepb.NewStoreClient(conn)
+}
+
+// withKey attaches metadata pairs to a call context
+func withKey(pairs ...string) context.Context {
+	return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func grpcEntry() *storepb.DataEntry {
+	return &storepb.DataEntry{
+		Id:              "6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e",
+		SeismicActivity: proto.Float32(1.5),
+		TemperatureC:    proto.Float32(21.25),
+		RadiationLevel:  proto.Float32(0.5),
+	}
+}
+
+// gRPC calls need the same API keys as HTTP, passed as metadata
+func TestGRPCRequiresAPIKey(t *testing.T) {
+	keys := []APIKey{{Key: "writer-key", Role: RoleReadWrite}}
+	for _, publicReads := range []bool{true, false} {
+		client := newGRPCClient(t, CreateServer(newTestStore(), nil, WithAPIKeys(keys, publicReads)))
+		put := func(ctx context.Context) error {
+			_, err := client.Put(ctx, &storepb.PutRequest{Key: "EU-A1", Entry: grpcEntry()})
+			return err
+		}
+		get := func(ctx context.Context) error {
+			_, err := client.Get(ctx, &storepb.GetRequest{Key: "EU-A1"})
+			return err
+		}
+		del := func(ctx context.Context) error {
+			_, err := client.Delete(ctx, &storepb.DeleteRequest{Key: "EU-A1"})
+			return err
+		}
+
+		readCode := codes.Unauthenticated
+		if publicReads {
+			readCode = codes.OK
+		}
+		cases := []struct {
+			name string
+			call func(context.Context) error
+			ctx  context.Context
+			want codes.Code
+		}{
+			{"put without a key", put, context.Background(), codes.Unauthenticated},
+			{"put with a wrong key", put, withKey("x-api-key", "guess"), codes.Unauthenticated},
+			{"put with a key", put, withKey("x-api-key", "writer-key"), codes.OK},
+			{"get without a key", get, context.Background(), readCode},
+			{"get with a bearer key", get, withKey("authorization", "Bearer writer-key"), codes.OK},
+			{"delete without a key", del, context.Background(), codes.Unauthenticated},
+			{"delete with a bearer key", del, withKey("authorization", "Bearer writer-key"), codes.OK},
+		}
+		for _, tc := range cases {
+			if got := status.Code(tc.call(tc.ctx)); got != tc.want {
+				t.Errorf("public reads %v, %s: %v, want %v", publicReads, tc.name, got, tc.want)
+			}
+		}
+	}
+}
+
+// A read-only key can Get but not write over gRPC, as over HTTP
+func TestGRPCRoles(t *testing.T) {
+	keys := []APIKey{{Key: "writer-key", Role: RoleReadWrite}, {Key: "reader-key", Role: RoleRead}}
+	client := newGRPCClient(t, CreateServer(newTestStore(), nil, WithAPIKeys(keys, false)))
+	if _, err := client.Put(withKey("x-api-key", "writer-key"), &storepb.PutRequest{Key: "EU-A1", Entry: grpcEntry()}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := withKey("x-api-key", "reader-key")
+	if _, err := client.Get(reader, &storepb.GetRequest{Key: "EU-A1"}); err != nil {
+		t.Errorf("Get with a read key: %v", err)
+	}
+	_, err := client.Put(reader, &storepb.PutRequest{Key: "EU-A1", Entry: grpcEntry()})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Put with a read key: %v, want PermissionDenied", err)
+	}
+	_, err = client.Delete(reader, &storepb.DeleteRequest{Key: "EU-A1"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Delete with a read key: %v, want PermissionDenied", err)
+	}
+}
+
+// The rest of the HTTP middleware and write limits apply to gRPC too
+func TestGRPCSharesMiddleware(t *testing.T) {
+	ctx := context.Background()
+	put := func(client storepb.StoreClient, ctx context.Context, entry *storepb.DataEntry) error {
+		_, err := client.Put(ctx, &storepb.PutRequest{Key: "EU-A1", Entry: entry})
+		return err
+	}
+
+	t.Run("loading", func(t *testing.T) {
+		s := CreateServer(newTestStore(), nil)
+		client := newGRPCClient(t, s)
+		s.SetLoading(true)
+		if _, err := client.Get(ctx, &storepb.GetRequest{Key: "EU-A1"}); status.Code(err) != codes.Unavailable {
+			t.Errorf("Get while loading: %v, want Unavailable", err)
+		}
+	})
+
+	t.Run("write limit", func(t *testing.T) {
+		s := CreateServer(newTestStore(), nil, WithMaxInflightWrites(1))
+		client := newGRPCClient(t, s)
+		s.writeSem <- struct{}{} // one write in flight
+		if err := put(client, ctx, grpcEntry()); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Put with every write slot taken: %v, want ResourceExhausted", err)
+		}
+		if _, err := client.Delete(ctx, &storepb.DeleteRequest{Key: "EU-A1"}); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Delete with every write slot taken: %v, want ResourceExhausted", err)
+		}
+		if _, err := client.Get(ctx, &storepb.GetRequest{Key: "EU-A1"}); status.Code(err) != codes.NotFound {
+			t.Errorf("Get with every write slot taken: %v, want reads unthrottled", err)
+		}
+		<-s.writeSem
+		if err := put(client, ctx, grpcEntry()); err != nil {
+			t.Errorf("Put with a free slot: %v", err)
+		}
+		if n := s.metrics.inflightWrites.Load(); n != 0 {
+			t.Errorf("inflight_writes = %d after every write finished", n)
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		client := newGRPCClient(t, CreateServer(newTestStore(), nil, WithRateLimit(0.001, 2)))
+		for i := 0; i < 2; i++ {
+			if err := put(client, ctx, grpcEntry()); err != nil {
+				t.Fatalf("Put %d within the burst: %v", i, err)
+			}
+		}
+		if err := put(client, ctx, grpcEntry()); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Put past the burst: %v, want ResourceExhausted", err)
+		}
+	})
+
+	t.Run("required readings", func(t *testing.T) {
+		store := newTestStore()
+		client := newGRPCClient(t, CreateServer(store, nil, WithRequiredReadings()))
+		partial := grpcEntry()
+		partial.TemperatureC = nil
+		err := put(client, ctx, partial)
+		if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "temperature_c") {
+			t.Errorf("Put without temperature_c: %v, want InvalidArgument naming it", err)
+		}
+		zero := grpcEntry()
+		zero.TemperatureC = proto.Float32(0)
+		if err := put(client, ctx, zero); err != nil {
+			t.Errorf("Put with a genuine zero reading: %v", err)
+		}
+	})
+
+	t.Run("schema version", func(t *testing.T) {
+		store := newTestStore()
+		client := newGRPCClient(t, CreateServer(store, nil))
+		if err := put(client, ctx, grpcEntry()); err != nil {
+			t.Fatal(err)
+		}
+		if e, _ := store.Get("EU-A1"); e.SchemaVersion != storage.DefaultSchemaVersion {
+			t.Errorf("schema version %d without metadata, want %d", e.SchemaVersion, storage.DefaultSchemaVersion)
+		}
+		if err := put(client, withKey("x-schema-version", "3"), grpcEntry()); err != nil {
+			t.Fatal(err)
+		}
+		if e, _ := store.Get("EU-A1"); e.SchemaVersion != 3 {
+			t.Errorf("schema version %d, want the 3 declared in metadata", e.SchemaVersion)
+		}
+		if err := put(client, withKey("x-schema-version", "zero"), grpcEntry()); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Put with a bad schema version: %v, want InvalidArgument", err)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		keys := []APIKey{{Key: "writer-key", Role: RoleReadWrite}}
+		s := CreateServer(newTestStore(), nil, WithAuditLog(10), WithAPIKeys(keys, true))
+		client := newGRPCClient(t, s)
+		writer := withKey("x-api-key", "writer-key")
+		put(client, writer, grpcEntry())
+		client.Get(writer, &storepb.GetRequest{Key: "EU-A1"})
+		client.Delete(ctx, &storepb.DeleteRequest{Key: "EU-A1"})
+		client.Delete(writer, &storepb.DeleteRequest{Key: "EU-A1"})
+
+		got := s.audit.recent(10)
+		want := []struct {
+			method string
+			status int
+		}{
+			{http.MethodDelete, http.StatusNoContent},
+			{http.MethodDelete, http.StatusUnauthorized},
+			{http.MethodPut, http.StatusCreated},
+		}
+		if len(got) != len(want) {
+			t.Fatalf("audit holds %d entries, want the %d mutations: %+v", len(got), len(want), got)
+		}
+		for i, w := range want {
+			if got[i].Method != w.method || got[i].Status != w.status || got[i].Key != "EU-A1" {
+				t.Errorf("audit entry %d = %+v, want %s EU-A1 %d", i, got[i], w.method, w.status)
+			}
+		}
+	})
+}
+
+// Every write path refuses the keys storage.ValidateKey refuses, and nothing
+// is stored
+func TestWritePathsShareKeyRules(t *testing.T) {
+	store := newTestStore()
+	s, ts := newTestServer(t, store)
+	client := newGRPCClient(t, s)
+
+	for _, key := range []string{strings.Repeat("k", storage.MaxKeyLength+1), "EU A1"} {
+		resp, body := do(t, ts, http.MethodPut, "/"+url.PathEscape(key), testReading)
+		wantStatus(t, resp, body, http.StatusBadRequest)
+
+		resp, body = do(t, ts, http.MethodPost, "/txn", fmt.Sprintf(`{"ops":[{"op":"put","key":%q,"entry":%s}]}`, key, testReading))
+		wantStatus(t, resp, body, http.StatusBadRequest)
+
+		resp, body = do(t, ts, http.MethodPost, "/batch", fmt.Sprintf(`{"ops":[{"op":"put","key":%q,"entry":%s}]}`, key, testReading))
+		wantStatus(t, resp, body, http.StatusOK)
+		var batch batchResponse
+		decode(t, body, &batch)
+		if batch.Results[0].Code != codeInvalidKey {
+			t.Errorf("/batch code %q for key %.10q, want %s", batch.Results[0].Code, key, codeInvalidKey)
+		}
+
+		resp, body = do(t, ts, http.MethodPost, "/import", importLine(key))
+		wantStatus(t, resp, body, http.StatusBadRequest)
+
+		_, err := client.Put(context.Background(), &storepb.PutRequest{Key: key, Entry: grpcEntry()})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("gRPC Put of key %.10q: got %v, want InvalidArgument", key, err)
+		}
+	}
+	if n := store.Count(); n != 0 {
+		t.Errorf("%d entries stored from invalid keys", n)
+	}
+}
+
+// A PutRequest without an entry is refused rather than dereferenced, whether
+// or not readings are required
+func TestGRPCPutWithoutEntry(t *testing.T) {
+	for _, opts := range [][]ServerOption{nil, {WithRequiredReadings()}} {
+		store := newTestStore()
+		client := newGRPCClient(t, CreateServer(store, nil, opts...))
+		_, err := client.Put(context.Background(), &storepb.PutRequest{Key: "EU-A1"})
+		if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "entry required") {
+			t.Errorf("Put without an entry (%d options): got %v, want InvalidArgument entry required", len(opts), err)
+		}
+		if store.Count() != 0 {
+			t.Errorf("Put without an entry stored %d entries", store.Count())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// A well-formed reading body for PUT /{key}
+const testReading = `{"id":"6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e","seismic_activity":1.5,"temperature_c":21.25,"radiation_level":0.5}`
+
+// newTestStore is the store newTestServer uses when none is given
+func newTestStore(opts ...storage.TableOption) *storage.SegmentedHashTable {
+	return storage.NewSegmentedHashTable(16, testStoreSize, opts...)
+}
+
+// newTestServer serves a fresh Server over store, closing it when the test ends
+func newTestServer(t testing.TB, store storage.Store, opts ...ServerOption) (*Server, *httptest.Server) {
+	t.Helper()
+	s := CreateServer(store, storage.NewPoolManager(), opts...)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// do sends a request with optional header name/value pairs and returns the
+// response with its body already read
+func do(t testing.TB, ts *httptest.Server, method, path, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// wantStatus fails the test unless resp has the given status
+func wantStatus(t testing.TB, resp *http.Response, body string, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		t.Fatalf("%s %s: status %d, want %d (body %q)", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, want, body)
+	}
+}
+
+// decode unmarshals a JSON response body into v
+func decode(t testing.TB, body string, v any) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		t.Fatalf("decoding %q: %v", body, err)
+	}
+}
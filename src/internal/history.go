@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// historyPoint is one retained reading; unlike a plain GET it exposes when the
+// reading was written since that's the whole point of a series
+type historyPoint struct {
+	storage.DataEntry
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func toHistoryPoints(entries []storage.DataEntry) []historyPoint {
+	points := make([]historyPoint, len(entries))
+	for i, e := range entries {
+		points[i] = historyPoint{DataEntry: e, UpdatedAt: time.Unix(0, e.LastUpdated).UTC()}
+	}
+	return points
+}
+
+// Range unit for paging through a series, e.g. "Range: readings=0-99"
+const readingsUnit = "readings"
+
+// parseReadingsRange resolves a single "readings=first-last", "readings=first-"
+// or "readings=-suffix" range against a series of n readings, returning the
+// half-open window [start, end). ok is false when the range is malformed or
+// unsatisfiable.
+func parseReadingsRange(header string, n int) (start, end int, ok bool) {
+	spec, found := strings.CutPrefix(header, readingsUnit+"=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+	if first == "" {
+		suffix, err := strconv.Atoi(last)
+		if err != nil || suffix <= 0 || n == 0 {
+			return 0, 0, false
+		}
+		return max(n-suffix, 0), n, true
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 || start >= n {
+		return 0, 0, false
+	}
+	end = n
+	if last != "" {
+		l, err := strconv.Atoi(last)
+		if err != nil || l < start {
+			return 0, 0, false
+		}
+		// Compared before adding 1, which would overflow for l = MaxInt
+		if l < n-1 {
+			end = l + 1
+		}
+	}
+	return start, end, true
+}
+
+// handleHistory serves GET /{key}/history, oldest reading first. A Range header
+// in the readings unit returns just that window as 206 Partial Content; other
+// units are ignored and the whole series is sent. A series or window longer
+// than maxResults is cut to 206 with X-Truncated, and X-Next-Cursor is the
+// index of the first reading left out.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request, locationID string) {
+	store := s.table()
+	if !store.HistoryEnabled() {
+		http.Error(w, "History is not enabled", http.StatusNotFound)
+		return
+	}
+
+	entries, err := store.History(locationID)
+	if err != nil {
+		if err == storage.ErrKeyNotFound {
+			http.Error(w, "Location ID not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Accept-Ranges", readingsUnit)
+	status := http.StatusOK
+	start, end := 0, len(entries)
+	if header := r.Header.Get("Range"); strings.HasPrefix(header, readingsUnit+"=") {
+		var ok bool
+		if start, end, ok = parseReadingsRange(header, len(entries)); !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("%s */%d", readingsUnit, len(entries)))
+			http.Error(w, "Range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		status = http.StatusPartialContent
+	}
+	// Past maxResults the window is cut short; the next range starts at the cursor
+	if s.maxResults > 0 && end-start > s.maxResults {
+		end = start + s.maxResults
+		markTruncated(w, strconv.Itoa(end))
+		status = http.StatusPartialContent
+	}
+	if status == http.StatusPartialContent {
+		w.Header().Set("Content-Range", fmt.Sprintf("%s %d-%d/%d", readingsUnit, start, end-1, len(entries)))
+		entries = entries[start:end]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(toHistoryPoints(s.shownAll(entries)))
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+func TestParseReadingsRange(t *testing.T) {
+	maxInt := fmt.Sprint(math.MaxInt)
+	cases := []struct {
+		header     string
+		n          int
+		start, end int
+		ok         bool
+	}{
+		{"readings=0-9", 20, 0, 10, true},
+		{"readings=5-", 20, 5, 20, true},
+		{"readings=-5", 20, 15, 20, true},
+		{"readings=-50", 20, 0, 20, true},
+		{"readings=10-99", 20, 10, 20, true},
+		{"readings=19-19", 20, 19, 20, true},
+		{"readings=0-" + maxInt, 20, 0, 20, true},
+		{"readings=" + maxInt + "-" + maxInt, 20, 0, 0, false},
+		{"readings=-" + maxInt, 20, 0, 20, true},
+		{"readings=20-", 20, 0, 0, false},
+		{"readings=5-4", 20, 0, 0, false},
+		{"readings=-0", 20, 0, 0, false},
+		{"readings=-5", 0, 0, 0, false},
+		{"readings=0-1,3-4", 20, 0, 0, false},
+		{"readings=a-b", 20, 0, 0, false},
+		{"bytes=0-9", 20, 0, 0, false},
+	}
+	for _, tc := range cases {
+		start, end, ok := parseReadingsRange(tc.header, tc.n)
+		if ok != tc.ok || ok && (start != tc.start || end != tc.end) {
+			t.Errorf("parseReadingsRange(%q, %d) = %d, %d, %v; want %d, %d, %v",
+				tc.header, tc.n, start, end, ok, tc.start, tc.end, tc.ok)
+		}
+	}
+}
+
+func TestHistoryRange(t *testing.T) {
+	store := newTestStore(storage.WithHistory(10))
+	for i := 0; i < 5; i++ {
+		putKeys(t, store, "EU-A1")
+	}
+	_, ts := newTestServer(t, store)
+
+	resp, body := do(t, ts, http.MethodGet, "/EU-A1/history", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	if resp.Header.Get("Accept-Ranges") != "readings" {
+		t.Errorf("Accept-Ranges = %q, want readings", resp.Header.Get("Accept-Ranges"))
+	}
+
+	var points []historyPoint
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1/history", "", "Range", "readings=1-2")
+	wantStatus(t, resp, body, http.StatusPartialContent)
+	decode(t, body, &points)
+	if len(points) != 2 || resp.Header.Get("Content-Range") != "readings 1-2/5" {
+		t.Errorf("got %d readings with Content-Range %q, want 2 and readings 1-2/5", len(points), resp.Header.Get("Content-Range"))
+	}
+
+	// An end past the series, even MaxInt, is clamped rather than overflowing
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1/history", "", "Range", fmt.Sprintf("readings=0-%d", math.MaxInt))
+	wantStatus(t, resp, body, http.StatusPartialContent)
+	if got := resp.Header.Get("Content-Range"); got != "readings 0-4/5" {
+		t.Errorf("Content-Range = %q, want readings 0-4/5", got)
+	}
+
+	for _, header := range []string{"readings=5-", "readings=3-1", fmt.Sprintf("readings=%d-", math.MaxInt)} {
+		resp, body = do(t, ts, http.MethodGet, "/EU-A1/history", "", "Range", header)
+		wantStatus(t, resp, body, http.StatusRequestedRangeNotSatisfiable)
+		if got := resp.Header.Get("Content-Range"); got != "readings */5" {
+			t.Errorf("Range %s: Content-Range = %q, want readings */5", header, got)
+		}
+	}
+
+	// Other units are ignored
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1/history", "", "Range", "bytes=0-10")
+	wantStatus(t, resp, body, http.StatusOK)
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// Longest NDJSON line accepted by /import
+const maxImportLineBytes = 1024 * 1024
+
+// Most skipped lines itemized in one ?on_error=skip import report; beyond this
+// they are only counted
+const maxImportSkipReport = 1000
+
+// Valid lines written to the store per PutBatch call
+const importBatchSize = 500
+
+type importResult struct {
+	Imported     int            `json:"imported"`
+	Skipped      int            `json:"skipped,omitempty"`
+	SkippedLines []recordStatus `json:"skipped_lines,omitempty"` // bad lines passed over, indexed by line
+	Error        string         `json:"error,omitempty"`
+	Failure      *recordStatus  `json:"failure,omitempty"` // the record that stopped the import, indexed by line
+}
+
+// importHandler restores entries from an NDJSON body in the /export format,
+// optionally gzip-compressed (Content-Encoding: gzip). The body is streamed line
+// by line so memory stays flat.
+//
+// With ?on_error=abort, the default, the first bad line stops the import and is
+// reported; the records before it stay imported. With ?on_error=skip, lines
+// that are malformed or fail validation are listed in the report and the import
+// carries on. Store rejections (full, over quota) abort either way since the
+// lines after them would fail too. Valid lines are written in batches of
+// importBatchSize, so when a store rejection stops the import, later records
+// from the same batch that did fit are written and counted as imported.
+func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var skip bool
+	switch r.URL.Query().Get("on_error") {
+	case "", "abort":
+	case "skip":
+		skip = true
+	default:
+		http.Error(w, "on_error must be skip or abort", http.StatusBadRequest)
+		return
+	}
+	if !s.acquireWrite(w) {
+		return
+	}
+	defer s.releaseWrite()
+
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid gzip stream", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	store := s.table()
+	var result importResult
+	status := http.StatusOK
+
+	// pending holds valid lines not yet written, with their reports in
+	// pendingLines for when the store rejects one
+	var pending []storage.BatchRecord
+	var pendingLines []recordStatus
+	flush := func() *recordStatus {
+		var rejected *recordStatus
+		for j, err := range store.PutBatch(pending) {
+			if err == nil {
+				result.Imported++
+			} else if rejected == nil {
+				failure := pendingLines[j]
+				failure.failure(err)
+				rejected = &failure
+			}
+		}
+		pending, pendingLines = pending[:0], pendingLines[:0]
+		return rejected
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+	line := 0
+	var stop *recordStatus
+	for stop == nil && scanner.Scan() {
+		line++
+		raw := scanner.Bytes()
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+
+		var entry storage.DataEntry
+		failure := recordStatus{Index: line}
+		err := json.Unmarshal(raw, &entry)
+		if err == nil {
+			// Keys get the same normalization as PUT /{key} and /batch
+			entry.LocationId = store.NormalizeKey(entry.LocationId)
+			failure.Key = entry.LocationId
+		}
+		if err != nil {
+			failure.Status, failure.Code, failure.Error = http.StatusBadRequest, codeInvalidJSON, fmt.Sprintf("invalid JSON: %v", err)
+		} else if err := storage.ValidateKey(entry.LocationId); err != nil {
+			failure.Status, failure.Code, failure.Error = http.StatusBadRequest, codeInvalidKey, err.Error()
+		} else if err := entry.Validate(); err != nil {
+			failure.failure(err)
+		} else if s.rejectNilUUID && entry.Id == uuid.Nil {
+			failure.Status, failure.Code, failure.Error = http.StatusBadRequest, codeValidationFailed, errNilUUID.Error()
+		}
+		if failure.Code == "" {
+			pending = append(pending, storage.BatchRecord{Key: entry.LocationId, Entry: entry})
+			pendingLines = append(pendingLines, failure)
+			if len(pending) == importBatchSize {
+				stop = flush()
+			}
+			continue
+		}
+		if skip && failure.Status == http.StatusBadRequest {
+			result.Skipped++
+			if len(result.SkippedLines) < maxImportSkipReport {
+				result.SkippedLines = append(result.SkippedLines, failure)
+			}
+			continue
+		}
+		// The lines before this one are imported before it is reported, and a
+		// rejection among them is what stops the import instead
+		if stop = flush(); stop == nil {
+			stop = &failure
+		}
+	}
+	if stop == nil {
+		stop = flush()
+	}
+	if stop != nil {
+		result.Error = fmt.Sprintf("line %d: %s", stop.Index, stop.Error)
+		result.Failure = stop
+		status = stop.Status
+	}
+	if err := scanner.Err(); err != nil {
+		// Typically a truncated gzip stream (unexpected EOF) or an oversized line.
+		// This takes precedence since it explains any garbled final line.
+		result.Error = fmt.Sprintf("stream error after line %d: %v", line, err)
+		status = http.StatusBadRequest
+	}
+
+	s.writeJSON(w, status, result, false)
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// importLine is one /export-format NDJSON record for key
+func importLine(key string) string {
+	return fmt.Sprintf(`{"id":"6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e","seismic_activity":1.5,"temperature_c":21.25,"radiation_level":0.5,"location_id":%q,"modification_count":4}`+"\n", key)
+}
+
+func gzipped(t testing.TB, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestImportGzip(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store)
+
+	var lines strings.Builder
+	for i := 0; i < 100; i++ {
+		lines.WriteString(importLine(fmt.Sprintf("EU-%d", i)))
+	}
+	compressed := gzipped(t, lines.String())
+
+	resp, body := do(t, ts, http.MethodPost, "/import", compressed, "Content-Encoding", "gzip")
+	wantStatus(t, resp, body, http.StatusOK)
+	var result importResult
+	decode(t, body, &result)
+	if result.Imported != 100 || store.Count() != 100 {
+		t.Errorf("imported %d, store holds %d, want 100", result.Imported, store.Count())
+	}
+
+	_, ts = newTestServer(t, newTestStore())
+	resp, body = do(t, ts, http.MethodPost, "/import", compressed[:len(compressed)/2], "Content-Encoding", "gzip")
+	wantStatus(t, resp, body, http.StatusBadRequest)
+	result = importResult{}
+	decode(t, body, &result)
+	if !strings.Contains(result.Error, "unexpected EOF") {
+		t.Errorf("error = %q, want it to name the truncated stream", result.Error)
+	}
+	if result.Imported == 0 || result.Imported >= 100 {
+		t.Errorf("imported %d before the stream broke off, want some but not all", result.Imported)
+	}
+}
+
+// Imported keys get the same normalization and validation as PUT /{key}
+func TestImportNormalizesKeys(t *testing.T) {
+	store := newTestStore(storage.WithKeyCase(storage.KeyCaseUpper))
+	_, ts := newTestServer(t, store)
+
+	resp, body := do(t, ts, http.MethodPost, "/import?on_error=skip",
+		importLine("eu-a1")+importLine("EU-A1")+importLine("bad key")+importLine(""))
+	wantStatus(t, resp, body, http.StatusOK)
+	var result importResult
+	decode(t, body, &result)
+	if result.Imported != 2 || result.Skipped != 2 {
+		t.Errorf("imported %d, skipped %d, want 2 and 2", result.Imported, result.Skipped)
+	}
+	for _, rs := range result.SkippedLines {
+		if rs.Code != codeInvalidKey {
+			t.Errorf("line %d skipped with %s, want %s", rs.Index, rs.Code, codeInvalidKey)
+		}
+	}
+
+	if store.Count() != 1 {
+		t.Errorf("store holds %d entries, want eu-a1 and EU-A1 folded into one", store.Count())
+	}
+	entry, err := store.Get("EU-A1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.LocationId != "EU-A1" {
+		t.Errorf("stored location_id = %q, want the normalized EU-A1", entry.LocationId)
+	}
+}
+
+// A malformed line in the middle stops the import by default and is passed
+// over with ?on_error=skip; either way it is reported by line number
+func TestImportOnError(t *testing.T) {
+	body := importLine("EU-1") + "\n" + importLine("EU-2") + "{not json\n" + importLine("EU-3")
+	cases := []struct {
+		query    string
+		status   int
+		imported int
+	}{
+		{"", http.StatusBadRequest, 2},
+		{"?on_error=abort", http.StatusBadRequest, 2},
+		{"?on_error=skip", http.StatusOK, 3},
+	}
+	for _, tc := range cases {
+		t.Run("on_error="+strings.TrimPrefix(tc.query, "?on_error="), func(t *testing.T) {
+			store := newTestStore()
+			_, ts := newTestServer(t, store)
+			resp, got := do(t, ts, http.MethodPost, "/import"+tc.query, body)
+			wantStatus(t, resp, got, tc.status)
+			var result importResult
+			decode(t, got, &result)
+			if result.Imported != tc.imported || store.Count() != tc.imported {
+				t.Errorf("imported %d, store holds %d, want %d", result.Imported, store.Count(), tc.imported)
+			}
+
+			var bad *recordStatus
+			if tc.status == http.StatusOK {
+				if result.Skipped != 1 || len(result.SkippedLines) != 1 || result.Failure != nil {
+					t.Fatalf("skip report = %+v, want the one bad line skipped", result)
+				}
+				bad = &result.SkippedLines[0]
+			} else {
+				if result.Skipped != 0 || result.Failure == nil || !strings.HasPrefix(result.Error, "line 4:") {
+					t.Fatalf("abort report = %+v, want it stopped at line 4", result)
+				}
+				bad = result.Failure
+				if _, err := store.Get("EU-3"); err == nil {
+					t.Error("EU-3 after the bad line was imported")
+				}
+			}
+			// Line 2 is blank and still counted
+			if bad.Index != 4 || bad.Code != codeInvalidJSON {
+				t.Errorf("bad line reported as %+v, want line 4 with %s", *bad, codeInvalidJSON)
+			}
+		})
+	}
+
+	_, ts := newTestServer(t, newTestStore())
+	resp, got := do(t, ts, http.MethodPost, "/import?on_error=ignore", body)
+	wantStatus(t, resp, got, http.StatusBadRequest)
+}
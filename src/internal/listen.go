@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// httpServers tracks every http.Server started by Start, StartUnix, StartTLS or
+// StartAdmin, and every gRPC server started by StartGRPC, so Shutdown can stop
+// them all
+type httpServers struct {
+	mu     sync.Mutex
+	list   []*http.Server
+	grpc   []*grpc.Server
+	closed bool          // Shutdown has run; listeners starting later return at once
+	done   chan struct{} // closed by Shutdown, see stopping
+}
+
+// stopping is closed once Shutdown starts. Handlers that stream for as long as
+// the client stays (/changes, /ws) select on it, since Shutdown only waits for
+// requests and would otherwise wait out its whole deadline.
+func (h *httpServers) stopping() <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done == nil {
+		h.done = make(chan struct{})
+	}
+	return h.done
+}
+
+func (s *Server) Start(port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	return s.serve(l, s.Handler())
+}
+
+// StartAdmin serves AdminHandler on its own port, so metrics and admin routes
+// can stay off the network the data API is exposed to. Pair it with
+// WithSeparateAdmin so the data listeners stop serving them.
+func (s *Server) StartAdmin(port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	return s.serve(l, s.AdminHandler())
+}
+
+// StartUnix serves the API on a Unix domain socket, e.g. for a co-located
+// sidecar. A stale socket left behind by a crash is replaced; the socket file
+// is removed again when the server shuts down.
+func (s *Server) StartUnix(socketPath string) error {
+	if fi, err := os.Stat(socketPath); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(socketPath)
+	}
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	// Closing a listener created by net.Listen unlinks its socket file
+	return s.serve(l, s.Handler())
+}
+
+// serve runs h on l until it fails or Shutdown is called, in which case it
+// returns nil
+func (s *Server) serve(l net.Listener, h http.Handler) error {
+	srv := &http.Server{Handler: h}
+	s.servers.mu.Lock()
+	if s.servers.closed {
+		s.servers.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.servers.list = append(s.servers.list, srv)
+	s.servers.mu.Unlock()
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown gracefully stops every HTTP and gRPC listener, admin included,
+// waiting for in-flight requests until ctx is done; whatever is still running
+// then is cut off. Open /changes and /ws streams are ended first. Listeners
+// started after Shutdown return straight away.
+// Once it returns no request is still using the store, so it can be closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.servers.mu.Lock()
+	if !s.servers.closed {
+		if s.servers.done == nil {
+			s.servers.done = make(chan struct{})
+		}
+		close(s.servers.done)
+	}
+	s.servers.closed = true
+	list, grpcList := s.servers.list, s.servers.grpc
+	s.servers.mu.Unlock()
+
+	var errs []error
+	for _, srv := range list {
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+			errs = append(errs, err)
+		}
+	}
+	for _, gs := range grpcList {
+		stopped := make(chan struct{})
+		go func() {
+			gs.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			gs.Stop()
+			errs = append(errs, ctx.Err())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// unixClient talks HTTP over the Unix socket at path
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// Shutdown must not return while a request is still writing to the store, or
+// closing the store afterwards would lose that write
+func TestShutdownWaitsForInflightRequests(t *testing.T) {
+	table := newTestStore()
+	s := CreateServer(slowStore{table, 200 * time.Millisecond}, storage.NewPoolManager())
+	sock := filepath.Join(t.TempDir(), "hub.sock")
+	served := make(chan error, 2)
+	go func() { served <- s.StartUnix(sock) }()
+	go func() { served <- s.StartGRPC(0) }()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.servers.mu.Lock()
+		up := len(s.servers.list) == 1 && len(s.servers.grpc) == 1
+		s.servers.mu.Unlock()
+		if up {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("listeners never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	client := unixClient(sock)
+	status := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPut, "http://hub/EU-A1", strings.NewReader(testReading))
+		resp, err := client.Do(req)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	time.Sleep(50 * time.Millisecond) // the PUT is now waiting on the slow store
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := table.Get("EU-A1"); err != nil {
+		t.Errorf("Shutdown returned before the in-flight PUT was stored: %v", err)
+	}
+	if code := <-status; code != http.StatusCreated {
+		t.Errorf("in-flight PUT answered %d, want 201", code)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-served:
+			if err != nil {
+				t.Errorf("listener returned %v after Shutdown, want nil", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("a listener kept serving after Shutdown")
+		}
+	}
+}
+
+// A listener whose goroutine only gets going after Shutdown must not serve on
+func TestShutdownBeforeListenerStarts(t *testing.T) {
+	s := CreateServer(newTestStore(), storage.NewPoolManager())
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 2)
+	go func() { done <- s.StartUnix(filepath.Join(t.TempDir(), "hub.sock")) }()
+	go func() { done <- s.StartGRPC(0) }()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("listener started after Shutdown returned %v, want nil", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("listener started after Shutdown kept serving")
+		}
+	}
+}
+
+// With a separate admin listener, admin routes answer only there, both
+// listeners share the store, and Shutdown stops both
+func TestSeparateAdminListener(t *testing.T) {
+	s := CreateServer(newTestStore(), storage.NewPoolManager(), WithSeparateAdmin())
+	dataPort, adminPort := freePort(t), freePort(t)
+	served := make(chan error, 2)
+	go func() { served <- s.Start(dataPort) }()
+	go func() { served <- s.StartAdmin(adminPort) }()
+	for _, port := range []int{dataPort, adminPort} {
+		deadline := time.Now().Add(time.Second)
+		for {
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err == nil {
+				conn.Close()
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("nothing listening on %d: %v", port, err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	request := func(method string, port int, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%d%s", port, path), strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s on %d: %v", method, path, port, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := request(http.MethodPut, dataPort, "/EU-A1", testReading); code != http.StatusCreated {
+		t.Fatalf("PUT on the data port: %d, want 201", code)
+	}
+	adminRoutes := []struct{ method, path string }{
+		{http.MethodGet, "/metrics"},
+		{http.MethodGet, "/admin/verify-size"},
+		{http.MethodDelete, "/admin/purge?older_than=24h"},
+		{http.MethodGet, "/debug/pprof/"},
+	}
+	for _, route := range adminRoutes {
+		if code := request(route.method, dataPort, route.path, ""); code != http.StatusNotFound {
+			t.Errorf("%s %s on the data port: %d, want 404", route.method, route.path, code)
+		}
+		if code := request(route.method, adminPort, route.path, ""); code != http.StatusOK {
+			t.Errorf("%s %s on the admin port: %d, want 200", route.method, route.path, code)
+		}
+	}
+	// The admin listener sees what the data listener wrote
+	if code := request(http.MethodDelete, adminPort, "/admin/clear", ""); code != http.StatusOK {
+		t.Errorf("DELETE /admin/clear on the admin port: %d, want 200", code)
+	}
+	if code := request(http.MethodGet, dataPort, "/EU-A1", ""); code != http.StatusNotFound {
+		t.Errorf("GET after clearing through the admin port: %d, want 404", code)
+	}
+	if code := request(http.MethodGet, adminPort, "/EU-A1", ""); code != http.StatusNotFound {
+		t.Errorf("data route on the admin port: %d, want 404", code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-served:
+			if err != nil {
+				t.Errorf("listener returned %v after Shutdown, want nil", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("a listener kept serving after Shutdown")
+		}
+	}
+}
+
+// Open /changes and /ws streams end when Shutdown starts, so it returns
+// promptly and cleanly instead of waiting out its deadline
+func TestShutdownEndsStreams(t *testing.T) {
+	s := CreateServer(newTestStore(), storage.NewPoolManager())
+	port := freePort(t)
+	startListener(t, s, port, func() error { return s.Start(port) })
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	resp, err := http.Get("http://" + addr + "/changes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ws := dialWS(t, addr, "/ws")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown with open streams: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v with open streams", elapsed)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("/changes stream didn't end cleanly: %v", err)
+	}
+	if op, payload := ws.read(t); op != wsOpClose || len(payload) != 2 || binary.BigEndian.Uint16(payload) != 1001 {
+		t.Errorf("/ws got frame %x %v, want a 1001 close", op, payload)
+	}
+}
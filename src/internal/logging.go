@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewLogger builds a text slog logger writing to stderr at the named level
+// (debug, info, warn or error)
+func NewLogger(level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: lvl})), nil
+}
+
+// statusRecorder captures the response status while still exposing the
+// streaming interfaces the SSE and WebSocket handlers rely on
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+// RouteLogLevel sets how successful requests to one route are logged. Failures
+// are always logged regardless.
+type RouteLogLevel int
+
+const (
+	RouteLogSampled RouteLogLevel = iota // one in logSampleN, the default
+	RouteLogQuiet                        // never
+	RouteLogVerbose                      // always, with the query string and handler details
+)
+
+// Route logging defaults: the key hot path stays silent while the expensive
+// scans are worth a line each. Keys are ServeMux patterns.
+var defaultRouteLogging = map[string]RouteLogLevel{
+	"/":           RouteLogQuiet,
+	"/range":      RouteLogVerbose,
+	"/prefix/":    RouteLogVerbose,
+	"/export":     RouteLogVerbose,
+	"/export.csv": RouteLogVerbose,
+}
+
+// ParseRouteLogging parses "pattern=level,..." (levels: sampled, quiet, verbose),
+// e.g. "/=quiet,/range=verbose"
+func ParseRouteLogging(spec string) (map[string]RouteLogLevel, error) {
+	levels := make(map[string]RouteLogLevel)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, name, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("route logging %q: want pattern=level", part)
+		}
+		switch name {
+		case "sampled":
+			levels[pattern] = RouteLogSampled
+		case "quiet":
+			levels[pattern] = RouteLogQuiet
+		case "verbose":
+			levels[pattern] = RouteLogVerbose
+		default:
+			return nil, fmt.Errorf("route logging %q: unknown level %q", part, name)
+		}
+	}
+	return levels, nil
+}
+
+type logDetailsKey struct{}
+
+// logDetails collects handler-supplied attributes for a verbose request log line
+type logDetails struct {
+	mu    sync.Mutex
+	attrs []any
+}
+
+// logDetail attaches key/value pairs (e.g. a result count) to the request's log
+// line. They only appear for routes logged verbosely.
+func logDetail(r *http.Request, args ...any) {
+	if d, ok := r.Context().Value(logDetailsKey{}).(*logDetails); ok {
+		d.mu.Lock()
+		d.attrs = append(d.attrs, args...)
+		d.mu.Unlock()
+	}
+}
+
+// logRequests logs failed requests (status >= 400) at warn/error level every time,
+// as well as successful ones slower than the slow-request threshold, which log at
+// warn whatever their route's level. Other successful requests follow their
+// route's RouteLogLevel: sampled routes log one in logSampleN at info to keep
+// hot-path noise down.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	var seen atomic.Uint64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		details := &logDetails{}
+		r = r.WithContext(context.WithValue(r.Context(), logDetailsKey{}, details))
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		elapsed := time.Since(start)
+		// ServeMux records the matched pattern on the request it was handed
+		level := s.routeLogging[r.Pattern]
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"duration", elapsed,
+		}
+		if cn := clientCN(r); cn != "" {
+			attrs = append(attrs, "client_cn", cn)
+		}
+		if level == RouteLogVerbose {
+			details.mu.Lock()
+			attrs = append(attrs, "query", r.URL.RawQuery)
+			attrs = append(attrs, details.attrs...)
+			details.mu.Unlock()
+		}
+		switch {
+		case status >= 500:
+			s.logger.Error("request failed", attrs...)
+		case status >= 400:
+			s.logger.Warn("request rejected", attrs...)
+		case s.slowRequest > 0 && elapsed >= s.slowRequest:
+			s.logger.Warn("slow request", attrs...)
+		case level == RouteLogQuiet:
+		case level == RouteLogVerbose || s.logSampleN <= 1 || seen.Add(1)%uint64(s.logSampleN) == 0:
+			s.logger.Info("request", attrs...)
+		}
+	})
+}
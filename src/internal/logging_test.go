@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logBuffer collects log output written from server goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+}
+
+// A slow write is logged at warn on the key route, which is otherwise quiet,
+// while fast requests there stay unlogged
+func TestSlowRequestLog(t *testing.T) {
+	var logged logBuffer
+	logger := slog.New(slog.NewTextHandler(&logged, nil))
+	_, ts := newTestServer(t, slowStore{newTestStore(), 50 * time.Millisecond},
+		WithLogger(logger, 1000000), WithSlowRequestLog(20*time.Millisecond))
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodGet, "/ping", "")
+	wantStatus(t, resp, body, http.StatusOK)
+
+	lines := logged.lines()
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want only the slow PUT: %q", len(lines), lines)
+	}
+	for _, want := range []string{"level=WARN", `msg="slow request"`, "method=PUT", "path=/EU-A1", "duration="} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("slow request line %q lacks %s", lines[0], want)
+		}
+	}
+}
+
+func TestSlowRequestLogOff(t *testing.T) {
+	var logged logBuffer
+	logger := slog.New(slog.NewTextHandler(&logged, nil))
+	_, ts := newTestServer(t, slowStore{newTestStore(), 50 * time.Millisecond}, WithLogger(logger, 1000000))
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	if lines := logged.lines(); len(lines) != 1 || lines[0] != "" {
+		t.Errorf("logged %q with the slow request log off, want nothing", lines)
+	}
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// The only PATCH body type accepted on /{key} (RFC 7386)
+const mergePatchType = "application/merge-patch+json"
+
+// Fields a merge patch may not touch because the server maintains them
+var serverFields = map[string]bool{"location_id": true, "modification_count": true}
+
+// applyMergePatch applies an RFC 7386 merge patch to data: a field set to null
+// is reset to its zero value, an absent field is left unchanged and any other
+// value replaces the current one.
+func (s *Server) applyMergePatch(data storage.DataEntry, patch map[string]json.RawMessage) (storage.DataEntry, error) {
+	for field, raw := range patch {
+		null := string(raw) == "null"
+		var err error
+		switch field {
+		case "id":
+			var id string
+			if null {
+				data.Id = uuid.Nil
+				if s.rejectNilUUID {
+					return data, errNilUUID
+				}
+			} else if err = json.Unmarshal(raw, &id); err == nil {
+				data.Id, err = s.parseID(id)
+			}
+		case "seismic_activity":
+			err = patchReading(&data.SeismicActivity, raw, null)
+		case "temperature_c":
+			err = patchReading(&data.TemperatureC, raw, null)
+		case "radiation_level":
+			err = patchReading(&data.RadiationLevel, raw, null)
+		default:
+			if serverFields[field] {
+				return data, fmt.Errorf("%s is maintained by the server and can't be patched", field)
+			}
+			// Unknown fields are ignored, as in PUT
+		}
+		if err != nil {
+			if err == errInvalidUUID || err == errNilUUID {
+				return data, err
+			}
+			return data, fmt.Errorf("%s: invalid value", field)
+		}
+	}
+	return data, nil
+}
+
+func patchReading(field *float32, raw json.RawMessage, null bool) error {
+	if null {
+		*field = 0
+		return nil
+	}
+	return json.Unmarshal(raw, field)
+}
+
+// errBadPatch wraps merge patch problems that should answer 400
+type errBadPatch struct{ error }
+
+// handlePatch serves PATCH /{key} with a JSON merge patch of an existing entry,
+// read, patched and written back under one segment lock. Like PUT it bumps the
+// modification count and resets the expiry (X-TTL-Seconds applies); the schema
+// version only changes if X-Schema-Version is sent. Answers with the patched
+// entry, timestamps included.
+func (s *Server) handlePatch(w http.ResponseWriter, r *http.Request, locationID string) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != mergePatchType {
+		w.Header().Set("Accept-Patch", mergePatchType)
+		http.Error(w, "PATCH requires Content-Type "+mergePatchType, http.StatusUnsupportedMediaType)
+		return
+	}
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		http.Error(w, "Merge patch must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	expiresAt, err := parseTTLHeader(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	schemaVersion, err := parseSchemaVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store := s.table()
+	var data storage.DataEntry
+	write := func(gate *commitGate) {
+		data, err = store.Update(locationID, func(current storage.DataEntry, exists bool) (storage.DataEntry, error) {
+			if !exists {
+				return current, storage.ErrKeyNotFound
+			}
+			next, err := s.applyMergePatch(current, patch)
+			if err != nil {
+				return current, errBadPatch{err}
+			}
+			next.ModificationCount = s.nextVersion(current.ModificationCount)
+			next.ExpiresAt = expiresAt
+			if schemaVersion > 0 {
+				next.SchemaVersion = schemaVersion
+			}
+			if err := next.Validate(); err != nil {
+				return current, errBadPatch{err}
+			}
+			return next, gate.commit()
+		})
+	}
+	if !callWriteWithDeadline(r.Context(), write) {
+		gatewayTimeout(w)
+		return
+	}
+	if err != nil {
+		var bad errBadPatch
+		switch {
+		case errors.As(err, &bad):
+			http.Error(w, bad.Error(), http.StatusBadRequest)
+		case err == storage.ErrKeyNotFound:
+			http.Error(w, "Location ID not found", http.StatusNotFound)
+		case err == storage.ErrInsufficientMemory:
+			http.Error(w, "Insufficient storage", http.StatusInsufficientStorage)
+		case err == storage.ErrQuotaExceeded:
+			http.Error(w, "Region quota exceeded", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "Write rejected", http.StatusInternalServerError)
+		}
+		return
+	}
+	s.writeJSON(w, http.StatusOK, newStoredEntry(data), false)
+}
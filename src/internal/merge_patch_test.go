@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Each field of a merge patch is left alone when absent, reset when null and
+// replaced when present, independently of the others
+func TestMergePatchFields(t *testing.T) {
+	const id = "6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e"
+	type entry struct {
+		Id                string  `json:"id"`
+		SeismicActivity   float32 `json:"seismic_activity"`
+		TemperatureC      float32 `json:"temperature_c"`
+		RadiationLevel    float32 `json:"radiation_level"`
+		ModificationCount int     `json:"modification_count"`
+	}
+	// testReading: id, seismic 1.5, temperature 21.25, radiation 0.5
+	stored := entry{id, 1.5, 21.25, 0.5, 1}
+	newID := uuid.New().String()
+
+	cases := []struct {
+		patch string
+		want  func(e *entry)
+	}{
+		{`{}`, func(e *entry) {}},
+		{`{"seismic_activity":null}`, func(e *entry) { e.SeismicActivity = 0 }},
+		{`{"seismic_activity":3}`, func(e *entry) { e.SeismicActivity = 3 }},
+		{`{"temperature_c":null}`, func(e *entry) { e.TemperatureC = 0 }},
+		{`{"temperature_c":-4.5}`, func(e *entry) { e.TemperatureC = -4.5 }},
+		{`{"radiation_level":null}`, func(e *entry) { e.RadiationLevel = 0 }},
+		{`{"radiation_level":2}`, func(e *entry) { e.RadiationLevel = 2 }},
+		{`{"id":null}`, func(e *entry) { e.Id = uuid.Nil.String() }},
+		{`{"id":"` + newID + `"}`, func(e *entry) { e.Id = newID }},
+		{`{"temperature_c":null,"radiation_level":7,"unknown":1}`, func(e *entry) { e.TemperatureC, e.RadiationLevel = 0, 7 }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.patch, func(t *testing.T) {
+			_, ts := newTestServer(t, newTestStore())
+			resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+			wantStatus(t, resp, body, http.StatusCreated)
+
+			resp, body = do(t, ts, http.MethodPatch, "/EU-A1", tc.patch, "Content-Type", mergePatchType)
+			wantStatus(t, resp, body, http.StatusOK)
+			want := stored
+			tc.want(&want)
+			want.ModificationCount = 2
+
+			var got entry
+			decode(t, body, &got)
+			if got != want {
+				t.Errorf("patch response %+v, want %+v", got, want)
+			}
+			resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+			wantStatus(t, resp, body, http.StatusOK)
+			decode(t, body, &got)
+			if got != want {
+				t.Errorf("stored after patch %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestMergePatchRejects(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore(), WithStrictUUIDs())
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	cases := []struct {
+		name, path, contentType, patch string
+		want                           int
+	}{
+		{"plain JSON", "/EU-A1", "application/json", `{"temperature_c":1}`, http.StatusUnsupportedMediaType},
+		{"not an object", "/EU-A1", mergePatchType, `[1]`, http.StatusBadRequest},
+		{"server field", "/EU-A1", mergePatchType, `{"modification_count":9}`, http.StatusBadRequest},
+		{"wrong type", "/EU-A1", mergePatchType, `{"temperature_c":"warm"}`, http.StatusBadRequest},
+		{"nil id under strict UUIDs", "/EU-A1", mergePatchType, `{"id":null}`, http.StatusBadRequest},
+		{"missing key", "/EU-404", mergePatchType, `{"temperature_c":1}`, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		resp, body := do(t, ts, http.MethodPatch, tc.path, tc.patch, "Content-Type", tc.contentType)
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status %d, want %d (body %q)", tc.name, resp.StatusCode, tc.want, body)
+		}
+		if tc.want == http.StatusUnsupportedMediaType && resp.Header.Get("Accept-Patch") != mergePatchType {
+			t.Errorf("%s: Accept-Patch %q, want %s", tc.name, resp.Header.Get("Accept-Patch"), mergePatchType)
+		}
+	}
+
+	// Nothing rejected was written
+	var got struct {
+		ModificationCount int `json:"modification_count"`
+	}
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	decode(t, body, &got)
+	if got.ModificationCount != 1 {
+		t.Errorf("modification_count = %d after only rejected patches, want 1", got.ModificationCount)
+	}
+}
@@ -0,0 +1,15 @@
+package internal
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Methods served on /{key}
+var keyMethods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// methodNotAllowed answers 405 with the Allow header RFC 9110 requires on it
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
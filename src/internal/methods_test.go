@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAllowHeader(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+	want := "GET, HEAD, PUT, PATCH, DELETE, OPTIONS"
+
+	resp, body := do(t, ts, http.MethodOptions, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusNoContent)
+	if got := resp.Header.Get("Allow"); got != want {
+		t.Errorf("OPTIONS /EU-A1 Allow = %q, want %q", got, want)
+	}
+	if got := resp.Header.Get("Accept-Patch"); got != mergePatchType {
+		t.Errorf("OPTIONS /EU-A1 Accept-Patch = %q, want %q", got, mergePatchType)
+	}
+
+	resp, body = do(t, ts, "POST", "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusMethodNotAllowed)
+	if got := resp.Header.Get("Allow"); got != want {
+		t.Errorf("405 on /EU-A1 Allow = %q, want %q", got, want)
+	}
+
+	// Other routes list their own methods on 405
+	resp, body = do(t, ts, http.MethodDelete, "/metrics", "")
+	wantStatus(t, resp, body, http.StatusMethodNotAllowed)
+	if got := resp.Header.Get("Allow"); !strings.Contains(got, http.MethodGet) || strings.Contains(got, http.MethodDelete) {
+		t.Errorf("405 on /metrics Allow = %q, want GET without DELETE", got)
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// serverMetrics holds the counters exposed on /metrics
+type serverMetrics struct {
+	activeScans    atomic.Int64
+	rejectedScans  atomic.Uint64 // scans answered 429 after queueing
+	inflightWrites atomic.Int64
+	panics         atomic.Uint64
+}
+
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	store := s.table()
+	out := map[string]interface{}{
+		"store_size_bytes": store.Size(),
+		"store_max_bytes":  store.MaxSize(),
+		"store_entries":    store.Count(),
+		"rejected_writes":  store.RejectedWrites(),
+		"active_scans":     s.metrics.activeScans.Load(),
+		"max_scans":        cap(s.scanSem),
+		"rejected_scans":   s.metrics.rejectedScans.Load(),
+		"inflight_writes":  s.metrics.inflightWrites.Load(),
+		"panics":           s.metrics.panics.Load(),
+		"start_time":       s.startTime.UTC().Format(time.RFC3339),
+		"uptime_seconds":   int64(time.Since(s.startTime).Seconds()),
+	}
+
+	if usage := store.RegionUsage(); usage != nil {
+		out["region_usage_bytes"] = usage
+	}
+	if q, ok := storage.Underlying(store).(interface{ QueueDepth() int }); ok {
+		out["log_queue_depth"] = q.QueueDepth()
+	}
+	if l, ok := storage.Underlying(store).(interface{ LongLockHolds() uint64 }); ok {
+		out["long_lock_holds"] = l.LongLockHolds()
+	}
+	if e, ok := storage.Underlying(store).(interface{ Evictions() uint64 }); ok {
+		out["evictions"] = e.Evictions()
+	}
+	if d, ok := storage.Underlying(store).(interface{ DroppedChanges() uint64 }); ok {
+		out["dropped_changes"] = d.DroppedChanges()
+	}
+	if d, ok := storage.Underlying(store).(interface{ DistributionScore() float64 }); ok {
+		out["distribution_score"] = d.DistributionScore()
+	}
+	if s.raw != nil {
+		out["raw_size_bytes"] = s.raw.Size()
+		out["raw_entries"] = s.raw.Count()
+	}
+	if s.memPool != nil {
+		out["pool_size_classes"] = s.memPool.ClassCount()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(out)
+}
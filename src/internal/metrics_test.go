@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+func TestMetricsReportsEvictions(t *testing.T) {
+	store := storage.NewSegmentedHashTable(4, 1000, storage.WithEviction(5),
+		storage.WithSizeEstimator(func(string, storage.DataEntry) uint64 { return 100 }))
+	_, ts := newTestServer(t, store)
+	for i := 0; i < 15; i++ {
+		resp, body := do(t, ts, http.MethodPut, fmt.Sprintf("/EU-%d", i), testReading)
+		wantStatus(t, resp, body, http.StatusCreated)
+	}
+
+	resp, body := do(t, ts, http.MethodGet, "/metrics", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var metrics struct {
+		Evictions *uint64 `json:"evictions"`
+	}
+	decode(t, body, &metrics)
+	if metrics.Evictions == nil || *metrics.Evictions != 5 {
+		t.Errorf("/metrics evictions = %v, want 5 (body %s)", metrics.Evictions, body)
+	}
+}
+
+func TestRegionQuotaOverHTTP(t *testing.T) {
+	store := storage.NewSegmentedHashTable(4, 10000,
+		storage.WithSizeEstimator(func(string, storage.DataEntry) uint64 { return 100 }),
+		storage.WithRegionQuotas(map[string]uint64{"EU": 100}))
+	_, ts := newTestServer(t, store)
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodPut, "/EU-2", testReading)
+	wantStatus(t, resp, body, http.StatusTooManyRequests)
+	resp, body = do(t, ts, http.MethodPut, "/US-1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = do(t, ts, http.MethodGet, "/metrics", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var metrics struct {
+		RegionUsage map[string]uint64 `json:"region_usage_bytes"`
+	}
+	decode(t, body, &metrics)
+	if metrics.RegionUsage["EU"] != 100 || metrics.RegionUsage["US"] != 100 {
+		t.Errorf("/metrics region_usage_bytes = %v, want EU:100 US:100", metrics.RegionUsage)
+	}
+}
+
+// With every scan slot held, a scan waits out the queue timeout and gets 429,
+// and /metrics shows the slots in use and the rejection
+func TestScanSlotsExhausted(t *testing.T) {
+	s, ts := newTestServer(t, newTestStore(), WithMaxConcurrentScans(2, 10*time.Millisecond))
+	for i := 0; i < 2; i++ {
+		if !s.acquireScan(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/export", nil)) {
+			t.Fatalf("slot %d not granted", i)
+		}
+	}
+
+	resp, body := do(t, ts, http.MethodGet, "/export", "")
+	wantStatus(t, resp, body, http.StatusTooManyRequests)
+
+	var metrics struct {
+		ActiveScans   int64  `json:"active_scans"`
+		MaxScans      int    `json:"max_scans"`
+		RejectedScans uint64 `json:"rejected_scans"`
+	}
+	resp, body = do(t, ts, http.MethodGet, "/metrics", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &metrics)
+	if metrics.ActiveScans != 2 || metrics.MaxScans != 2 || metrics.RejectedScans != 1 {
+		t.Errorf("/metrics active %d max %d rejected %d, want 2, 2 and 1", metrics.ActiveScans, metrics.MaxScans, metrics.RejectedScans)
+	}
+
+	s.releaseScan()
+	resp, body = do(t, ts, http.MethodGet, "/export", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	s.releaseScan()
+}
+
+// A Put refused by the early "completely full" check and one refused after
+// taking the segment lock because the entry itself doesn't fit both count
+// towards rejected_writes
+func TestMetricsCountsRejectedWrites(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		capacity uint64
+	}{
+		{"early check", 200},     // no byte left after two entries
+		{"post-lock check", 250}, // 50 bytes left, short of a third entry
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := storage.NewSegmentedHashTable(4, tc.capacity,
+				storage.WithSizeEstimator(func(string, storage.DataEntry) uint64 { return 100 }))
+			_, ts := newTestServer(t, store)
+			for i := 0; i < 2; i++ {
+				resp, body := do(t, ts, http.MethodPut, fmt.Sprintf("/EU-%d", i), testReading)
+				wantStatus(t, resp, body, http.StatusCreated)
+			}
+			for i := 0; i < 2; i++ {
+				resp, body := do(t, ts, http.MethodPut, "/EU-full", testReading)
+				wantStatus(t, resp, body, http.StatusInsufficientStorage)
+			}
+
+			resp, body := do(t, ts, http.MethodGet, "/metrics", "")
+			wantStatus(t, resp, body, http.StatusOK)
+			var metrics struct {
+				RejectedWrites uint64 `json:"rejected_writes"`
+			}
+			decode(t, body, &metrics)
+			if metrics.RejectedWrites != 2 {
+				t.Errorf("/metrics rejected_writes = %d, want 2", metrics.RejectedWrites)
+			}
+		})
+	}
+}
+
+// /metrics reports when the server started and how long ago that was
+func TestMetricsUptime(t *testing.T) {
+	before := time.Now()
+	s, ts := newTestServer(t, newTestStore())
+	if s.startTime.Before(before) || s.startTime.After(time.Now()) {
+		t.Fatalf("startTime %v not recorded by CreateServer", s.startTime)
+	}
+
+	start := time.Now().Add(-90 * time.Minute).Truncate(time.Second)
+	s.startTime = start
+	resp, body := do(t, ts, http.MethodGet, "/metrics", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var metrics struct {
+		StartTime string `json:"start_time"`
+		Uptime    int64  `json:"uptime_seconds"`
+	}
+	decode(t, body, &metrics)
+	if want := start.UTC().Format(time.RFC3339); metrics.StartTime != want {
+		t.Errorf("start_time = %q, want %q", metrics.StartTime, want)
+	}
+	if metrics.Uptime < 90*60 || metrics.Uptime > 90*60+5 {
+		t.Errorf("uptime_seconds = %d, want about %d", metrics.Uptime, 90*60)
+	}
+}
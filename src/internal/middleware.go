@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverPanics turns a handler panic into a logged 500 instead of a dropped
+// connection. http.ErrAbortHandler is re-raised since it is the stdlib's way to
+// abort a response on purpose.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			s.metrics.panics.Add(1)
+			s.logger.Error("handler panic",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", rec,
+				"stack", string(debug.Stack()),
+			)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"internal server error"}` + "\n"))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
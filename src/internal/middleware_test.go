@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	var logged bytes.Buffer
+	s := CreateServer(newTestStore(), nil, WithLogger(slog.New(slog.NewJSONHandler(&logged, nil)), 0))
+	h := s.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/boom" {
+			var e *struct{ n int }
+			_ = e.n
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d after a panic, want 500", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body map[string]string
+	decode(t, rec.Body.String(), &body)
+	if body["error"] == "" {
+		t.Errorf("body %q has no error field", rec.Body.String())
+	}
+	if !strings.Contains(logged.String(), "handler panic") || !strings.Contains(logged.String(), "goroutine") {
+		t.Errorf("panic not logged with a stack trace: %s", logged.String())
+	}
+	if n := s.metrics.panics.Load(); n != 1 {
+		t.Errorf("panic counter = %d, want 1", n)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fine", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status %d for the next request, want 204", rec.Code)
+	}
+}
+
+func TestRecoverPanicsReraisesAbort(t *testing.T) {
+	s := CreateServer(newTestStore(), nil)
+	h := s.recoverPanics(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler re-raised", rec)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
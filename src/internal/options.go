@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// ServerOption tweaks optional Server behaviour at construction time
+type ServerOption func(*Server)
+
+// WithMaxConcurrentScans limits how many full-store scans (export, stats, ...) can
+// run at once. Requests beyond the limit wait up to queueTimeout before getting 429.
+func WithMaxConcurrentScans(n int, queueTimeout time.Duration) ServerOption {
+	return func(s *Server) {
+		if n <= 0 {
+			return
+		}
+		s.scanSem = make(chan struct{}, n)
+		s.scanQueueTimeout = queueTimeout
+	}
+}
+
+// WithDefaultOnMiss makes GET on an unknown key return 200 with a zero-valued
+// entry carrying the requested location ID, instead of 404.
+func WithDefaultOnMiss() ServerOption {
+	return func(s *Server) {
+		s.defaultOnMiss = true
+	}
+}
+
+// WithFaultInjection registers POST /admin/faults, which makes a configurable share
+// of PUTs fail or slow down. Meant for client testing only, never production.
+func WithFaultInjection() ServerOption {
+	return func(s *Server) {
+		s.faults = &faultInjector{}
+	}
+}
+
+// WithLogger sets the request logger. Errors are always logged; successful
+// requests are logged once every sampleN (1 logs everything).
+func WithLogger(logger *slog.Logger, sampleN int) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+		if sampleN > 0 {
+			s.logSampleN = sampleN
+		}
+	}
+}
+
+// WithRouteLogging overrides how successful requests are logged per ServeMux
+// pattern (e.g. "/" for key GET/PUT/DELETE, "/range"). Unlisted routes keep
+// their default level.
+func WithRouteLogging(levels map[string]RouteLogLevel) ServerOption {
+	return func(s *Server) {
+		for pattern, level := range levels {
+			s.routeLogging[pattern] = level
+		}
+	}
+}
+
+// WithSlowRequestLog logs any request taking at least threshold at warn level,
+// even on routes that are quiet or sampled. 0 disables it.
+func WithSlowRequestLog(threshold time.Duration) ServerOption {
+	return func(s *Server) {
+		s.slowRequest = threshold
+	}
+}
+
+// WithAlertThresholds makes GET responses carry a derived "status" field
+// (normal/warning/critical) computed from the thresholds. Nothing is stored.
+func WithAlertThresholds(thresholds AlertThresholds) ServerOption {
+	return func(s *Server) {
+		s.thresholds = thresholds
+	}
+}
+
+// WithMaxServeAge makes GET return 410 Gone for entries last written more than
+// maxAge ago. The data stays stored; it just isn't served as a fresh reading.
+func WithMaxServeAge(maxAge time.Duration) ServerOption {
+	return func(s *Server) {
+		s.maxServeAge = maxAge
+	}
+}
+
+// WithCapacityHeaders adds X-Store-Used-Bytes, X-Store-Max-Bytes and
+// X-Store-Used-Percent to GET/PUT responses as a cheap backpressure signal
+func WithCapacityHeaders() ServerOption {
+	return func(s *Server) {
+		s.capacityHeaders = true
+	}
+}
+
+// WithEncodeBufferSize sets the size of the PoolManager buffers GET responses
+// are encoded into. 0 disables pooling and allocates a buffer per request.
+func WithEncodeBufferSize(size int) ServerOption {
+	return func(s *Server) {
+		s.encodeBufferSize = size
+	}
+}
+
+// WithExportBufferSize sets the size of the PoolManager buffer /export encodes
+// entries into and writes out whenever it fills. 0 disables pooling and encodes
+// each entry straight to the response.
+func WithExportBufferSize(size int) ServerOption {
+	return func(s *Server) {
+		s.exportBufferSize = size
+	}
+}
+
+// WithStreamThreshold sets the encoded size above which JSON responses stop
+// being held back and are encoded straight to the client with chunked transfer
+// encoding, flushing as they go. 0 always sends them whole.
+func WithStreamThreshold(size int) ServerOption {
+	return func(s *Server) {
+		s.streamThreshold = size
+	}
+}
+
+// WithDebug registers diagnostic endpoints (e.g. /admin/inspect/{key}) that
+// expose internals and shouldn't be reachable in normal deployments
+func WithDebug() ServerOption {
+	return func(s *Server) {
+		s.debug = true
+	}
+}
+
+// WithCapacityReadiness makes /health report unavailable once store usage stays
+// at or above threshold (a fraction of MaxSize, e.g. 0.95) for the grace period,
+// and ready again only after it stays below for the same period.
+func WithCapacityReadiness(threshold float64, grace time.Duration) ServerOption {
+	return func(s *Server) {
+		s.capacityGate = &readinessGate{grace: grace}
+		s.capacityThreshold = threshold
+	}
+}
+
+// WithMaxRequestTimeout caps the budget clients may ask for with X-Timeout-Ms
+func WithMaxRequestTimeout(max time.Duration) ServerOption {
+	return func(s *Server) {
+		s.maxRequestTimeout = max
+	}
+}
+
+// WithMaxResults caps how many entries (or regions, or readings) one list-type
+// request returns: range, prefix, export, export.csv, regions and history.
+// Longer results are truncated with a cursor. 0 removes the cap.
+func WithMaxResults(n int) ServerOption {
+	return func(s *Server) {
+		s.maxResults = n
+	}
+}
+
+// WithRawStore serves /raw/{key} from table: opaque byte values alongside the
+// typed sensor API
+func WithRawStore(table *storage.BlobTable) ServerOption {
+	return func(s *Server) {
+		s.raw = table
+	}
+}
+
+// WithAPIKeys requires a valid API key, sent as "Authorization: Bearer <key>"
+// or X-API-Key, on writes and /admin/ routes; other requests get 401, and
+// writes with a RoleRead key get 403. With publicReads unset, reads need a key
+// too. Health checks and /ping stay open. gRPC calls send the key as
+// "authorization" or "x-api-key" metadata. No keys leaves auth off.
+func WithAPIKeys(keys []APIKey, publicReads bool) ServerOption {
+	return func(s *Server) {
+		if len(keys) > 0 {
+			s.apiKeys = &apiKeys{keys: keys, publicReads: publicReads}
+		}
+	}
+}
+
+// WithRequiredReadings makes PUT /{key} answer 422, and gRPC Put fail with
+// InvalidArgument, when the body leaves out any of seismic_activity,
+// temperature_c or radiation_level, instead of storing 0 for them. Batches and
+// transactions are unaffected.
+func WithRequiredReadings() ServerOption {
+	return func(s *Server) {
+		s.requireReadings = true
+	}
+}
+
+// WithAuditLog keeps the last size mutations (method, path, key, client and
+// status) in memory and serves them at /admin/audit. Like other /admin/ routes
+// it needs an API key when API keys are configured. 0 disables it.
+func WithAuditLog(size int) ServerOption {
+	return func(s *Server) {
+		if size > 0 {
+			s.audit = newAuditLog(size)
+		}
+	}
+}
+
+// WithReadingPrecision rounds sensor readings to places decimals wherever they
+// are read: GET /{key} and its history, /range, /prefix/, both exports and gRPC
+// Get. Stored values are untouched. A negative places serves them exactly, and
+// places above MaxReadingPrecision are ignored.
+func WithReadingPrecision(places int) ServerOption {
+	return func(s *Server) {
+		if places <= MaxReadingPrecision {
+			s.readingPlaces = places
+		}
+	}
+}
+
+// WithMaxBatchSize caps the ops in one POST /batch; larger batches get 413 as
+// soon as the op over the limit is reached. 0 disables the cap.
+func WithMaxBatchSize(n int) ServerOption {
+	return func(s *Server) {
+		s.maxBatch = n
+	}
+}
+
+// WithRootIndex sets whether GET / lists the available endpoints (the default)
+// or answers 400 like every other method on /, since / names no key
+func WithRootIndex(enabled bool) ServerOption {
+	return func(s *Server) {
+		s.rootIndex = enabled
+	}
+}
+
+// WithMaxVersion caps ModificationCount: the write after an entry reaches max
+// sets it back to 1. 0 lets it grow until it would overflow, where it also
+// rolls over to 1.
+func WithMaxVersion(max int) ServerOption {
+	return func(s *Server) {
+		s.maxVersion = max
+	}
+}
+
+// WithSeparateAdmin moves /metrics and the /admin/ and /debug/ routes off the
+// data listeners; serve them with StartAdmin instead
+func WithSeparateAdmin() ServerOption {
+	return func(s *Server) {
+		s.separateAdmin = true
+	}
+}
+
+// WithOmitNilID makes GET /{key} leave the "id" field out when it is the nil
+// UUID, so clients can tell an entry without an id from one with a real id.
+// By default id is always included.
+func WithOmitNilID() ServerOption {
+	return func(s *Server) {
+		s.omitNilID = true
+	}
+}
+
+// WithRateLimit gives each client (valid API key, else IP) a token bucket
+// refilling at perSecond requests per second up to burst; requests beyond it
+// get 429. Responses carry X-RateLimit-* headers. perSecond <= 0 disables it.
+func WithRateLimit(perSecond float64, burst int) ServerOption {
+	return func(s *Server) {
+		if perSecond > 0 {
+			s.rateLimit = newRateLimiter(perSecond, max(burst, 1))
+		}
+	}
+}
+
+// WithStrictUUIDs makes writes answer 400 when their id is the nil UUID
+func WithStrictUUIDs() ServerOption {
+	return func(s *Server) {
+		s.rejectNilUUID = true
+	}
+}
+
+// WithMaxInflightWrites caps concurrent writes on every write route (PUT, PATCH
+// and DELETE of keys and /raw values, /batch, /txn, /import, /admin/purge,
+// /admin/clear and gRPC Put and Delete); writes over the cap get 429
+// immediately while reads are never throttled. 0 is unlimited.
+func WithMaxInflightWrites(n int) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.writeSem = make(chan struct{}, n)
+		}
+	}
+}
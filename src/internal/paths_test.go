@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeyFromPath(t *testing.T) {
+	cases := []struct {
+		path, key, sub string
+		err            error
+	}{
+		{"/EU-A1", "EU-A1", "", nil},
+		{"/EU-A1/", "EU-A1", "", nil},
+		{"/EU-A1/history", "EU-A1", "history", nil},
+		{"/EU-A1/history/", "EU-A1", "history", nil},
+		{"/EU-A1/aggregate", "EU-A1", "aggregate", nil},
+		{"/EU%2DA1", "EU-A1", "", nil},
+		{"/EU%C3%A9", "EUé", "", nil},
+		{"/EU%2FA1", "EU/A1", "", nil}, // an encoded slash is part of the key
+		{"/EU%2FA1/history", "EU/A1", "history", nil},
+		{"/", "", "", nil},
+		{"/EU/A1", "", "", errMultiSegment},
+		{"/EU-A1/other", "", "", errMultiSegment},
+	}
+	for _, tc := range cases {
+		key, sub, err := keyFromPath(httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if key != tc.key || sub != tc.sub || err != tc.err {
+			t.Errorf("keyFromPath(%s) = %q, %q, %v; want %q, %q, %v", tc.path, key, sub, err, tc.key, tc.sub, tc.err)
+		}
+	}
+}
+
+func TestTrailingSlashAndEncodedKeys(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+
+	// A trailing slash addresses the same key
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1/", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1/", "")
+	wantStatus(t, resp, body, http.StatusOK)
+
+	// Percent-encoded keys are stored and served decoded
+	resp, body = do(t, ts, http.MethodPut, "/EU%2FA2", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodGet, "/EU%2FA2", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var entry struct {
+		LocationID string `json:"location_id"`
+	}
+	decode(t, body, &entry)
+	if entry.LocationID != "EU/A2" {
+		t.Errorf("location_id = %q, want the decoded EU/A2", entry.LocationID)
+	}
+	resp, body = do(t, ts, http.MethodGet, "/EU%2DA1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+
+	// Unencoded extra segments name no key
+	resp, body = do(t, ts, http.MethodGet, "/EU/A2", "")
+	wantStatus(t, resp, body, http.StatusNotFound)
+}
+
+// Paths with more than one key segment are refused for every method, and never
+// reach a key that happens to match one of their segments
+func TestMultiSegmentPaths(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store)
+	resp, body := do(t, ts, http.MethodPut, "/EU", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	for _, path := range []string{"/EU/A1", "/a/b/c", "/EU/history/A1", "/EU/A1/history", "/EU//A1"} {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			body := ""
+			if method == http.MethodPut {
+				body = testReading
+			}
+			resp, got := do(t, ts, method, path, body)
+			if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("%s %s: status %d, want 404 (%q)", method, path, resp.StatusCode, got)
+			}
+		}
+	}
+	if n := store.Count(); n != 1 {
+		t.Errorf("store holds %d entries, want only EU", n)
+	}
+	resp, body = do(t, ts, http.MethodGet, "/EU", "")
+	wantStatus(t, resp, body, http.StatusOK)
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// parseLimit reads an optional non-negative ?limit=; 0 means unlimited
+func parseLimit(r *http.Request) (int, bool) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		return 0, false
+	}
+	return limit, true
+}
+
+// Default cap on entries returned by one list-type request
+const defaultMaxResults = 10000
+
+// pageLimit combines the client's ?limit= with the server-wide cap on results
+func (s *Server) pageLimit(limit int) int {
+	if s.maxResults > 0 && (limit <= 0 || limit > s.maxResults) {
+		return s.maxResults
+	}
+	return limit
+}
+
+// markTruncated tells the client more entries exist and where to resume: the
+// cursor is the first key not returned, to be passed back as ?cursor=
+func markTruncated(w http.ResponseWriter, cursor string) {
+	w.Header().Set("X-Truncated", "true")
+	w.Header().Set("X-Next-Cursor", cursor)
+}
+
+// rangeHandler serves GET /range?start=A&end=B[&limit=N][&cursor=K]: every entry
+// whose key sorts within [start, end], in key order. It is an O(n) scan of the
+// whole store. Results are capped at maxResults; a truncated page carries the
+// cursor to continue from.
+func (s *Server) rangeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	start, end := r.URL.Query().Get("start"), r.URL.Query().Get("end")
+	if start == "" || end == "" || start > end {
+		http.Error(w, "start and end are required and start must not sort after end", http.StatusBadRequest)
+		return
+	}
+	limit, ok := parseLimit(r)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if !s.acquireScan(w, r) {
+		return
+	}
+	defer s.releaseScan()
+
+	if cursor := r.URL.Query().Get("cursor"); cursor > start {
+		start = cursor
+	}
+	store := s.table()
+	limit = s.pageLimit(limit)
+	entries, cursor := rangePage(store, start, end, limit)
+	entries = s.shownAll(entries)
+	logDetail(r, "results", len(entries), "truncated", cursor != "")
+	if cursor != "" {
+		markTruncated(w, cursor)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries":   entries,
+		"count":     len(entries),
+		"truncated": cursor != "",
+		"cursor":    cursor,
+	})
+}
+
+// rangePage fetches up to limit entries in [start, end] plus one more to learn
+// whether the range continues, returning that extra entry's key as the cursor
+func rangePage(store storage.Store, start, end string, limit int) ([]storage.DataEntry, string) {
+	if limit <= 0 {
+		return store.Range(start, end, 0), ""
+	}
+	entries := store.Range(start, end, limit+1)
+	if len(entries) <= limit {
+		return entries, ""
+	}
+	return entries[:limit], store.NormalizeKey(entries[limit].LocationId)
+}
+
+// prefixHandler serves GET /prefix/{prefix}[?limit=N][&cursor=K]: the entries
+// whose keys start with prefix, e.g. every sensor in one region, as an object
+// keyed by location ID. Pages are in key order and capped at maxResults; like
+// /range, a truncated page says so in the body and carries the cursor to
+// continue from.
+func (s *Server) prefixHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	prefix := strings.TrimPrefix(r.URL.Path, "/prefix/")
+	if prefix == "" {
+		http.Error(w, "Prefix required", http.StatusBadRequest)
+		return
+	}
+	limit, ok := parseLimit(r)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if !s.acquireScan(w, r) {
+		return
+	}
+	defer s.releaseScan()
+
+	store := s.table()
+	limit = s.pageLimit(limit)
+	var entries map[string]storage.DataEntry
+	var cursor string
+	if limit <= 0 {
+		entries = store.WithPrefix(prefix, 0)
+		for key, e := range entries {
+			entries[key] = s.shown(e)
+		}
+	} else {
+		// Keys with the prefix sort together, so a key range pages through them
+		start := prefix
+		if after := r.URL.Query().Get("cursor"); after > start {
+			start = after
+		}
+		var page []storage.DataEntry
+		page, cursor = rangePage(store, start, prefix+"\xff", limit)
+		if cursor != "" {
+			markTruncated(w, cursor)
+		}
+		entries = make(map[string]storage.DataEntry, len(page))
+		for _, e := range page {
+			entries[store.NormalizeKey(e.LocationId)] = s.shown(e)
+		}
+	}
+	logDetail(r, "results", len(entries), "truncated", cursor != "")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries":   entries,
+		"count":     len(entries),
+		"truncated": cursor != "",
+		"cursor":    cursor,
+	})
+}
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// putKeys stores a reading under each key
+func putKeys(t testing.TB, store storage.Store, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := store.Put(key, storage.DataEntry{LocationId: key}); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+}
+
+// seqKeys returns region-000 .. region-(n-1)
+func seqKeys(region string, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s-%03d", region, i)
+	}
+	return keys
+}
+
+func TestRangeTruncation(t *testing.T) {
+	store := newTestStore()
+	putKeys(t, store, seqKeys("EU", 5)...)
+	_, ts := newTestServer(t, store, WithMaxResults(2))
+
+	var page struct {
+		Entries   []storage.DataEntry `json:"entries"`
+		Truncated bool                `json:"truncated"`
+		Cursor    string              `json:"cursor"`
+	}
+	var seen []string
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		resp, body := do(t, ts, http.MethodGet, "/range?start=EU-000&end=EU-999&cursor="+cursor, "")
+		wantStatus(t, resp, body, http.StatusOK)
+		page.Cursor = ""
+		decode(t, body, &page)
+		if len(page.Entries) > 2 {
+			t.Fatalf("page of %d entries exceeds the cap of 2", len(page.Entries))
+		}
+		for _, e := range page.Entries {
+			seen = append(seen, e.LocationId)
+		}
+		if got := resp.Header.Get("X-Truncated") == "true"; got != page.Truncated || page.Truncated != (page.Cursor != "") {
+			t.Fatalf("X-Truncated %v, truncated %v and cursor %q disagree", got, page.Truncated, page.Cursor)
+		}
+		if !page.Truncated {
+			break
+		}
+		cursor = page.Cursor
+	}
+	if got := strings.Join(seen, ","); got != "EU-000,EU-001,EU-002,EU-003,EU-004" {
+		t.Errorf("paging through /range returned %s", got)
+	}
+}
+
+func TestPrefixTruncation(t *testing.T) {
+	store := newTestStore()
+	putKeys(t, store, seqKeys("EU", 3)...)
+	putKeys(t, store, "US-000")
+	_, ts := newTestServer(t, store, WithMaxResults(2))
+
+	var page struct {
+		Entries   map[string]storage.DataEntry `json:"entries"`
+		Count     int                          `json:"count"`
+		Truncated bool                         `json:"truncated"`
+		Cursor    string                       `json:"cursor"`
+	}
+	resp, body := do(t, ts, http.MethodGet, "/prefix/EU", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &page)
+	if !page.Truncated || page.Cursor != "EU-002" || page.Count != 2 || len(page.Entries) != 2 {
+		t.Fatalf("first page: truncated %v cursor %q count %d; want a truncated page of 2 resuming at EU-002", page.Truncated, page.Cursor, page.Count)
+	}
+	if resp.Header.Get("X-Next-Cursor") != "EU-002" {
+		t.Errorf("X-Next-Cursor = %q, want EU-002", resp.Header.Get("X-Next-Cursor"))
+	}
+
+	page.Entries = nil
+	resp, body = do(t, ts, http.MethodGet, "/prefix/EU?cursor="+page.Cursor, "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &page)
+	if page.Truncated || page.Cursor != "" || len(page.Entries) != 1 {
+		t.Fatalf("last page: truncated %v cursor %q with %d entries, want 1 and no cursor", page.Truncated, page.Cursor, len(page.Entries))
+	}
+	if _, ok := page.Entries["EU-002"]; !ok {
+		t.Errorf("last page %v lacks EU-002", page.Entries)
+	}
+}
+
+func TestExportTruncation(t *testing.T) {
+	store := newTestStore()
+	putKeys(t, store, seqKeys("EU", 5)...)
+
+	for _, path := range []string{"/export", "/export.csv"} {
+		t.Run(path, func(t *testing.T) {
+			_, ts := newTestServer(t, store, WithMaxResults(2))
+			lines := 0
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > 5 {
+					t.Fatal("export never stopped truncating")
+				}
+				resp, body := do(t, ts, http.MethodGet, path+"?cursor="+cursor, "")
+				wantStatus(t, resp, body, http.StatusOK)
+				n := strings.Count(body, "\n")
+				if path == "/export.csv" {
+					n-- // header row
+				}
+				if n > 2 {
+					t.Fatalf("page of %d rows exceeds the cap of 2", n)
+				}
+				lines += n
+				if resp.Header.Get("X-Truncated") != "true" {
+					break
+				}
+				cursor = resp.Header.Get("X-Next-Cursor")
+			}
+			if lines != 5 {
+				t.Errorf("paging through %s returned %d rows, want 5", path, lines)
+			}
+		})
+	}
+
+	// Under the cap the export is whole and unmarked
+	_, ts := newTestServer(t, store, WithMaxResults(10))
+	resp, body := do(t, ts, http.MethodGet, "/export", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	if n := strings.Count(body, "\n"); n != 5 || resp.Header.Get("X-Truncated") != "" {
+		t.Errorf("export under the cap: %d lines, X-Truncated %q", n, resp.Header.Get("X-Truncated"))
+	}
+}
+
+func TestRegionsTruncation(t *testing.T) {
+	store := newTestStore()
+	putKeys(t, store, "AF-1", "AS-1", "EU-1", "EU-2", "US-1")
+	_, ts := newTestServer(t, store, WithMaxResults(3))
+
+	var page struct {
+		Regions   map[string]int `json:"regions"`
+		Truncated bool           `json:"truncated"`
+		Cursor    string         `json:"cursor"`
+	}
+	resp, body := do(t, ts, http.MethodGet, "/regions", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &page)
+	if !page.Truncated || page.Cursor != "US" || len(page.Regions) != 3 || page.Regions["EU"] != 2 {
+		t.Fatalf("first page %v truncated %v cursor %q, want AF, AS, EU:2 resuming at US", page.Regions, page.Truncated, page.Cursor)
+	}
+
+	page.Regions = nil
+	resp, body = do(t, ts, http.MethodGet, "/regions?cursor=US", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &page)
+	if page.Truncated || len(page.Regions) != 1 || page.Regions["US"] != 1 {
+		t.Errorf("last page %v truncated %v, want just US", page.Regions, page.Truncated)
+	}
+}
+
+func TestHistoryTruncation(t *testing.T) {
+	store := newTestStore(storage.WithHistory(10))
+	for i := 0; i < 5; i++ {
+		putKeys(t, store, "EU-A1")
+	}
+	_, ts := newTestServer(t, store, WithMaxResults(2))
+
+	var points []historyPoint
+	resp, body := do(t, ts, http.MethodGet, "/EU-A1/history", "")
+	wantStatus(t, resp, body, http.StatusPartialContent)
+	decode(t, body, &points)
+	if len(points) != 2 || resp.Header.Get("Content-Range") != "readings 0-1/5" || resp.Header.Get("X-Next-Cursor") != "2" {
+		t.Fatalf("got %d readings, Content-Range %q, X-Next-Cursor %q; want 2, readings 0-1/5, 2",
+			len(points), resp.Header.Get("Content-Range"), resp.Header.Get("X-Next-Cursor"))
+	}
+
+	// An explicit range wider than the cap is cut short too
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1/history", "", "Range", "readings=2-")
+	wantStatus(t, resp, body, http.StatusPartialContent)
+	if got := resp.Header.Get("Content-Range"); got != "readings 2-3/5" || resp.Header.Get("X-Truncated") != "true" {
+		t.Errorf("Content-Range %q, X-Truncated %q; want readings 2-3/5, true", got, resp.Header.Get("X-Truncated"))
+	}
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1/history", "", "Range", "readings=4-")
+	wantStatus(t, resp, body, http.StatusPartialContent)
+	if resp.Header.Get("X-Truncated") != "" {
+		t.Errorf("last window marked truncated")
+	}
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How often idle client buckets are dropped
+const rateLimitPruneInterval = time.Minute
+
+// tokenBucket is one client's allowance: it refills at the limiter's rate up
+// to burst tokens, and each request takes one
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per client, keyed by API key when the
+// request carries a valid one and by remote IP otherwise
+type rateLimiter struct {
+	rate  float64 // tokens per second
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, clients: make(map[string]*tokenBucket)}
+}
+
+// take spends one of client's tokens if it has one. It returns the tokens left
+// and how long until the bucket is full again, or with ok false how long until
+// the next token.
+func (l *rateLimiter) take(client string, now time.Time) (remaining int, wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) >= rateLimitPruneInterval {
+		l.pruneLocked(now)
+	}
+	b := l.clients[client]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.clients[client] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return 0, l.refill(1 - b.tokens), false
+	}
+	b.tokens--
+	return int(b.tokens), l.refill(float64(l.burst) - b.tokens), true
+}
+
+// refill is how long the bucket takes to gain n tokens
+func (l *rateLimiter) refill(n float64) time.Duration {
+	return time.Duration(n / l.rate * float64(time.Second))
+}
+
+// pruneLocked forgets buckets that have refilled completely, since a fresh
+// bucket behaves the same
+func (l *rateLimiter) pruneLocked(now time.Time) {
+	for client, b := range l.clients {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.clients, client)
+		}
+	}
+	l.lastPrune = now
+}
+
+// rateLimitClient identifies who a request counts against. Only a configured
+// API key earns its own bucket; anything else a client sends as a key is
+// ignored, or minting a fresh key per request would dodge the limit and grow
+// the bucket map without bound.
+func (s *Server) rateLimitClient(r *http.Request) string {
+	if s.apiKeys != nil {
+		if key := requestAPIKey(r); key != "" {
+			if _, ok := s.apiKeys.lookup(key); ok {
+				return "key:" + key
+			}
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// limitRate answers 429 to clients that have used up their token bucket, and
+// tells every client where it stands with X-RateLimit-Limit (the burst),
+// X-RateLimit-Remaining and X-RateLimit-Reset (seconds until the bucket is
+// full) so well-behaved ones can slow down first. It runs before API key
+// checks, so requests that fail them still spend their IP's tokens and key
+// guessing is throttled too. Health checks and /ping are never limited. A
+// no-op unless rate limiting is enabled.
+func (s *Server) limitRate(next http.Handler) http.Handler {
+	if s.rateLimit == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health", "/health/ready", "/ping":
+			next.ServeHTTP(w, r)
+			return
+		}
+		remaining, wait, ok := s.rateLimit.take(s.rateLimitClient(r), time.Now())
+		seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.rateLimit.burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !ok {
+			w.Header().Set("Retry-After", seconds)
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("X-RateLimit-Reset", seconds)
+		next.ServeHTTP(w, r)
+	})
+}
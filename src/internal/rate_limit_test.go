@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Remaining counts down with each request, the request past it gets 429 with
+// Retry-After, and Reset says how long until the bucket is full again
+func TestRateLimitHeaders(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore(), WithRateLimit(1, 3))
+	for i, want := range []int{2, 1, 0} {
+		resp, body := do(t, ts, http.MethodGet, "/EU-A1", "")
+		wantStatus(t, resp, body, http.StatusNotFound)
+		if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "3" {
+			t.Errorf("request %d: X-RateLimit-Limit %q, want 3", i, limit)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != strconv.Itoa(want) {
+			t.Errorf("request %d: X-RateLimit-Remaining %q, want %d", i, got, want)
+		}
+		// One token a second, so the bucket is full again within spent+1 seconds
+		reset, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset"))
+		if spent := 3 - want; err != nil || reset < spent-1 || reset > spent {
+			t.Errorf("request %d: X-RateLimit-Reset %q, want about %d", i, resp.Header.Get("X-RateLimit-Reset"), spent)
+		}
+	}
+	resp, body := do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusTooManyRequests)
+	if got := resp.Header.Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("limited request: X-RateLimit-Remaining %q, want 0", got)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "1" {
+		t.Errorf("limited request: Retry-After %q, want 1", got)
+	}
+
+	// Health checks are never counted or limited
+	resp, body = do(t, ts, http.MethodGet, "/health", "")
+	wantStatus(t, resp, body, http.StatusOK)
+}
+
+// Buckets refill at the configured rate and never past the burst
+func TestRateLimitRefills(t *testing.T) {
+	l := newRateLimiter(2, 4)
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		l.take("client", now)
+	}
+	if _, wait, ok := l.take("client", now); ok || wait != 500*time.Millisecond {
+		t.Fatalf("take from an empty bucket: ok %v, wait %v; want refused, 500ms", ok, wait)
+	}
+
+	now = now.Add(time.Second) // two tokens back
+	if remaining, _, ok := l.take("client", now); !ok || remaining != 1 {
+		t.Errorf("take after 1s: ok %v, remaining %d; want 1 left", ok, remaining)
+	}
+	now = now.Add(time.Hour)
+	if remaining, wait, ok := l.take("client", now); !ok || remaining != 3 || wait != 500*time.Millisecond {
+		t.Errorf("take after an hour: ok %v, remaining %d, reset %v; want 3 left, full in 500ms", ok, remaining, wait)
+	}
+}
+
+// Unrecognised API keys can't buy a client a fresh bucket: they count against
+// the client's IP, and only configured keys get buckets of their own
+func TestRateLimitClientKeys(t *testing.T) {
+	t.Run("no keys configured", func(t *testing.T) {
+		s, ts := newTestServer(t, newTestStore(), WithRateLimit(0.001, 2))
+		for i := 0; i < 3; i++ {
+			resp, body := do(t, ts, http.MethodGet, "/EU-A1", "", "X-API-Key", "made-up-"+strconv.Itoa(i))
+			want := http.StatusNotFound
+			if i == 2 {
+				want = http.StatusTooManyRequests
+			}
+			wantStatus(t, resp, body, want)
+		}
+		if n := len(s.rateLimit.clients); n != 1 {
+			t.Errorf("%d buckets after requests with made-up keys, want 1", n)
+		}
+	})
+
+	t.Run("public reads", func(t *testing.T) {
+		keys := []APIKey{{Key: "reader-key", Role: RoleRead}}
+		s, ts := newTestServer(t, newTestStore(), WithAPIKeys(keys, true), WithRateLimit(0.001, 2))
+		for i := 0; i < 2; i++ {
+			resp, body := do(t, ts, http.MethodGet, "/EU-A1", "", "Authorization", "Bearer fake-"+strconv.Itoa(i))
+			wantStatus(t, resp, body, http.StatusNotFound)
+		}
+		resp, body := do(t, ts, http.MethodGet, "/EU-A1", "")
+		wantStatus(t, resp, body, http.StatusTooManyRequests)
+
+		// A valid key has its own allowance, untouched by the IP's
+		resp, body = do(t, ts, http.MethodGet, "/EU-A1", "", "X-API-Key", "reader-key")
+		wantStatus(t, resp, body, http.StatusNotFound)
+		if n := len(s.rateLimit.clients); n != 2 {
+			t.Errorf("%d buckets, want one for the IP and one for the valid key", n)
+		}
+	})
+}
+
+// Requests with wrong keys are limited like any other, so guessing keys runs
+// into 429s rather than an endless stream of 401s
+func TestRateLimitThrottlesBadKeys(t *testing.T) {
+	keys := []APIKey{{Key: "writer-key", Role: RoleReadWrite}}
+	_, ts := newTestServer(t, newTestStore(), WithAPIKeys(keys, false), WithRateLimit(0.001, 3))
+	for i := 0; i < 3; i++ {
+		resp, body := do(t, ts, http.MethodGet, "/EU-A1", "", "X-API-Key", "guess-"+strconv.Itoa(i))
+		wantStatus(t, resp, body, http.StatusUnauthorized)
+	}
+	resp, body := do(t, ts, http.MethodGet, "/EU-A1", "", "X-API-Key", "guess-3")
+	wantStatus(t, resp, body, http.StatusTooManyRequests)
+
+	// The real key still has its own allowance
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "", "X-API-Key", "writer-key")
+	wantStatus(t, resp, body, http.StatusNotFound)
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// Largest value accepted by PUT /raw/{key}
+const maxRawValueSize = 1 << 20
+
+var rawMethods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete}
+
+// rawHandler serves /raw/{key}: GET, PUT and DELETE of opaque values stored
+// byte for byte in the BlobTable, for using the server as a general KV store
+func (s *Server) rawHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/raw/")
+	if key == "" {
+		http.Error(w, "Key required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		value, err := s.raw.Get(key)
+		if err == storage.ErrKeyNotFound {
+			http.Error(w, "Key not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write(value)
+	case http.MethodPut:
+		if !s.acquireWrite(w) {
+			return
+		}
+		defer s.releaseWrite()
+		value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRawValueSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Value too large", http.StatusRequestEntityTooLarge)
+			} else {
+				http.Error(w, "Error reading body", http.StatusBadRequest)
+			}
+			return
+		}
+		if err := s.raw.Put(key, value); err != nil {
+			if err == storage.ErrInsufficientMemory {
+				http.Error(w, "Insufficient storage", http.StatusInsufficientStorage)
+			} else {
+				http.Error(w, "Write rejected", http.StatusInternalServerError)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if !s.acquireWrite(w) {
+			return
+		}
+		defer s.releaseWrite()
+		if err := s.raw.Delete(key); err != nil {
+			http.Error(w, "Key not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, rawMethods...)
+	}
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// readinessGate debounces a "not ready" condition: the gate only flips once the
+// condition has disagreed with the current state for the whole grace period,
+// in either direction, so transient spikes don't make load balancers flap.
+type readinessGate struct {
+	mu      sync.Mutex
+	grace   time.Duration
+	unready bool
+	since   time.Time // when the condition started disagreeing with unready
+}
+
+// observe feeds the current condition (true = should be unready) and returns
+// whether the gate currently reports ready
+func (g *readinessGate) observe(now time.Time, condition bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if condition == g.unready {
+		g.since = time.Time{}
+		return !g.unready
+	}
+	if g.since.IsZero() {
+		g.since = now
+	}
+	if now.Sub(g.since) >= g.grace {
+		g.unready = condition
+		g.since = time.Time{}
+	}
+	return !g.unready
+}
+
+// capacityReady reports whether the store is comfortably below the capacity
+// threshold, with hysteresis applied. Always true when the check is disabled.
+func (s *Server) capacityReady() bool {
+	if s.capacityGate == nil {
+		return true
+	}
+	store := s.table()
+	full := false
+	if max := store.MaxSize(); max > 0 {
+		full = float64(store.Size()) >= s.capacityThreshold*float64(max)
+	}
+	return s.capacityGate.observe(time.Now(), full)
+}
+
+// subsystemStatus is one line of the /health/ready report
+type subsystemStatus struct {
+	Healthy bool   `json:"healthy"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type readinessReport struct {
+	Ready      bool                       `json:"ready"`
+	Subsystems map[string]subsystemStatus `json:"subsystems"`
+}
+
+// readinessReport checks each subsystem readiness depends on. The log entry is
+// only present when the store is backed by a data file.
+func (s *Server) readinessReport() readinessReport {
+	report := readinessReport{Ready: true, Subsystems: make(map[string]subsystemStatus)}
+	set := func(name string, healthy bool, detail string) {
+		st := subsystemStatus{Healthy: healthy}
+		if !healthy {
+			st.Detail = detail
+			report.Ready = false
+		}
+		report.Subsystems[name] = st
+	}
+
+	store := s.table()
+	switch {
+	case s.loading.Load():
+		set("startup", false, "loading data")
+	case !s.isReady.Load():
+		set("startup", false, "marked not ready")
+	default:
+		set("startup", true, "")
+	}
+	set("capacity", s.capacityReady(), fmt.Sprintf("%d of %d bytes used", store.Size(), store.MaxSize()))
+	if l, ok := storage.Underlying(store).(interface{ Err() error }); ok {
+		err := l.Err()
+		detail := ""
+		if err != nil {
+			detail = err.Error()
+		}
+		set("log", err == nil, detail)
+	}
+	return report
+}
+
+// readyHandler serves /health/ready: 200 when every subsystem is healthy,
+// otherwise 503, with a JSON body saying which one is not
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	report := s.readinessReport()
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// gateLoading answers 503 for everything but health, ping and metrics while a
+// startup load is in progress, so nothing reads a half-loaded store
+func (s *Server) gateLoading(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.loading.Load() {
+			switch r.URL.Path {
+			case "/health", "/health/ready", "/ping", "/metrics":
+			default:
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "Loading data, try again shortly", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+func TestReadinessGate(t *testing.T) {
+	start := time.Unix(1000, 0)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	t.Run("transient", func(t *testing.T) {
+		g := &readinessGate{grace: 10 * time.Second}
+		for _, step := range []struct {
+			at        time.Duration
+			condition bool
+		}{
+			{0, true}, {5 * time.Second, true}, {9 * time.Second, false}, {15 * time.Second, true}, {24 * time.Second, true},
+		} {
+			if !g.observe(at(step.at), step.condition) {
+				t.Fatalf("unready at %v: a condition shorter than the grace period must not flip the gate", step.at)
+			}
+		}
+	})
+
+	t.Run("sustained", func(t *testing.T) {
+		g := &readinessGate{grace: 10 * time.Second}
+		if !g.observe(at(0), true) || !g.observe(at(9*time.Second), true) {
+			t.Fatal("unready before the grace period elapsed")
+		}
+		if g.observe(at(10*time.Second), true) {
+			t.Fatal("still ready after the condition held for the grace period")
+		}
+
+		// Recovery is debounced the same way
+		if g.observe(at(11*time.Second), false) || g.observe(at(20*time.Second), false) {
+			t.Fatal("ready again before the condition cleared for the grace period")
+		}
+		if g.observe(at(21*time.Second), true) {
+			t.Fatal("ready after a relapse")
+		}
+		if g.observe(at(25*time.Second), false) || !g.observe(at(35*time.Second), false) {
+			t.Fatal("want ready only once the condition stayed clear for the whole grace period")
+		}
+	})
+}
+
+// While a slow startup load runs, liveness stays up, readiness and data
+// endpoints answer 503, and everything flips once the loaded store is swapped in
+func TestSlowStartupLoad(t *testing.T) {
+	s, ts := newTestServer(t, newTestStore())
+	s.SetLoading(true)
+
+	loaded := make(chan struct{})
+	go func() {
+		defer close(loaded)
+		table := newTestStore()
+		time.Sleep(100 * time.Millisecond) // a long replay
+		table.Put("EU-A1", storage.DataEntry{LocationId: "EU-A1", ModificationCount: 1})
+		s.SwapStore(table)
+		s.SetLoading(false)
+	}()
+
+	resp, body := do(t, ts, http.MethodGet, "/health", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodGet, "/health/ready", "")
+	wantStatus(t, resp, body, http.StatusServiceUnavailable)
+	var report readinessReport
+	decode(t, body, &report)
+	if st := report.Subsystems["startup"]; st.Healthy || st.Detail != "loading data" {
+		t.Errorf("startup subsystem = %+v, want unhealthy while loading", st)
+	}
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusServiceUnavailable)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("503 during load has no Retry-After")
+	}
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusServiceUnavailable)
+
+	<-loaded
+	resp, body = do(t, ts, http.MethodGet, "/health/ready", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+}
+
+func TestLivenessIgnoresCapacity(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store, WithCapacityReadiness(0.000001, 0))
+	store.Put("EU-A1", storage.DataEntry{LocationId: "EU-A1", ModificationCount: 1})
+
+	resp, body := do(t, ts, http.MethodGet, "/health/ready", "")
+	wantStatus(t, resp, body, http.StatusServiceUnavailable)
+	resp, body = do(t, ts, http.MethodGet, "/health", "")
+	wantStatus(t, resp, body, http.StatusOK)
+}
+
+// A log that can no longer be written makes the node unready, and the report
+// names the log as the cause
+func TestReadinessFailedLog(t *testing.T) {
+	ls, err := storage.OpenLogStore(filepath.Join(t.TempDir(), "data.log"), newTestStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ts := newTestServer(t, ls)
+
+	resp, body := do(t, ts, http.MethodGet, "/health/ready", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var report readinessReport
+	decode(t, body, &report)
+	if st, ok := report.Subsystems["log"]; !ok || !st.Healthy {
+		t.Fatalf("log subsystem = %+v (present %v), want healthy", st, ok)
+	}
+
+	ls.Close() // every append from here on fails
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	if resp.StatusCode < 500 {
+		t.Fatalf("PUT after the log failed: status %d, want a server error", resp.StatusCode)
+	}
+
+	resp, body = do(t, ts, http.MethodGet, "/health/ready", "")
+	wantStatus(t, resp, body, http.StatusServiceUnavailable)
+	report = readinessReport{}
+	decode(t, body, &report)
+	if report.Ready {
+		t.Error("report says ready with a failed log")
+	}
+	if st := report.Subsystems["log"]; st.Healthy || st.Detail == "" {
+		t.Errorf("log subsystem = %+v, want unhealthy with the error", st)
+	}
+	if st := report.Subsystems["capacity"]; !st.Healthy {
+		t.Errorf("capacity subsystem = %+v, want it unaffected", st)
+	}
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// How long a computed region list is served before rescanning
+const regionsCacheTTL = 10 * time.Second
+
+// regionCache holds the last /regions scan. Counts may lag by up to the TTL,
+// but a write introducing a new region drops the cache (via the change feed)
+// so the region shows up straight away. The feed is lossy, so under a burst a
+// new region can still take up to the TTL to appear.
+//
+// mu is never held during a scan: the scan fills a fresh map that is swapped
+// in afterwards, and installed maps are never modified.
+type regionCache struct {
+	mu          sync.Mutex
+	store       storage.Store  // store the cache and subscription belong to
+	counts      map[string]int // nil once invalidated or before the first scan
+	known       map[string]int // last installed counts, kept when invalidated
+	missed      map[string]bool
+	expires     time.Time
+	unsubscribe func()
+}
+
+// watch invalidates the cache when store gains a region it doesn't list
+func (c *regionCache) watch(store storage.Store, events <-chan storage.ChangeEvent) {
+	for ev := range events {
+		if ev.Type != storage.ChangePut {
+			continue
+		}
+		region := storage.RegionOf(ev.Key)
+		c.mu.Lock()
+		if c.store == store && c.known[region] == 0 {
+			// Remembered so a scan already under way that missed it isn't cached
+			c.counts = nil
+			if c.missed == nil {
+				c.missed = make(map[string]bool)
+			}
+			c.missed[region] = true
+		}
+		c.mu.Unlock()
+	}
+}
+
+// regionsHandler serves GET /regions: every distinct key prefix (the part
+// before the first '-') with its entry count, for building region pickers
+// without fetching every key. Regions are capped at maxResults; a truncated
+// page carries the cursor to continue from, as in /range.
+func (s *Server) regionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	store := s.table()
+	c := &s.regions
+
+	c.mu.Lock()
+	if c.store != store {
+		// First call, or SwapStore replaced the dataset
+		if c.unsubscribe != nil {
+			c.unsubscribe()
+		}
+		events, unsubscribe := store.Subscribe()
+		c.store, c.counts, c.known, c.missed, c.unsubscribe = store, nil, nil, nil, unsubscribe
+		go c.watch(store, events)
+	}
+	counts := c.counts
+	if time.Now().After(c.expires) {
+		counts = nil
+	}
+	c.mu.Unlock()
+
+	if counts == nil {
+		if !s.acquireScan(w, r) {
+			return
+		}
+		counts = make(map[string]int)
+		store.ForEach(func(key string, _ storage.DataEntry) bool {
+			counts[storage.RegionOf(key)]++
+			return true
+		})
+		s.releaseScan()
+		c.install(store, counts)
+	}
+
+	regions, cursor := s.regionPage(counts, r.URL.Query().Get("cursor"))
+	if cursor != "" {
+		markTruncated(w, cursor)
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"regions":   regions,
+		"count":     len(regions),
+		"truncated": cursor != "",
+		"cursor":    cursor,
+	}, false)
+}
+
+// install caches counts scanned from store, unless the store has been swapped
+// since or a region that appeared during the scan is missing from them
+func (c *regionCache) install(store storage.Store, counts map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store != store {
+		return
+	}
+	missed := c.missed
+	c.missed = nil
+	for region := range missed {
+		if counts[region] == 0 {
+			return
+		}
+	}
+	c.counts, c.known, c.expires = counts, counts, time.Now().Add(regionsCacheTTL)
+}
+
+// regionPage returns the regions sorting at or after from, capped at
+// maxResults, and the first region left out when the cap was hit
+func (s *Server) regionPage(counts map[string]int, from string) (map[string]int, string) {
+	if s.maxResults <= 0 && from == "" {
+		return counts, ""
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		if name >= from {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	cursor := ""
+	if s.maxResults > 0 && len(names) > s.maxResults {
+		names, cursor = names[:s.maxResults], names[s.maxResults]
+	}
+	page := make(map[string]int, len(names))
+	for _, name := range names {
+		page[name] = counts[name]
+	}
+	return page, cursor
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// pausedScanStore reads the table at the start of ForEach, then waits for
+// release before handing the entries over, like a long scan that misses
+// writes landing while it runs
+type pausedScanStore struct {
+	storage.Store
+	scanning chan struct{}
+	release  chan struct{}
+}
+
+func (p pausedScanStore) ForEach(fn func(string, storage.DataEntry) bool) {
+	var keys []string
+	var entries []storage.DataEntry
+	p.Store.ForEach(func(key string, e storage.DataEntry) bool {
+		keys, entries = append(keys, key), append(entries, e)
+		return true
+	})
+	p.scanning <- struct{}{}
+	<-p.release
+	for i := range keys {
+		if !fn(keys[i], entries[i]) {
+			return
+		}
+	}
+}
+
+func TestRegionsScanOutsideCacheLock(t *testing.T) {
+	table := newTestStore()
+	putKeys(t, table, "EU-1", "EU-2")
+	store := pausedScanStore{table, make(chan struct{}), make(chan struct{})}
+	s, ts := newTestServer(t, store)
+
+	type page struct {
+		Regions map[string]int `json:"regions"`
+	}
+	first := make(chan page, 1)
+	go func() {
+		var p page
+		if resp, err := ts.Client().Get(ts.URL + "/regions"); err == nil {
+			json.NewDecoder(resp.Body).Decode(&p)
+			resp.Body.Close()
+		}
+		first <- p
+	}()
+	<-store.scanning
+
+	if !s.regions.mu.TryLock() {
+		t.Fatal("the region cache lock is held during the store scan")
+	}
+	s.regions.mu.Unlock()
+
+	// A new region lands while the scan runs; the watcher must see it
+	putKeys(t, table, "US-1")
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.regions.mu.Lock()
+		seen := s.regions.missed["US"]
+		s.regions.mu.Unlock()
+		if seen {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the change feed never reported the new region")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	store.release <- struct{}{}
+	if p := <-first; p.Regions["EU"] != 2 || p.Regions["US"] != 0 {
+		t.Fatalf("scan started before the write returned %v, want EU:2 only", p.Regions)
+	}
+
+	// That scan missed US, so it must not have been cached
+	go func() {
+		<-store.scanning
+		store.release <- struct{}{}
+	}()
+	var p page
+	resp, body := do(t, ts, http.MethodGet, "/regions", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &p)
+	if p.Regions["US"] != 1 || p.Regions["EU"] != 2 {
+		t.Errorf("second request returned %v, want the rescanned EU:2 US:1", p.Regions)
+	}
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"net/http"
+	"strings"
+)
+
+// endpointInfo is one line of the API index served at /
+type endpointInfo struct {
+	Path        string `json:"path"`
+	Methods     string `json:"methods"`
+	Description string `json:"description"`
+}
+
+// endpoints lists the routes Handler has registered, for the API index. Admin
+// routes are left out when they are served on a separate listener.
+func (s *Server) endpoints() []endpointInfo {
+	list := []endpointInfo{
+		{"/{key}", strings.Join(keyMethods, ", "), "Read, write, merge-patch or delete one location's reading"},
+		{"/{key}/history", "GET", "Retained readings for a key, oldest first"},
+		{"/{key}/aggregate", "GET", "Windowed aggregates over a key's history"},
+		{"/range", "GET", "Entries with keys in [start, end)"},
+		{"/prefix/{prefix}", "GET", "Entries whose keys start with prefix"},
+		{"/regions", "GET", "Known region prefixes"},
+		{"/batch", "POST", "Independent puts and deletes with per-record results"},
+		{"/txn", "POST", "All-or-nothing puts and deletes"},
+		{"/export", "GET", "Every entry as NDJSON"},
+		{"/export.csv", "GET", "Every entry as CSV"},
+		{"/import", "POST", "Load entries from NDJSON; ?on_error=skip passes over bad lines"},
+		{"/changes", "GET", "Change feed as server-sent events"},
+		{"/ws", "GET", "Change feed over WebSocket"},
+		{"/health", "GET", "Liveness"},
+		{"/health/ready", "GET", "Readiness, per subsystem"},
+		{"/ping", "GET", "Server time, for clock checks"},
+	}
+	if s.raw != nil {
+		list = append(list, endpointInfo{"/raw/{key}", strings.Join(rawMethods, ", "), "Opaque byte values"})
+	}
+	if s.separateAdmin {
+		return list
+	}
+	list = append(list,
+		endpointInfo{"/metrics", "GET", "Store and server counters"},
+		endpointInfo{"/admin/compact", "POST", "Rebuild segment maps to free memory and compact the data file"},
+		endpointInfo{"/admin/verify-size", "GET", "Recompute the store size"},
+		endpointInfo{"/admin/purge", "DELETE", "Remove entries older than ?older_than"},
+		endpointInfo{"/admin/clear", "DELETE", "Remove every entry"},
+	)
+	if s.audit != nil {
+		list = append(list, endpointInfo{"/admin/audit", "GET", "Recent writes and deletes"})
+	}
+	if s.faults != nil {
+		list = append(list, endpointInfo{"/admin/faults", "GET, POST", "Fault injection settings"})
+	}
+	if s.debug {
+		list = append(list,
+			endpointInfo{"/admin/inspect/{key}", "GET", "A key's internal metadata"},
+			endpointInfo{"/admin/config", "GET", "Effective server and store configuration, secrets redacted"},
+			endpointInfo{"/debug/memstats", "GET", "Go runtime memory stats"},
+		)
+	}
+	return list
+}
+
+// handleRoot answers requests for / itself, which names no key. GET and HEAD
+// get the API index unless it is turned off; everything else, and GET too
+// when the index is off, gets 400 since a key is required.
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if s.rootIndex && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"service":   "Pandora's Data Hub",
+			"endpoints": s.endpoints(),
+		}, r.URL.Query().Get("pretty") == "true")
+		return
+	}
+	http.Error(w, "Key required, e.g. /EU-A1", http.StatusBadRequest)
+}
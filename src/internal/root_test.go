@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRootIndex(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore(), WithAuditLog(4))
+	resp, body := do(t, ts, http.MethodGet, "/", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var index struct {
+		Endpoints []endpointInfo `json:"endpoints"`
+	}
+	decode(t, body, &index)
+	listed := map[string]bool{}
+	for _, e := range index.Endpoints {
+		listed[e.Path] = true
+	}
+	for _, path := range []string{"/{key}", "/range", "/export", "/admin/purge", "/admin/audit"} {
+		if !listed[path] {
+			t.Errorf("index leaves out %s", path)
+		}
+	}
+	if listed["/admin/faults"] || listed["/admin/inspect/{key}"] {
+		t.Errorf("index lists routes that aren't registered: %v", listed)
+	}
+
+	resp, body = do(t, ts, http.MethodHead, "/", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	// Only GET and HEAD read the index; anything else still needs a key
+	for _, method := range []string{http.MethodPut, http.MethodDelete, http.MethodPost} {
+		resp, body := do(t, ts, method, "/", testReading)
+		wantStatus(t, resp, body, http.StatusBadRequest)
+	}
+
+	// Admin routes served elsewhere aren't listed on the data listener
+	_, ts = newTestServer(t, newTestStore(), WithSeparateAdmin())
+	resp, body = do(t, ts, http.MethodGet, "/", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &index)
+	for _, e := range index.Endpoints {
+		if e.Path == "/metrics" || e.Path == "/admin/purge" {
+			t.Errorf("index lists %s with admin routes on a separate listener", e.Path)
+		}
+	}
+}
+
+func TestRootIndexOff(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore(), WithRootIndex(false))
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		resp, body := do(t, ts, method, "/", "")
+		wantStatus(t, resp, body, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"math"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// MaxReadingPrecision is the most decimals readings can be rounded to. A
+// float32 holds about seven significant digits, so more would change nothing,
+// and a large enough scale overflows to NaN.
+const MaxReadingPrecision = 7
+
+// roundReadings returns data with its sensor readings rounded to places
+// decimals, for display only. encoding/json writes a float32 as the shortest
+// decimal that round-trips, so a rounded value comes out as e.g. 23.4 rather
+// than 23.399999.
+func roundReadings(data storage.DataEntry, places int) storage.DataEntry {
+	scale := math.Pow(10, float64(places))
+	round := func(v float32) float32 {
+		return float32(math.Round(float64(v)*scale) / scale)
+	}
+	data.SeismicActivity = round(data.SeismicActivity)
+	data.TemperatureC = round(data.TemperatureC)
+	data.RadiationLevel = round(data.RadiationLevel)
+	return data
+}
+
+// shown is entry as read endpoints serve it, rounded under WithReadingPrecision
+func (s *Server) shown(entry storage.DataEntry) storage.DataEntry {
+	if s.readingPlaces < 0 {
+		return entry
+	}
+	return roundReadings(entry, s.readingPlaces)
+}
+
+// shownAll is shown for a list of entries. The list is copied rather than
+// rounded in place, since it may share storage with the store.
+func (s *Server) shownAll(entries []storage.DataEntry) []storage.DataEntry {
+	if s.readingPlaces < 0 {
+		return entries
+	}
+	out := make([]storage.DataEntry, len(entries))
+	for i, entry := range entries {
+		out[i] = roundReadings(entry, s.readingPlaces)
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storepb"
+)
+
+// testReading with a temperature that rounds visibly to one decimal
+const preciseReading = `{"id":"6f1c2d3e-4b5a-4c6d-8e7f-901a2b3c4d5e","seismic_activity":1.5,"temperature_c":21.256,"radiation_level":0.5}`
+
+// Every read endpoint rounds when a precision is set and passes the stored
+// value through untouched when it isn't
+func TestReadingPrecision(t *testing.T) {
+	reads := []string{"/EU-A1", "/EU-A1/history", "/range?start=EU-A&end=EU-Z", "/prefix/EU-", "/export", "/export.csv"}
+	for _, tc := range []struct {
+		name         string
+		places       int
+		want, unwant string
+		grpcWant     float32
+	}{
+		{"exact", -1, "21.256", "21.3", 21.256},
+		{"rounded", 1, "21.3", "21.256", 21.3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newTestStore(storage.WithHistory(4))
+			s, ts := newTestServer(t, store, WithReadingPrecision(tc.places))
+			resp, body := do(t, ts, "PUT", "/EU-A1", preciseReading)
+			wantStatus(t, resp, body, 201)
+
+			for _, path := range reads {
+				resp, body := do(t, ts, "GET", path, "")
+				wantStatus(t, resp, body, 200)
+				if !strings.Contains(body, tc.want) || strings.Contains(body, tc.unwant) {
+					t.Errorf("GET %s = %q, want temperature %s", path, body, tc.want)
+				}
+			}
+
+			got, err := newGRPCClient(t, s).Get(context.Background(), &storepb.GetRequest{Key: "EU-A1"})
+			if err != nil {
+				t.Fatalf("gRPC Get: %v", err)
+			}
+			if temp := got.GetEntry().GetTemperatureC(); temp != tc.grpcWant {
+				t.Errorf("gRPC Get temperature = %v, want %v", temp, tc.grpcWant)
+			}
+
+			stored, _ := store.Get("EU-A1")
+			if stored.TemperatureC != 21.256 {
+				t.Errorf("stored temperature = %v, want 21.256 untouched", stored.TemperatureC)
+			}
+		})
+	}
+}
+
+// A precision too large to scale by would round every reading to NaN, so the
+// option ignores it rather than failing every GET
+func TestReadingPrecisionOutOfRange(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore(), WithReadingPrecision(400))
+	resp, body := do(t, ts, "PUT", "/EU-A1", preciseReading)
+	wantStatus(t, resp, body, 201)
+	resp, body = do(t, ts, "GET", "/EU-A1", "")
+	wantStatus(t, resp, body, 200)
+	if !strings.Contains(body, "21.256") {
+		t.Errorf("GET = %q, want the exact temperature", body)
+	}
+}
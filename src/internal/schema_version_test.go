@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// schemaVersionOf GETs key and returns its schema_version
+func schemaVersionOf(t *testing.T, ts *httptest.Server, key string) int {
+	t.Helper()
+	resp, body := do(t, ts, http.MethodGet, "/"+key, "")
+	wantStatus(t, resp, body, http.StatusOK)
+	var got struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	decode(t, body, &got)
+	return got.SchemaVersion
+}
+
+func TestSchemaVersionRoundTrips(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading, "X-Schema-Version", "3")
+	wantStatus(t, resp, body, http.StatusCreated)
+	if got := schemaVersionOf(t, ts, "EU-A1"); got != 3 {
+		t.Errorf("schema_version = %d, want the 3 sent", got)
+	}
+
+	// A PATCH that doesn't declare one leaves it alone
+	resp, body = do(t, ts, http.MethodPatch, "/EU-A1", `{"temperature_c":30}`, "Content-Type", mergePatchType)
+	wantStatus(t, resp, body, http.StatusOK)
+	if got := schemaVersionOf(t, ts, "EU-A1"); got != 3 {
+		t.Errorf("schema_version = %d after a PATCH, want 3 kept", got)
+	}
+
+	// A PUT that doesn't declare one records the default
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	if got := schemaVersionOf(t, ts, "EU-A1"); got != storage.DefaultSchemaVersion {
+		t.Errorf("schema_version = %d after a PUT without the header, want %d", got, storage.DefaultSchemaVersion)
+	}
+
+	for _, bad := range []string{"0", "-1", "v2"} {
+		resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading, "X-Schema-Version", bad)
+		wantStatus(t, resp, body, http.StatusBadRequest)
+	}
+}
+
+// Entries created without a declared version get the default whichever route
+// wrote them, and /batch and /txn record the version their request declares
+func TestSchemaVersionDefaultsOnEveryWritePath(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store)
+
+	resp, body := do(t, ts, http.MethodPost, "/batch", `{"ops":[{"op":"put","key":"EU-B1","entry":`+testReading+`}]}`)
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodPost, "/txn", `{"ops":[{"op":"put","key":"EU-T1","entry":`+testReading+`}]}`)
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodPost, "/import", importLine("EU-I1"))
+	wantStatus(t, resp, body, http.StatusOK)
+	store.Put("EU-S1", storage.DataEntry{LocationId: "EU-S1", ModificationCount: 1})
+	store.PutBatch([]storage.BatchRecord{{Key: "EU-S2", Entry: storage.DataEntry{LocationId: "EU-S2", ModificationCount: 1}}})
+	for _, key := range []string{"EU-B1", "EU-T1", "EU-I1", "EU-S1", "EU-S2"} {
+		if got := schemaVersionOf(t, ts, key); got != storage.DefaultSchemaVersion {
+			t.Errorf("%s schema_version = %d, want %d", key, got, storage.DefaultSchemaVersion)
+		}
+	}
+
+	resp, body = do(t, ts, http.MethodPost, "/batch", `{"ops":[{"op":"put","key":"EU-B1","entry":`+testReading+`}]}`, "X-Schema-Version", "4")
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodPost, "/txn", `{"ops":[{"op":"put","key":"EU-T1","entry":`+testReading+`}]}`, "X-Schema-Version", "4")
+	wantStatus(t, resp, body, http.StatusOK)
+	for _, key := range []string{"EU-B1", "EU-T1"} {
+		if got := schemaVersionOf(t, ts, key); got != 4 {
+			t.Errorf("%s schema_version = %d, want the 4 declared", key, got)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+// BatchRecord is one write in a PutBatch. Entry is stored as given unless Update
+// is set, in which case Update is handed the key's current entry (including one
+// written earlier in the same batch) and whatever it returns is stored, as with
+// Update. An error from Update fails that record alone.
+type BatchRecord struct {
+	Key    string
+	Entry  DataEntry
+	Update func(current DataEntry, exists bool) (DataEntry, error)
+}
+
+// PutBatch writes many records while taking sizeLock only once. Every segment the
+// batch touches is locked up front in index order, the combined size delta is
+// reserved in one go, and records are admitted in order until capacity runs out.
+// The returned slice has one error per record (nil on success); records that
+// didn't fit get ErrInsufficientMemory and leave no trace in the table.
+func (sht *SegmentedHashTable) PutBatch(records []BatchRecord) []error {
+	errs := make([]error, len(records))
+	if len(records) == 0 {
+		return errs
+	}
+	normalized := make([]BatchRecord, len(records))
+	for i, rec := range records {
+		normalized[i] = BatchRecord{Key: sht.NormalizeKey(rec.Key), Entry: rec.Entry.withDefaults(), Update: rec.Update}
+	}
+	records = normalized
+
+	if sht.evictSamples > 0 && !sht.unlimited() {
+		var incoming uint64
+		for _, rec := range records {
+			if !sht.has(rec.Key) {
+				incoming = sumSizes(incoming, sht.estimateSize(rec.Key, rec.Entry))
+			}
+		}
+		sht.evictUntilFits(incoming)
+	}
+
+	// Segments are locked in ascending index order so concurrent batches can't deadlock
+	keys := make([]string, len(records))
+	for i, rec := range records {
+		keys[i] = rec.Key
+	}
+	_, unlock := sht.lockSegments(keys, nil)
+	defer unlock()
+
+	now := sht.now()
+	if sht.historyLen > 0 || sht.quotas != nil {
+		// History grows each key's series and quotas need per-region checks, so
+		// fall back to per-record accounting while still holding every segment
+		// lock for the batch
+		for i, rec := range records {
+			segment := sht.getSegment(rec.Key)
+			current, exists := segment.data[rec.Key]
+			entry, err := rec.resolve(current, exists, now)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			_, errs[i] = sht.storeLocked(segment, rec.Key, entry)
+		}
+		return errs
+	}
+
+	// staged holds the entries admitted earlier in this batch, so a later record
+	// for the same key is charged against and updates from those rather than the
+	// table
+	staged := make(map[string]DataEntry)
+	entries := make([]DataEntry, len(records))
+	admitted := make([]bool, len(records))
+	rejected := 0
+
+	sht.sizeLock.Lock()
+	size := sht.currentSize
+	for i, rec := range records {
+		old, exists := staged[rec.Key]
+		if !exists {
+			old, exists = sht.getSegment(rec.Key).data[rec.Key]
+		}
+		entry, err := rec.resolve(old, exists, now)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		var oldSize uint64
+		if exists {
+			oldSize = sht.estimateSize(rec.Key, old)
+		}
+		newSize := sht.estimateSize(rec.Key, entry)
+		if newSize > oldSize && !sht.fitsLocked(size, newSize-oldSize) {
+			errs[i] = ErrInsufficientMemory
+			rejected++
+			continue
+		}
+		size = size - oldSize + newSize
+		staged[rec.Key] = entry
+		entries[i] = entry
+		admitted[i] = true
+	}
+	sht.currentSize = size
+	sht.sizeLock.Unlock()
+
+	for i := 0; i < rejected; i++ {
+		sht.recordRejection()
+	}
+	for i, rec := range records {
+		if !admitted[i] {
+			continue
+		}
+		entry := entries[i]
+		entry.LastUpdated = now
+		entry.slide = 0
+		if entry.ExpiresAt == 0 && sht.defaultTTL > 0 {
+			entry.ExpiresAt = now + int64(sht.defaultTTL)
+		}
+		segment := sht.getSegment(rec.Key)
+		if _, exists := segment.data[rec.Key]; !exists {
+			segment.count.Add(1)
+		}
+		segment.ownLocked()
+		segment.data[rec.Key] = entry
+		sht.emit(ChangeEvent{Type: ChangePut, Key: rec.Key, Entry: &entry})
+	}
+	return errs
+}
+
+// resolve returns the entry rec stores over current. An expired current entry
+// is shown to Update as missing, the same as Update on the table does.
+func (rec BatchRecord) resolve(current DataEntry, exists bool, now int64) (DataEntry, error) {
+	if rec.Update == nil {
+		return rec.Entry, nil
+	}
+	if exists && current.expired(now) {
+		current, exists = DataEntry{}, false
+	}
+	next, err := rec.Update(current, exists)
+	if err != nil {
+		return DataEntry{}, err
+	}
+	return next.withDefaults(), nil
+}
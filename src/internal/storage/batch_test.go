@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// checkBatch compares PutBatch's errors with want and checks that exactly the
+// records that succeeded are in table
+func checkBatch(t *testing.T, table *SegmentedHashTable, records []BatchRecord, errs []error, want []error) {
+	t.Helper()
+	for i, rec := range records {
+		if errs[i] != want[i] {
+			t.Errorf("record %d (%s): got %v, want %v", i, rec.Key, errs[i], want[i])
+		}
+		if _, ok := stored(table, rec.Key); ok != (want[i] == nil) {
+			t.Errorf("%s stored = %v, want %v", rec.Key, ok, want[i] == nil)
+		}
+	}
+	if tracked, actual, ok := table.VerifySize(); !ok {
+		t.Errorf("VerifySize = %d tracked, %d actual after a partial batch", tracked, actual)
+	}
+}
+
+// A batch that runs out of capacity partway keeps the records that fit, in
+// order, and bills only those
+func TestPutBatchPartialCapacity(t *testing.T) {
+	table := NewSegmentedHashTable(4, 300, WithSizeEstimator(flatSize))
+	fill(t, table, 1)
+
+	records := []BatchRecord{
+		{Key: "EU-1", Entry: testEntry("EU-1")},
+		{Key: "EU-2", Entry: testEntry("EU-2")},
+		{Key: "EU-3", Entry: testEntry("EU-3")},
+		{Key: "EU-0", Entry: testEntry("EU-0")}, // overwrites in place, so still fits
+		{Key: "EU-4", Entry: testEntry("EU-4")},
+	}
+	errs := table.PutBatch(records)
+	checkBatch(t, table, records, errs, []error{nil, nil, ErrInsufficientMemory, nil, ErrInsufficientMemory})
+
+	if got := table.Size(); got != 300 {
+		t.Errorf("Size() = %d, want 300", got)
+	}
+	if got := table.Count(); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+	if got := table.RejectedWrites(); got != 2 {
+		t.Errorf("RejectedWrites() = %d, want 2", got)
+	}
+}
+
+// A region quota hit partway through a batch only refuses that region's later
+// records
+func TestPutBatchPartialQuota(t *testing.T) {
+	table := NewSegmentedHashTable(4, 10000, WithSizeEstimator(flatSize),
+		WithRegionQuotas(map[string]uint64{"EU": 200}))
+
+	records := []BatchRecord{
+		{Key: "EU-1", Entry: testEntry("EU-1")},
+		{Key: "US-1", Entry: testEntry("US-1")},
+		{Key: "EU-2", Entry: testEntry("EU-2")},
+		{Key: "EU-3", Entry: testEntry("EU-3")},
+		{Key: "US-2", Entry: testEntry("US-2")},
+	}
+	errs := table.PutBatch(records)
+	checkBatch(t, table, records, errs, []error{nil, nil, nil, ErrQuotaExceeded, nil})
+
+	if got := table.Size(); got != 400 {
+		t.Errorf("Size() = %d, want 400", got)
+	}
+	if usage := table.RegionUsage(); usage["EU"] != 200 || usage["US"] != 200 {
+		t.Errorf("RegionUsage() = %v, want EU:200 US:200", usage)
+	}
+}
+
+// An Update record sees what earlier records in the same batch wrote, and its
+// error fails only that record, on both the single-lock and per-record paths
+func TestPutBatchUpdate(t *testing.T) {
+	errRefused := errors.New("refused")
+	bump := func(current DataEntry, exists bool) (DataEntry, error) {
+		if !exists {
+			return testEntry("EU-1"), nil
+		}
+		current.ModificationCount++
+		return current, nil
+	}
+	refuse := func(DataEntry, bool) (DataEntry, error) { return DataEntry{}, errRefused }
+
+	tables := map[string]*SegmentedHashTable{
+		"single lock": NewSegmentedHashTable(4, 10000, WithSizeEstimator(flatSize)),
+		"per record":  NewSegmentedHashTable(4, 10000, WithSizeEstimator(flatSize), WithRegionQuotas(map[string]uint64{"EU": 1000})),
+	}
+	for name, table := range tables {
+		t.Run(name, func(t *testing.T) {
+			errs := table.PutBatch([]BatchRecord{
+				{Key: "EU-1", Update: bump},
+				{Key: "EU-2", Update: refuse},
+				{Key: "EU-1", Update: bump},
+			})
+			if errs[0] != nil || errs[1] != errRefused || errs[2] != nil {
+				t.Fatalf("errs = %v, want [nil refused nil]", errs)
+			}
+			entry, err := table.Get("EU-1")
+			if err != nil || entry.ModificationCount != 2 {
+				t.Errorf("Get(EU-1) = %+v, %v; want ModificationCount 2", entry, err)
+			}
+			if _, ok := stored(table, "EU-2"); ok {
+				t.Error("EU-2 stored after its Update failed")
+			}
+			if got := table.Size(); got != 100 {
+				t.Errorf("Size() = %d, want 100", got)
+			}
+		})
+	}
+}
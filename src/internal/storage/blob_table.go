@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Smallest pooled buffer handed to a blob; sizes round up to powers of two
+// from here so a handful of PoolManager classes cover every value size
+const minBlobClass = 64
+
+// blob is a value held in a pooled buffer; only the first n bytes are data
+type blob struct {
+	buf *[]byte
+	n   int
+}
+
+type blobSegment struct {
+	data map[string]blob
+	mu   sync.RWMutex
+}
+
+// BlobTable is the untyped sibling of SegmentedHashTable for general key/value
+// use: opaque []byte values, the same fnv1a segmenting and the same maxSize
+// accounting (ErrInsufficientMemory when full). Values live in buffers drawn
+// from a PoolManager and are returned to it on overwrite or delete.
+type BlobTable struct {
+	segments    []*blobSegment
+	segmentMask uint64
+	maxSize     uint64 // 0 means unlimited
+	currentSize uint64
+	count       int
+	sizeLock    sync.Mutex
+	pool        *PoolManager
+}
+
+// NewBlobTable builds a table of numSegments segments (rounded up to a power of
+// two) holding at most maxSizeBytes
+func NewBlobTable(numSegments int, maxSizeBytes uint64, pool *PoolManager) *BlobTable {
+	if numSegments <= 0 {
+		numSegments = 1
+	}
+	numSegments = 1 << bits.Len(uint(numSegments-1))
+	bt := &BlobTable{
+		segments:    make([]*blobSegment, numSegments),
+		segmentMask: uint64(numSegments - 1),
+		maxSize:     maxSizeBytes,
+		pool:        pool,
+	}
+	for i := range bt.segments {
+		bt.segments[i] = &blobSegment{data: make(map[string]blob)}
+	}
+	return bt
+}
+
+func blobClass(n int) int {
+	if n <= minBlobClass {
+		return minBlobClass
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// blobCharge is what a value is billed against maxSize: its whole pooled buffer
+func blobCharge(key string, b blob) uint64 {
+	return 100 + uint64(len(key)) + uint64(cap(*b.buf))
+}
+
+func (bt *BlobTable) segment(key string) *blobSegment {
+	return bt.segments[fnv1a(key)&bt.segmentMask]
+}
+
+// Get returns a copy of the value, safe to keep after the key changes
+func (bt *BlobTable) Get(key string) ([]byte, error) {
+	seg := bt.segment(key)
+	seg.mu.RLock()
+	defer seg.mu.RUnlock()
+
+	b, ok := seg.data[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	out := make([]byte, b.n)
+	copy(out, (*b.buf)[:b.n])
+	return out, nil
+}
+
+// Put copies value into a pooled buffer and stores it under key
+func (bt *BlobTable) Put(key string, value []byte) error {
+	buf := bt.pool.GetBuffer(blobClass(len(value)))
+	copy(*buf, value)
+	nb := blob{buf: buf, n: len(value)}
+
+	seg := bt.segment(key)
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+
+	old, exists := seg.data[key]
+	var oldCharge uint64
+	if exists {
+		oldCharge = blobCharge(key, old)
+	}
+	newCharge := blobCharge(key, nb)
+
+	bt.sizeLock.Lock()
+	grown, ok := addSize(bt.currentSize, newCharge-min(newCharge, oldCharge))
+	if !ok || bt.maxSize > 0 && grown > bt.maxSize {
+		bt.sizeLock.Unlock()
+		bt.pool.PutBuffer(buf)
+		return ErrInsufficientMemory
+	}
+	bt.currentSize = bt.currentSize - oldCharge + newCharge
+	if !exists {
+		bt.count++
+	}
+	bt.sizeLock.Unlock()
+
+	seg.data[key] = nb
+	if exists {
+		bt.pool.PutBuffer(old.buf)
+	}
+	return nil
+}
+
+func (bt *BlobTable) Delete(key string) error {
+	seg := bt.segment(key)
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+
+	b, ok := seg.data[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	delete(seg.data, key)
+
+	bt.sizeLock.Lock()
+	bt.currentSize -= blobCharge(key, b)
+	bt.count--
+	bt.sizeLock.Unlock()
+
+	bt.pool.PutBuffer(b.buf)
+	return nil
+}
+
+// Size returns the bytes currently charged against maxSize
+func (bt *BlobTable) Size() uint64 {
+	bt.sizeLock.Lock()
+	defer bt.sizeLock.Unlock()
+	return bt.currentSize
+}
+
+func (bt *BlobTable) MaxSize() uint64 {
+	return bt.maxSize
+}
+
+func (bt *BlobTable) Count() int {
+	bt.sizeLock.Lock()
+	defer bt.sizeLock.Unlock()
+	return bt.count
+}
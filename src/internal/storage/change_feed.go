@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type ChangeType string
+
+const (
+	ChangePut    ChangeType = "put"
+	ChangeDelete ChangeType = "delete"
+)
+
+type ChangeEvent struct {
+	Type  ChangeType `json:"type"`
+	Key   string     `json:"key"`
+	Entry *DataEntry `json:"entry,omitempty"` // nil for deletes
+}
+
+// Buffer per subscriber; once full the oldest pending event is dropped
+const changeFeedBuffer = 256
+
+// changeFeed fans store mutations out to subscribers. Delivery is at-most-once
+// and lossy: a subscriber that can't keep up loses its oldest events instead of
+// slowing down writers.
+type changeFeed struct {
+	mu      sync.RWMutex
+	subs    map[int]chan ChangeEvent
+	nextID  int
+	dropped atomic.Uint64 // events lost to full subscriber buffers
+}
+
+// DroppedChanges returns how many change events subscribers have lost because
+// their buffer was full, counted once per subscriber per event
+func (sht *SegmentedHashTable) DroppedChanges() uint64 {
+	return sht.feed.dropped.Load()
+}
+
+// Subscribe registers a new change-feed listener. The returned cancel func must be
+// called to release it; the channel is closed once cancel returns.
+func (sht *SegmentedHashTable) Subscribe() (<-chan ChangeEvent, func()) {
+	feed := &sht.feed
+	ch := make(chan ChangeEvent, changeFeedBuffer)
+
+	feed.mu.Lock()
+	if feed.subs == nil {
+		feed.subs = make(map[int]chan ChangeEvent)
+	}
+	id := feed.nextID
+	feed.nextID++
+	feed.subs[id] = ch
+	feed.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			feed.mu.Lock()
+			delete(feed.subs, id)
+			feed.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// publish never blocks; callers may hold a segment lock
+func (f *changeFeed) publish(ev ChangeEvent) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, ch := range f.subs {
+		select {
+		case ch <- ev:
+			continue
+		default:
+		}
+		// Subscriber is full: drop the oldest event and retry once
+		select {
+		case <-ch:
+			f.dropped.Add(1)
+		default:
+		}
+		select {
+		case ch <- ev:
+		default:
+			f.dropped.Add(1)
+		}
+	}
+}
+
+// emit reports a mutation to the table's change hook and subscribers. Callers
+// hold the mutated key's segment lock, so events for a key arrive in order.
+func (sht *SegmentedHashTable) emit(ev ChangeEvent) {
+	if sht.onChange != nil {
+		sht.onChange(ev)
+	}
+	sht.feed.publish(ev)
+}
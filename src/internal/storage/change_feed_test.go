@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+// A subscriber that stops reading keeps the newest changeFeedBuffer events and
+// loses the oldest, and every loss is counted, without writers blocking
+func TestChangeFeedDropsOldest(t *testing.T) {
+	const extra = 10
+	table := NewSegmentedHashTable(4, 0)
+	events, cancel := table.Subscribe()
+	defer cancel()
+
+	fill(t, table, changeFeedBuffer+extra)
+	if got := table.DroppedChanges(); got != extra {
+		t.Errorf("DroppedChanges() = %d, want %d", got, extra)
+	}
+
+	for i := extra; i < changeFeedBuffer+extra; i++ {
+		ev := <-events
+		if want := fmt.Sprintf("EU-%d", i); ev.Key != want || ev.Type != ChangePut {
+			t.Fatalf("event %d = %s %s, want put %s", i-extra, ev.Type, ev.Key, want)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %s %s past the buffer", ev.Type, ev.Key)
+	default:
+	}
+
+	// Once drained it receives new events again, with nothing more dropped
+	table.Delete("EU-0")
+	if ev := <-events; ev.Type != ChangeDelete || ev.Key != "EU-0" {
+		t.Errorf("after draining got %s %s, want delete EU-0", ev.Type, ev.Key)
+	}
+	if got := table.DroppedChanges(); got != extra {
+		t.Errorf("DroppedChanges() = %d after draining, want still %d", got, extra)
+	}
+}
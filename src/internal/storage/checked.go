@@ -0,0 +1,47 @@
+package storage
+
+import "math/bits"
+
+// addSize returns a+b, or false when the sum would wrap past math.MaxUint64.
+// Size accounting goes through it so a corrupt counter or absurd estimate is
+// refused as ErrInsufficientMemory instead of wrapping under the capacity check.
+func addSize(a, b uint64) (uint64, bool) {
+	sum, carry := bits.Add64(a, b, 0)
+	return sum, carry == 0
+}
+
+// sumSizes adds up sizes, saturating at math.MaxUint64 so an overflowing total
+// still fails the capacity check
+func sumSizes(sizes ...uint64) uint64 {
+	var total uint64
+	for _, s := range sizes {
+		var ok bool
+		if total, ok = addSize(total, s); !ok {
+			return ^uint64(0)
+		}
+	}
+	return total
+}
+
+// fitsLocked reports whether need more bytes fit on top of used bytes and the
+// outstanding reservations. An unlimited table accepts anything that doesn't
+// overflow. Callers hold sizeLock.
+func (sht *SegmentedHashTable) fitsLocked(used, need uint64) bool {
+	total, ok := addSize(used, sht.reservedBytes)
+	if ok {
+		total, ok = addSize(total, need)
+	}
+	return ok && (sht.unlimited() || total <= sht.maxSize)
+}
+
+// releaseLocked takes n bytes off currentSize. Releasing more than is tracked
+// means the accounting has drifted, so the counter is clamped at zero and the
+// drift logged instead of wrapping to a size that refuses every write. Callers
+// hold sizeLock.
+func (sht *SegmentedHashTable) releaseLocked(n uint64) {
+	if n > sht.currentSize {
+		sht.logger.Warn("size accounting underflow", "released_bytes", n, "tracked_bytes", sht.currentSize)
+		n = sht.currentSize
+	}
+	sht.currentSize -= n
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAddSize(t *testing.T) {
+	cases := []struct {
+		a, b uint64
+		sum  uint64
+		ok   bool
+	}{
+		{1, 2, 3, true},
+		{math.MaxUint64 - 1, 1, math.MaxUint64, true},
+		{math.MaxUint64, 1, 0, false},
+		{math.MaxUint64 / 2, math.MaxUint64/2 + 2, 0, false},
+	}
+	for _, tc := range cases {
+		sum, ok := addSize(tc.a, tc.b)
+		if ok != tc.ok || ok && sum != tc.sum {
+			t.Errorf("addSize(%d, %d) = %d, %v, want %d, %v", tc.a, tc.b, sum, ok, tc.sum, tc.ok)
+		}
+	}
+	if got := sumSizes(math.MaxUint64-5, 3, 3); got != math.MaxUint64 {
+		t.Errorf("sumSizes past the top = %d, want it saturated", got)
+	}
+}
+
+// Sizes near the top of uint64 must be refused, not wrap under the capacity
+func TestSizeAccountingOverflow(t *testing.T) {
+	huge := func(key string, entry DataEntry) uint64 {
+		if key == "EU-huge" {
+			return math.MaxUint64 - 50
+		}
+		return 100
+	}
+	for _, tc := range []struct {
+		name     string
+		capacity uint64
+	}{
+		{"capped", math.MaxUint64 - 10},
+		{"unlimited", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			table := NewSegmentedHashTable(4, tc.capacity, WithSizeEstimator(huge))
+			fill(t, table, 1)
+			if err := table.Put("EU-huge", testEntry("EU-huge")); err != ErrInsufficientMemory {
+				t.Fatalf("Put of an entry that overflows the total: got %v, want ErrInsufficientMemory", err)
+			}
+			if err := table.Apply([]TxnOp{{Key: "EU-huge", Entry: testEntry("EU-huge")}}); err != ErrInsufficientMemory {
+				t.Errorf("Apply of an entry that overflows the total: got %v, want ErrInsufficientMemory", err)
+			}
+			errs := table.PutBatch([]BatchRecord{{Key: "EU-huge", Entry: testEntry("EU-huge")}})
+			if errs[0] != ErrInsufficientMemory {
+				t.Errorf("PutBatch of an entry that overflows the total: got %v, want ErrInsufficientMemory", errs[0])
+			}
+			if _, err := table.Reserve(math.MaxUint64 - 50); err != ErrInsufficientMemory {
+				t.Errorf("Reserve that overflows the total: got %v, want ErrInsufficientMemory", err)
+			}
+			if table.Size() != 100 || table.Count() != 1 {
+				t.Errorf("Size %d Count %d after refused writes, want 100 and 1", table.Size(), table.Count())
+			}
+		})
+	}
+}
+
+func TestRegionQuotaOverflow(t *testing.T) {
+	q := &regionQuotas{limits: map[string]uint64{}, usage: map[string]uint64{"EU": math.MaxUint64 - 10}}
+	if err := q.charge("EU", 0, 100); err != ErrInsufficientMemory {
+		t.Errorf("charge past uint64: got %v, want ErrInsufficientMemory", err)
+	}
+	if q.usage["EU"] != math.MaxUint64-10 {
+		t.Errorf("usage changed to %d by a refused charge", q.usage["EU"])
+	}
+}
+
+func TestBlobTableOverflow(t *testing.T) {
+	bt := NewBlobTable(4, 0, NewPoolManager())
+	bt.currentSize = math.MaxUint64 - 10 // a counter gone wrong
+	if err := bt.Put("blob", []byte("bytes")); err != ErrInsufficientMemory {
+		t.Errorf("Put past uint64: got %v, want ErrInsufficientMemory", err)
+	}
+	if bt.currentSize != math.MaxUint64-10 {
+		t.Errorf("size changed to %d by a refused Put", bt.currentSize)
+	}
+}
+
+// Releasing more bytes than are tracked clamps the counter at zero instead of
+// wrapping it to a size that refuses every later write
+func TestSizeAccountingUnderflow(t *testing.T) {
+	// Entries shrink from 100 to 10 bytes once they're overwritten
+	shrinking := func(_ string, entry DataEntry) uint64 {
+		if entry.ModificationCount > 1 {
+			return 10
+		}
+		return 100
+	}
+	table := NewSegmentedHashTable(4, 1000, WithSizeEstimator(shrinking))
+	drift := func() {
+		table.sizeLock.Lock()
+		table.currentSize = 50 // a counter gone wrong
+		table.sizeLock.Unlock()
+	}
+
+	fill(t, table, 1)
+	drift()
+	if err := table.Put("EU-0", DataEntry{LocationId: "EU-0", ModificationCount: 2}); err != nil {
+		t.Fatalf("shrinking Put: %v", err)
+	}
+	if got := table.Size(); got != 0 {
+		t.Errorf("Size() = %d after shrinking past the tracked total, want 0", got)
+	}
+
+	fill(t, table, 2)
+	drift()
+	for _, key := range []string{"EU-0", "EU-1"} {
+		if err := table.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := table.Size(); got != 0 {
+		t.Errorf("Size() = %d after deleting past the tracked total, want 0", got)
+	}
+	if err := table.Put("EU-2", testEntry("EU-2")); err != nil {
+		t.Errorf("Put after the counter clamped: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package storage
+
+// Clear removes every entry and its history, one segment at a time under that
+// segment's write lock, and returns how many entries it removed. Each segment's
+// map is swapped for an empty one rather than emptied in place, so a scan can
+// never see a segment half cleared: ForEach, exports and GetKeys-style scans
+// take the segment lock and see it either before or after, and a Snapshot keeps
+// the pre-Clear map intact. Across segments there is no such guarantee; a scan
+// running alongside Clear may see some segments cleared and others not.
+//
+// A delete event is emitted per removed key, so subscribers and a LogStore
+// stay in step.
+func (sht *SegmentedHashTable) Clear() int {
+	total := 0
+	for _, segment := range sht.segments {
+		segment.mu.Lock()
+		removed, series := segment.data, segment.history
+		segment.data = make(map[string]DataEntry)
+		segment.history = make(map[string]*history)
+		// Snapshots keep their reference to the old map, which is never written again
+		segment.snapshots.Store(0)
+		segment.accessed.Clear()
+		segment.gen++
+		segment.count.Store(0)
+
+		var bytes uint64
+		for key, entry := range removed {
+			size := sht.estimateSize(key, entry)
+			if h := series[key]; h != nil {
+				size += h.bytes
+			}
+			bytes += size
+			if sht.quotas != nil {
+				sht.quotas.charge(RegionOf(key), size, 0)
+			}
+		}
+		sht.sizeLock.Lock()
+		sht.releaseLocked(bytes)
+		sht.sizeLock.Unlock()
+
+		for key := range removed {
+			sht.unplaceLocked(key)
+			sht.emit(ChangeEvent{Type: ChangeDelete, Key: key})
+		}
+		total += len(removed)
+		segment.mu.Unlock()
+	}
+	return total
+}
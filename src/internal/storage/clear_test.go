@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// A scan running alongside Clear sees each segment either whole or empty,
+// never part cleared
+func TestClearScansSeeWholeSegments(t *testing.T) {
+	const n = 2000
+	table := NewSegmentedHashTable(8, 0)
+	for round := 0; round < 20; round++ {
+		fill(t, table, n)
+		full := make([]int, 8)
+		for i := 0; i < n; i++ {
+			full[table.SegmentIndex(fmt.Sprintf("EU-%d", i))]++
+		}
+
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					seen := make([]int, 8)
+					table.ForEach(func(key string, _ DataEntry) bool {
+						seen[table.SegmentIndex(key)]++
+						return true
+					})
+					for i, got := range seen {
+						if got != 0 && got != full[i] {
+							t.Errorf("round %d: scan saw %d of segment %d's %d entries", round, got, i, full[i])
+						}
+					}
+					select {
+					case <-done:
+						return
+					default:
+					}
+				}
+			}()
+		}
+		if cleared := table.Clear(); cleared != n {
+			t.Errorf("round %d: Clear() = %d, want %d", round, cleared, n)
+		}
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Puts racing Clear either land before their segment is cleared or after;
+// either way the size accounting stays exact
+func TestClearDuringPuts(t *testing.T) {
+	table := NewSegmentedHashTable(8, 0, WithHistory(2))
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("EU-%d-%d", w, i%300)
+				if err := table.Put(key, testEntry(key)); err != nil {
+					t.Errorf("Put(%s): %v", key, err)
+					return
+				}
+			}
+		}(w)
+	}
+	for i := 0; i < 50; i++ {
+		table.Clear()
+	}
+	wg.Wait()
+
+	if tracked, actual, ok := table.VerifySize(); !ok {
+		t.Errorf("after racing Clear: tracked %d bytes, actual %d", tracked, actual)
+	}
+	if count, keys := table.Count(), len(table.GetKeys()); count != keys {
+		t.Errorf("Count() = %d, but %d keys stored", count, keys)
+	}
+	table.Clear()
+	if size, count := table.Size(), table.Count(); size != 0 || count != 0 {
+		t.Errorf("after a final Clear: Size() = %d, Count() = %d, want both 0", size, count)
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import "time"
+
+// TableConfig is the effective construction-time configuration of a table, as
+// reported by GET /admin/config. The hash salt is reported only as set or not.
+type TableConfig struct {
+	Segments       int               `json:"segments"`
+	MaxSizeBytes   uint64            `json:"max_size_bytes"` // 0 means unlimited
+	DefaultTTL     time.Duration     `json:"default_ttl_ns"`
+	TouchOnRead    bool              `json:"touch_on_read"`
+	ReservationTTL time.Duration     `json:"reservation_ttl_ns"`
+	SegmentHash    string            `json:"segment_hash"`
+	HashSuffix     bool              `json:"hash_suffix"`
+	HashSalted     bool              `json:"hash_salted"`
+	KeyCase        string            `json:"key_case"`
+	Balanced       bool              `json:"balanced_placement"`
+	FairLocks      bool              `json:"fair_locks"`
+	HistoryLen     int               `json:"history_len"`
+	EvictSamples   int               `json:"evict_samples"`
+	RegionQuotas   map[string]uint64 `json:"region_quotas,omitempty"`
+	LockWatchdog   time.Duration     `json:"lock_watchdog_ns"`
+	MissLoader     bool              `json:"miss_loader"`
+}
+
+// Config reports how the table was constructed
+func (sht *SegmentedHashTable) Config() TableConfig {
+	cfg := TableConfig{
+		Segments:       len(sht.segments),
+		MaxSizeBytes:   sht.maxSize,
+		DefaultTTL:     sht.defaultTTL,
+		TouchOnRead:    sht.touchOnRead,
+		ReservationTTL: sht.reservationTTL,
+		SegmentHash:    sht.segmentHash.String(),
+		HashSuffix:     sht.hashSuffix,
+		HashSalted:     sht.hashSalt != "",
+		KeyCase:        [...]string{KeyCaseAsIs: "as-is", KeyCaseLower: "lower", KeyCaseUpper: "upper"}[sht.keyCase],
+		Balanced:       sht.placement != nil,
+		FairLocks:      sht.fairLocks,
+		HistoryLen:     sht.historyLen,
+		EvictSamples:   sht.evictSamples,
+		LockWatchdog:   sht.lockThreshold,
+		MissLoader:     sht.missLoader != nil,
+	}
+	if sht.quotas != nil {
+		cfg.RegionQuotas = make(map[string]uint64, len(sht.quotas.limits))
+		for region, limit := range sht.quotas.limits {
+			cfg.RegionQuotas[region] = limit
+		}
+	}
+	return cfg
+}
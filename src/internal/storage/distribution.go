@@ -0,0 +1,31 @@
+package storage
+
+import "math"
+
+// DistributionScore rates how evenly keys are spread over the segments as the
+// normalized Shannon entropy of the per-segment counts: 1.0 when every segment
+// holds the same number of keys, falling towards 0 as keys pile into fewer
+// segments. An empty or single-segment table scores 1.0. Only the segment
+// lengths are read, so it is cheap enough to compute per /metrics scrape.
+func (sht *SegmentedHashTable) DistributionScore() float64 {
+	counts := make([]int, len(sht.segments))
+	total := 0
+	for i, segment := range sht.segments {
+		segment.mu.RLock()
+		counts[i] = len(segment.data)
+		segment.mu.RUnlock()
+		total += counts[i]
+	}
+	if total == 0 || len(counts) < 2 {
+		return 1
+	}
+
+	var entropy float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(total)
+			entropy -= p * math.Log(p)
+		}
+	}
+	return entropy / math.Log(float64(len(counts)))
+}
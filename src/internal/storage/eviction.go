@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// WithEviction makes writes that would overflow maxSize evict entries instead
+// of failing with ErrInsufficientMemory. Eviction is approximate LRU in the
+// style of Redis: sampleSize random keys are examined and the least recently
+// used one goes, where a Get counts as a use as well as a write. Each eviction
+// costs O(sampleSize) rather than a full scan, and larger samples track true
+// LRU more closely. 0 disables eviction.
+func WithEviction(sampleSize int) TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.evictSamples = sampleSize
+	}
+}
+
+// Evictions returns how many entries have been evicted to make room
+func (sht *SegmentedHashTable) Evictions() uint64 {
+	return sht.evictions.Load()
+}
+
+// makeRoom evicts until an entry of size bytes for key would fit. It must be
+// called without any segment lock held, since evictions lock other segments.
+// Overwrites of an existing key are left to normal accounting.
+func (sht *SegmentedHashTable) makeRoom(key string, size uint64) {
+	if sht.evictSamples <= 0 || sht.unlimited() || sht.has(key) {
+		return
+	}
+	sht.evictUntilFits(size)
+}
+
+// recordAccess notes that key was read at now. The caller must hold at least
+// segment's read lock, which keeps key from being removed (and its access time
+// pruned) underneath it.
+func (sht *SegmentedHashTable) recordAccess(segment *segment, key string, now int64) {
+	if sht.evictSamples <= 0 {
+		return
+	}
+	if t, ok := segment.accessed.Load(key); ok {
+		t.(*atomic.Int64).Store(now)
+		return
+	}
+	t := new(atomic.Int64)
+	t.Store(now)
+	if prev, loaded := segment.accessed.LoadOrStore(key, t); loaded {
+		prev.(*atomic.Int64).Store(now)
+	}
+}
+
+// lastUsed returns when key was last written or read, whichever is later
+func (segment *segment) lastUsed(key string, entry DataEntry) int64 {
+	if t, ok := segment.accessed.Load(key); ok {
+		return max(entry.LastUpdated, t.(*atomic.Int64).Load())
+	}
+	return entry.LastUpdated
+}
+
+func (sht *SegmentedHashTable) has(key string) bool {
+	segment := sht.getSegment(key)
+	segment.mu.RLock()
+	defer segment.mu.RUnlock()
+	_, exists := segment.data[key]
+	return exists
+}
+
+// evictUntilFits evicts until size more bytes fit. It evicts nothing when even
+// an empty store couldn't take them, e.g. because reservations hold the rest of
+// the capacity, rather than emptying the store for a write that fails anyway.
+func (sht *SegmentedHashTable) evictUntilFits(size uint64) {
+	for {
+		sht.sizeLock.RLock()
+		fits := sht.fitsLocked(sht.currentSize, size)
+		hopeless := !sht.fitsLocked(0, size)
+		sht.sizeLock.RUnlock()
+		if fits || hopeless || !sht.evictOne() {
+			return
+		}
+	}
+}
+
+// evictOne samples keys and removes the least recently used. It reports false
+// when there was nothing to evict.
+func (sht *SegmentedHashTable) evictOne() bool {
+	var victim keyedEntry
+	var victimSeg *segment
+	var victimUsed int64
+	for i := 0; i < sht.evictSamples; i++ {
+		segment := sht.segments[rand.IntN(len(sht.segments))]
+		segment.mu.RLock()
+		// Map iteration starts at a random position, which is what makes this a sample
+		for k, e := range segment.data {
+			if used := segment.lastUsed(k, e); victimSeg == nil || used < victimUsed {
+				victim, victimSeg, victimUsed = keyedEntry{key: k, entry: e}, segment, used
+			}
+			break
+		}
+		segment.mu.RUnlock()
+	}
+	if victimSeg == nil {
+		return sht.Count() > 0 // every sample hit an empty segment; try again
+	}
+
+	victimSeg.mu.Lock()
+	defer victimSeg.mu.Unlock()
+	current, ok := victimSeg.data[victim.key]
+	if !ok || victimSeg.lastUsed(victim.key, current) != victimUsed {
+		return true // used or removed since sampling; resample
+	}
+	sht.removeLocked(victimSeg, victim.key, current)
+	sht.evictions.Add(1)
+	return true
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Every entry is charged 100 bytes so capacities read as entry counts
+func flatSize(string, DataEntry) uint64 { return 100 }
+
+// Keys that are read keep surviving eviction even though they were written
+// first: recency counts Gets, not just writes. Sampling makes this
+// statistical, so the test only asks that most of the read keys survive;
+// evicting by write time would take about half of them.
+func TestEvictionKeepsRecentlyRead(t *testing.T) {
+	const n = 200
+	table := NewSegmentedHashTable(8, n*100, WithEviction(5), WithSizeEstimator(flatSize))
+	hot := make([]string, 0, n/2)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		if err := table.Put(key, testEntry(key)); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+		if i < n/2 {
+			hot = append(hot, key)
+		}
+	}
+	// The hot half is the oldest written, so evicting by write time would take it first
+	for _, key := range hot {
+		if _, err := table.Get(key); err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+	}
+
+	for i := n; i < n+n/4; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		if err := table.Put(key, testEntry(key)); err != nil {
+			t.Fatalf("Put(%s) with eviction on: %v", key, err)
+		}
+	}
+	if got := table.Evictions(); got != n/4 {
+		t.Errorf("Evictions() = %d, want %d", got, n/4)
+	}
+	survived := 0
+	for _, key := range hot {
+		if _, err := table.Get(key); err == nil {
+			survived++
+		}
+	}
+	if survived < len(hot)*7/10 {
+		t.Errorf("%d of %d recently read keys survived eviction, want at least 70%%", survived, len(hot))
+	}
+}
+
+// Reservations can hold capacity that no eviction frees. A write that can't
+// fit even in an empty store must fail without evicting anything.
+func TestEvictionStopsWhenReservationsBlock(t *testing.T) {
+	table := NewSegmentedHashTable(4, 1000, WithEviction(5), WithSizeEstimator(flatSize))
+	fill(t, table, 5)
+	if _, err := table.Reserve(500); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	table.sizeOf = func(key string, entry DataEntry) uint64 {
+		if key == "EU-big" {
+			return 600
+		}
+		return flatSize(key, entry)
+	}
+	if err := table.Put("EU-big", testEntry("EU-big")); err != ErrInsufficientMemory {
+		t.Fatalf("Put past reservations: got %v, want ErrInsufficientMemory", err)
+	}
+	if got := table.Count(); got != 5 {
+		t.Errorf("Count() = %d after a hopeless write, want all 5 entries kept", got)
+	}
+	if got := table.Evictions(); got != 0 {
+		t.Errorf("Evictions() = %d, want 0", got)
+	}
+}
+
+func TestEvictionForgetsRemovedKeys(t *testing.T) {
+	table := NewSegmentedHashTable(4, 10000, WithEviction(5))
+	fill(t, table, 10)
+	for i := 0; i < 10; i++ {
+		table.Get(fmt.Sprintf("EU-%d", i))
+	}
+	tracked := func() int {
+		n := 0
+		for _, segment := range table.segments {
+			segment.accessed.Range(func(any, any) bool { n++; return true })
+		}
+		return n
+	}
+	for i := 0; i < 5; i++ {
+		table.Delete(fmt.Sprintf("EU-%d", i))
+	}
+	if n := tracked(); n != 5 {
+		t.Errorf("%d access times tracked after deleting 5 of 10 read keys, want 5", n)
+	}
+	table.Clear()
+	if n := tracked(); n != 0 {
+		t.Errorf("%d access times tracked after Clear, want 0", n)
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"sync"
+)
+
+// rwLocker is the subset of sync.RWMutex segments rely on, so the lock
+// implementation can be swapped per table
+type rwLocker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// WithFairLocks gives every segment a fairRWMutex. Under a sustained stream of
+// writes to one segment, readers are guaranteed a turn between consecutive
+// writers, bounding read latency at some cost to write throughput.
+func WithFairLocks() TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.fairLocks = true
+	}
+}
+
+// fairRWMutex alternates between writers and the readers that queued up behind
+// them: when a writer unlocks, every reader waiting at that moment is admitted
+// before the next writer may enter. New readers still queue behind a waiting
+// writer, so neither side can starve the other.
+type fairRWMutex struct {
+	mu             sync.Mutex
+	cond           *sync.Cond
+	readers        int  // readers holding the lock
+	writer         bool // a writer holds the lock
+	waitingReaders int
+	waitingWriters int
+	admit          int // readers still owed a turn after the last writer
+}
+
+func newFairRWMutex() *fairRWMutex {
+	l := &fairRWMutex{}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *fairRWMutex) RLock() {
+	l.mu.Lock()
+	l.waitingReaders++
+	for l.writer || (l.waitingWriters > 0 && l.admit == 0) {
+		l.cond.Wait()
+	}
+	l.waitingReaders--
+	if l.admit > 0 {
+		l.admit--
+	}
+	l.readers++
+	l.mu.Unlock()
+}
+
+func (l *fairRWMutex) RUnlock() {
+	l.mu.Lock()
+	l.readers--
+	if l.readers == 0 {
+		l.cond.Broadcast()
+	}
+	l.mu.Unlock()
+}
+
+func (l *fairRWMutex) Lock() {
+	l.mu.Lock()
+	l.waitingWriters++
+	for l.writer || l.readers > 0 || l.admit > 0 {
+		l.cond.Wait()
+	}
+	l.waitingWriters--
+	l.writer = true
+	l.mu.Unlock()
+}
+
+func (l *fairRWMutex) Unlock() {
+	l.mu.Lock()
+	l.writer = false
+	l.admit = l.waitingReaders
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
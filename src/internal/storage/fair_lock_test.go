@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFairRWMutexExclusion(t *testing.T) {
+	l := newFairRWMutex()
+	var readers, writers atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				l.Lock()
+				if writers.Add(1) != 1 || readers.Load() != 0 {
+					t.Error("writer admitted alongside another holder")
+				}
+				writers.Add(-1)
+				l.Unlock()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				l.RLock()
+				readers.Add(1)
+				if writers.Load() != 0 {
+					t.Error("reader admitted while a writer holds the lock")
+				}
+				readers.Add(-1)
+				l.RUnlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// A reader queued behind a stream of writers must get in after the current
+// writer, not after the whole stream
+func TestFairRWMutexAdmitsWaitingReader(t *testing.T) {
+	l := newFairRWMutex()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				l.Lock()
+				time.Sleep(100 * time.Microsecond)
+				l.Unlock()
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		done := make(chan struct{})
+		go func() {
+			l.RLock()
+			l.RUnlock()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("reader starved behind a stream of writers")
+		}
+	}
+}
+
+// BenchmarkReadP99UnderWrites reports the p99 Get latency on one segment while
+// writers update it non-stop, for the default RWMutex and WithFairLocks
+func BenchmarkReadP99UnderWrites(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []TableOption
+	}{
+		{"rwmutex", nil},
+		{"fair", []TableOption{WithFairLocks()}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			table := NewSegmentedHashTable(1, 0, tc.opts...)
+			fill(b, table, 100)
+
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; ; j++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						key := fmt.Sprintf("EU-%d", (i*31+j)%100)
+						table.Put(key, testEntry(key))
+					}
+				}(i)
+			}
+
+			lat := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				table.Get(fmt.Sprintf("EU-%d", i%100))
+				lat[i] = time.Since(start)
+			}
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+
+			sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+			b.ReportMetric(float64(lat[len(lat)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package storage
+
+// history is a fixed-capacity ring of the most recent writes to one key
+type history struct {
+	entries []DataEntry
+	sizes   []uint64 // bytes charged for each slot
+	next    int      // slot the next push overwrites once the ring is full
+	bytes   uint64   // total charged for the whole series
+}
+
+// WithHistory keeps the last n writes per key, readable through History. Every
+// retained reading is charged against maxSize just like the live entry.
+func WithHistory(n int) TableOption {
+	return func(sht *SegmentedHashTable) {
+		if n > 0 {
+			sht.historyLen = n
+		}
+	}
+}
+
+// HistoryEnabled reports whether the table retains per-key series
+func (sht *SegmentedHashTable) HistoryEnabled() bool {
+	return sht.historyLen > 0
+}
+
+// bytesAfterPush is what the series will be charged once an entry of the given
+// size is appended to a ring holding at most max readings
+func (h *history) bytesAfterPush(size uint64, max int) uint64 {
+	if h == nil {
+		return size
+	}
+	if len(h.entries) < max {
+		return sumSizes(h.bytes, size)
+	}
+	return sumSizes(h.bytes-h.sizes[h.next], size)
+}
+
+func (h *history) push(entry DataEntry, size uint64, max int) {
+	h.bytes = h.bytesAfterPush(size, max)
+	if len(h.entries) < max {
+		h.entries = append(h.entries, entry)
+		h.sizes = append(h.sizes, size)
+		return
+	}
+	h.entries[h.next] = entry
+	h.sizes[h.next] = size
+	h.next = (h.next + 1) % max
+}
+
+// ordered returns a copy of the series, oldest first
+func (h *history) ordered() []DataEntry {
+	out := make([]DataEntry, 0, len(h.entries))
+	out = append(out, h.entries[h.next:]...)
+	return append(out, h.entries[:h.next]...)
+}
+
+// History returns the retained readings for key, oldest first. Returns
+// ErrKeyNotFound if the key has no history (or history mode is off).
+func (sht *SegmentedHashTable) History(key string) ([]DataEntry, error) {
+	key = sht.NormalizeKey(key)
+	segment := sht.getSegment(key)
+	segment.mu.RLock()
+	defer segment.mu.RUnlock()
+
+	h, ok := segment.history[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return h.ordered(), nil
+}
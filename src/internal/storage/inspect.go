@@ -0,0 +1,47 @@
+package storage
+
+// KeyInfo is diagnostic metadata about a single stored key
+type KeyInfo struct {
+	Key          string    `json:"key"`
+	Version      int       `json:"version"`
+	LastUpdated  int64     `json:"last_updated_unix_nano"`
+	Segment      int       `json:"segment"`
+	ChargedBytes uint64    `json:"charged_bytes"` // what the key costs against maxSize
+	HistoryLen   int       `json:"history_len"`
+	Entry        DataEntry `json:"entry"`
+}
+
+// SegmentIndex returns the segment key is (or would be) stored in, after key
+// normalization and any salt, suffix hashing or balanced placement. Diagnostic
+// only: the answer can change if the key is later written under balanced
+// placement, and with maphash it differs between runs.
+func (sht *SegmentedHashTable) SegmentIndex(key string) int {
+	return int(sht.lookupIndex(sht.NormalizeKey(key)))
+}
+
+// Inspect reports where key lives and what it costs, for debugging
+func (sht *SegmentedHashTable) Inspect(key string) (KeyInfo, error) {
+	key = sht.NormalizeKey(key)
+	idx := sht.lookupIndex(key)
+	segment := sht.segments[idx]
+	segment.mu.RLock()
+	defer segment.mu.RUnlock()
+
+	entry, ok := segment.data[key]
+	if !ok {
+		return KeyInfo{}, ErrKeyNotFound
+	}
+	info := KeyInfo{
+		Key:          key,
+		Version:      entry.ModificationCount,
+		LastUpdated:  entry.LastUpdated,
+		Segment:      int(idx),
+		ChargedBytes: sht.estimateSize(key, entry),
+		Entry:        entry,
+	}
+	if h, ok := segment.history[key]; ok {
+		info.ChargedBytes += h.bytes
+		info.HistoryLen = len(h.entries)
+	}
+	return info, nil
+}
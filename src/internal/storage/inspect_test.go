@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+// SegmentIndex is stable for a key, in range, the same across tables built
+// alike, and agrees with where Inspect finds the key once it is stored
+func TestSegmentIndex(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []TableOption
+	}{
+		{"fnv", nil},
+		{"salted", []TableOption{WithHashSalt("pepper")}},
+		{"suffix", []TableOption{WithHashSuffix()}},
+		{"key case", []TableOption{WithKeyCase(KeyCaseUpper)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			const segments = 16
+			table := NewSegmentedHashTable(segments, 0, tc.opts...)
+			twin := NewSegmentedHashTable(segments, 0, tc.opts...)
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("EU-%d", i)
+				idx := table.SegmentIndex(key)
+				if idx < 0 || idx >= segments {
+					t.Fatalf("SegmentIndex(%s) = %d, want 0..%d", key, idx, segments-1)
+				}
+				if again := table.SegmentIndex(key); again != idx {
+					t.Fatalf("SegmentIndex(%s) = %d then %d", key, idx, again)
+				}
+				if other := twin.SegmentIndex(key); other != idx {
+					t.Fatalf("SegmentIndex(%s) = %d, but %d on an identical table", key, idx, other)
+				}
+
+				if err := table.Put(key, testEntry(key)); err != nil {
+					t.Fatalf("Put(%s): %v", key, err)
+				}
+				info, err := table.Inspect(key)
+				if err != nil {
+					t.Fatalf("Inspect(%s): %v", key, err)
+				}
+				if info.Segment != idx {
+					t.Fatalf("%s stored in segment %d, SegmentIndex said %d", key, info.Segment, idx)
+				}
+			}
+		})
+	}
+
+	// Keys that normalize alike land alike
+	table := NewSegmentedHashTable(16, 0, WithKeyCase(KeyCaseLower))
+	if a, b := table.SegmentIndex("EU-Sensor"), table.SegmentIndex("eu-sensor"); a != b {
+		t.Errorf("SegmentIndex differs by case under KeyCaseLower: %d vs %d", a, b)
+	}
+}
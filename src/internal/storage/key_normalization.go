@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"strings"
+)
+
+type KeyCase int
+
+const (
+	KeyCaseAsIs KeyCase = iota // keys are case-sensitive (default)
+	KeyCaseLower
+	KeyCaseUpper
+)
+
+// WithKeyCase folds every key to one case before hashing and storage, so
+// "EU-A1" and "eu-a1" address the same entry. Opt-in since it changes key identity.
+func WithKeyCase(c KeyCase) TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.keyCase = c
+	}
+}
+
+// NormalizeKey returns key as the table stores it. Store methods apply this
+// themselves; it's exported so callers can echo the canonical key back.
+func (sht *SegmentedHashTable) NormalizeKey(key string) string {
+	switch sht.keyCase {
+	case KeyCaseLower:
+		return strings.ToLower(key)
+	case KeyCaseUpper:
+		return strings.ToUpper(key)
+	default:
+		return key
+	}
+}
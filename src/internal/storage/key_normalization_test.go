@@ -0,0 +1,42 @@
+package storage
+
+import "testing"
+
+func TestKeyCase(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   []TableOption
+		count  int
+		stored string
+	}{
+		{"as-is", nil, 2, "eu-a1"},
+		{"lower", []TableOption{WithKeyCase(KeyCaseLower)}, 1, "eu-a1"},
+		{"upper", []TableOption{WithKeyCase(KeyCaseUpper)}, 1, "EU-A1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			table := NewSegmentedHashTable(4, 0, tc.opts...)
+			for _, key := range []string{"EU-A1", "eu-a1"} {
+				if err := table.Put(key, testEntry(key)); err != nil {
+					t.Fatalf("Put(%s): %v", key, err)
+				}
+			}
+			if table.Count() != tc.count {
+				t.Errorf("Count = %d after writing EU-A1 and eu-a1, want %d", table.Count(), tc.count)
+			}
+			if _, err := table.Get(tc.stored); err != nil {
+				t.Errorf("Get(%s): %v", tc.stored, err)
+			}
+			if tc.count == 1 {
+				if _, err := table.Get("Eu-A1"); err != nil {
+					t.Errorf("Get in mixed case: %v", err)
+				}
+				if err := table.Delete("eU-a1"); err != nil {
+					t.Errorf("Delete in mixed case: %v", err)
+				}
+				if table.Count() != 0 {
+					t.Errorf("Count = %d after Delete, want 0", table.Count())
+				}
+			}
+		})
+	}
+}
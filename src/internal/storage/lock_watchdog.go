@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// watchedLock records when it was acquired so a watchdog can spot holds that
+// run far longer than any legitimate critical section. It never forces a
+// release; it only makes a stuck segment visible.
+type watchedLock struct {
+	rwLocker
+	writeSince atomic.Int64 // unix nanos the writer acquired, 0 if none
+	readers    atomic.Int64
+	readSince  atomic.Int64 // unix nanos readers started holding continuously, 0 if none
+}
+
+func (l *watchedLock) Lock() {
+	l.rwLocker.Lock()
+	l.writeSince.Store(time.Now().UnixNano())
+}
+
+func (l *watchedLock) Unlock() {
+	l.writeSince.Store(0)
+	l.rwLocker.Unlock()
+}
+
+func (l *watchedLock) RLock() {
+	l.rwLocker.RLock()
+	if l.readers.Add(1) == 1 {
+		l.readSince.Store(time.Now().UnixNano())
+	}
+}
+
+func (l *watchedLock) RUnlock() {
+	if l.readers.Add(-1) == 0 {
+		l.readSince.Store(0)
+	}
+	l.rwLocker.RUnlock()
+}
+
+// heldSince returns when the current hold began, preferring the writer
+func (l *watchedLock) heldSince() (since int64, write bool) {
+	if w := l.writeSince.Load(); w != 0 {
+		return w, true
+	}
+	return l.readSince.Load(), false
+}
+
+// WithLockWatchdog instruments every segment lock so StartLockWatchdog can
+// report holds longer than threshold. Read holds are measured from when the
+// segment last went from zero readers to one, so a steady overlap of readers
+// also counts.
+func WithLockWatchdog(threshold time.Duration) TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.lockThreshold = threshold
+	}
+}
+
+// LongLockHolds returns how many lock holds have exceeded the watchdog
+// threshold so far, each hold counted once
+func (sht *SegmentedHashTable) LongLockHolds() uint64 {
+	return sht.longLockHolds.Load()
+}
+
+// StartLockWatchdog checks every segment lock at half the threshold and logs a
+// warning for each hold past it, until the returned stop func is called. It is
+// a no-op unless the table was built WithLockWatchdog.
+func (sht *SegmentedHashTable) StartLockWatchdog() (stop func()) {
+	if sht.lockThreshold <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(sht.lockThreshold / 2)
+	done := make(chan struct{})
+	reported := make([]int64, len(sht.segments)) // hold already logged per segment
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				sht.checkLocks(time.Now(), reported)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (sht *SegmentedHashTable) checkLocks(now time.Time, reported []int64) {
+	for i, segment := range sht.segments {
+		l, ok := segment.mu.(*watchedLock)
+		if !ok {
+			continue
+		}
+		since, write := l.heldSince()
+		if since == 0 || since == reported[i] {
+			continue
+		}
+		held := now.Sub(time.Unix(0, since))
+		if held < sht.lockThreshold {
+			continue
+		}
+		reported[i] = since
+		sht.longLockHolds.Add(1)
+		mode := "read"
+		if write {
+			mode = "write"
+		}
+		sht.logger.Warn("segment lock held long", "segment", i, "mode", mode, "held", held.Round(time.Millisecond), "threshold", sht.lockThreshold)
+	}
+}
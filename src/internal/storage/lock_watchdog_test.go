@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockWatchdogReportsLongHolds(t *testing.T) {
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+
+	table := NewSegmentedHashTable(4, 0, WithLockWatchdog(20*time.Millisecond), WithLogger(logger))
+	stop := table.StartLockWatchdog()
+	defer stop()
+
+	// Plenty of short holds never trip it
+	for i := 0; i < 100; i++ {
+		table.Put("EU-A1", testEntry("EU-A1"))
+		table.Get("EU-A1")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := table.LongLockHolds(); n != 0 {
+		t.Fatalf("LongLockHolds() = %d after short holds only", n)
+	}
+
+	waitHolds := func(want uint64) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for table.LongLockHolds() < want {
+			if time.Now().After(deadline) {
+				t.Fatalf("LongLockHolds() = %d, want %d", table.LongLockHolds(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// A stuck writer is reported once however long it stays stuck
+	table.segments[1].mu.Lock()
+	waitHolds(1)
+	time.Sleep(50 * time.Millisecond)
+	table.segments[1].mu.Unlock()
+	if n := table.LongLockHolds(); n != 1 {
+		t.Errorf("one long write hold counted %d times", n)
+	}
+	if !strings.Contains(out.String(), "segment=1 mode=write") {
+		t.Errorf("no warning logged for the write hold: %q", out.String())
+	}
+
+	table.segments[2].mu.RLock()
+	waitHolds(2)
+	table.segments[2].mu.RUnlock()
+	if !strings.Contains(out.String(), "segment=2 mode=read") {
+		t.Errorf("no warning logged for the read hold: %q", out.String())
+	}
+}
+
+func TestLockWatchdogOff(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0)
+	if _, ok := table.segments[0].mu.(*watchedLock); ok {
+		t.Error("segment locks are instrumented without WithLockWatchdog")
+	}
+	table.StartLockWatchdog()() // a no-op start and stop
+}
@@ -0,0 +1,711 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// logHeader is the op of the first record in a data file, noting the table
+// layout the file was written with
+const logHeader ChangeType = "header"
+
+// ErrLayoutMismatch is returned by OpenLogStore under WithStrictLayout when the
+// data file was written by a table with a different segment count or hash
+var ErrLayoutMismatch = errors.New("data file layout does not match table")
+
+// logRecord is one line of a LogStore file. LastUpdated is carried explicitly
+// because DataEntry hides it from JSON.
+type logRecord struct {
+	Op          ChangeType `json:"op"`
+	Key         string     `json:"key,omitempty"`
+	Entry       *DataEntry `json:"entry,omitempty"`
+	LastUpdated int64      `json:"last_updated,omitempty"`
+	ExpiresAt   int64      `json:"expires_at,omitempty"`
+	Slide       int64      `json:"slide,omitempty"` // touch-on-read TTL, once a read has fixed it
+
+	// Header only
+	Segments    int    `json:"segments,omitempty"`
+	SegmentHash string `json:"segment_hash,omitempty"`
+}
+
+// Smallest log, in records, that automatic compaction will rewrite
+const minCompactRecords = 1000
+
+// LogStore is a durable Store: an in-memory SegmentedHashTable serves every read
+// while each mutation is appended to an NDJSON log, which is replayed on open.
+// The table is wrapped rather than embedded, so every method that can change
+// it, down to a touch-on-read Get sliding an expiry, is one that logs.
+// Records are queued under the mutated key's segment lock, so the log order
+// matches the order writes were applied, and written to the file once the lock
+// is released. Each write returns only after its record is flushed to the OS;
+// the file is fsynced on Close.
+//
+// An append failure fails the write that hit it and is kept and reported by Err.
+// From then on every write is refused, since the log no longer reflects the
+// table; reads keep working.
+//
+// CompactLog rewrites the file down to one record per live entry, so replay time
+// tracks the data rather than its history; see WithCompaction to run it
+// automatically.
+type LogStore struct {
+	table *SegmentedHashTable
+
+	path    string
+	mu      sync.Mutex // held while writing to the file
+	file    *os.File
+	w       *bufio.Writer
+	closed  bool // set under both mu and qmu
+	records int  // lines in the file, header included
+
+	qmu     sync.Mutex // never held across I/O, so segment locks can wait on it
+	pending []byte     // records queued under segment locks, not yet written
+	err     error      // first append failure, sticky
+
+	// Compaction, see CompactLog
+	compactMu    sync.Mutex    // one compaction at a time
+	tail         *bytes.Buffer // records written while a compaction scans, nil otherwise
+	compactRatio int           // compact once the log holds this many records per live entry, 0 never
+	compacting   atomic.Bool
+
+	// Async mode only, see WithAsyncAppends
+	queue       chan []byte
+	sendMu      sync.Mutex   // one enqueuePending at a time, keeping records in order
+	queueMu     sync.RWMutex // held shared while sending, exclusively to close queue
+	queueClosed bool
+	drained     chan struct{}
+
+	strictLayout bool // refuse files whose header doesn't match the table
+}
+
+// LogStoreOption configures OpenLogStore
+type LogStoreOption func(*LogStore)
+
+// WithAsyncAppends takes log writes off the request path: mutations are queued
+// and a background writer drains them to the file, flushing whenever the queue
+// empties. Up to queueLen records can be waiting; beyond that writes block until
+// the writer catches up, so memory stays bounded. A blocked write has already
+// released its segment lock, so reads are never held up by a full queue.
+//
+// Durability: a write is acknowledged once it is queued, not once it reaches
+// the file. A crash (not a clean Close) loses whatever was still queued or
+// buffered, and append failures surface later through Err. Close drains the
+// whole queue before syncing.
+func WithAsyncAppends(queueLen int) LogStoreOption {
+	return func(ls *LogStore) {
+		if queueLen > 0 {
+			ls.queue = make(chan []byte, queueLen)
+			ls.drained = make(chan struct{})
+		}
+	}
+}
+
+// WithStrictLayout makes OpenLogStore fail with ErrLayoutMismatch, rather than
+// just warn, when the data file header records a different segment count or
+// segment hash than the table's. Keys are rehashed on replay either way, so a
+// mismatch only means the configuration drifted since the file was written.
+func WithStrictLayout() LogStoreOption {
+	return func(ls *LogStore) {
+		ls.strictLayout = true
+	}
+}
+
+// WithCompaction makes the store compact its log in the background once it
+// holds more than ratio records per live entry (and at least a thousand),
+// so a key rewritten often doesn't make every restart replay its whole history.
+// 0 disables automatic compaction.
+func WithCompaction(ratio int) LogStoreOption {
+	return func(ls *LogStore) {
+		ls.compactRatio = ratio
+	}
+}
+
+var _ Store = (*LogStore)(nil)
+
+// OpenLogStore replays the log at path (if any) into table and then appends all
+// further mutations of table to it. table should be empty and not yet shared.
+// A new file starts with a header recording the table's layout.
+func OpenLogStore(path string, table *SegmentedHashTable, opts ...LogStoreOption) (*LogStore, error) {
+	ls := &LogStore{table: table, path: path}
+	for _, opt := range opts {
+		opt(ls)
+	}
+	records, err := replayLog(path, table, ls.strictLayout)
+	if err != nil {
+		return nil, err
+	}
+	ls.records = records
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	ls.file = file
+	ls.w = bufio.NewWriter(file)
+	if info, err := file.Stat(); err != nil || info.Size() == 0 {
+		ls.records = 0
+		if err == nil {
+			err = ls.writeHeader()
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if ls.queue != nil {
+		go ls.drain()
+	}
+	table.onChange = ls.append
+	return ls, nil
+}
+
+// layoutHeader describes table as a data file header record
+func layoutHeader(table *SegmentedHashTable) logRecord {
+	return logRecord{Op: logHeader, Segments: len(table.segments), SegmentHash: table.segmentHash.String()}
+}
+
+func (ls *LogStore) writeHeader() error {
+	line, err := json.Marshal(layoutHeader(ls.table))
+	if err == nil {
+		err = ls.write(append(line, '\n'))
+	}
+	if err == nil {
+		err = ls.w.Flush()
+	}
+	return err
+}
+
+// write hands records to the file buffer, copying them to the compaction tail
+// when a compaction is scanning. The caller holds ls.mu.
+func (ls *LogStore) write(lines []byte) error {
+	if _, err := ls.w.Write(lines); err != nil {
+		return err
+	}
+	if ls.tail != nil {
+		ls.tail.Write(lines)
+	}
+	ls.records += bytes.Count(lines, []byte{'\n'})
+	return nil
+}
+
+// checkLayout compares a data file header against table, warning on drift or,
+// when strict, failing
+func checkLayout(path string, rec logRecord, table *SegmentedHashTable, strict bool) error {
+	want := layoutHeader(table)
+	if rec.Segments == want.Segments && rec.SegmentHash == want.SegmentHash {
+		return nil
+	}
+	err := fmt.Errorf("%s: written with %d segments/%s, table has %d segments/%s: %w",
+		path, rec.Segments, rec.SegmentHash, want.Segments, want.SegmentHash, ErrLayoutMismatch)
+	if strict {
+		return err
+	}
+	table.logger.Warn("data file layout mismatch", "err", err)
+	return nil
+}
+
+// replayLog loads the log at path into table and returns how many records it
+// held
+func replayLog(path string, table *SegmentedHashTable, strictLayout bool) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec logRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return line, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		switch rec.Op {
+		case logHeader:
+			if line != 1 {
+				return line, fmt.Errorf("%s:%d: header after first record", path, line)
+			}
+			if err := checkLayout(path, rec, table, strictLayout); err != nil {
+				return line, err
+			}
+		case ChangePut:
+			if rec.Entry == nil {
+				return line, fmt.Errorf("%s:%d: put without entry", path, line)
+			}
+			rec.Entry.ExpiresAt, rec.Entry.slide = rec.ExpiresAt, rec.Slide
+			if err := table.restore(rec.Key, *rec.Entry, rec.LastUpdated); err != nil {
+				return line, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		case ChangeDelete:
+			table.forget(rec.Key)
+		default:
+			return line, fmt.Errorf("%s:%d: unknown op %q", path, line, rec.Op)
+		}
+	}
+	return line, scanner.Err()
+}
+
+// append runs under the mutated key's segment lock, so it only queues the
+// record; commit writes it once the lock is released
+func (ls *LogStore) append(ev ChangeEvent) {
+	rec := logRecord{Op: ev.Type, Key: ev.Key, Entry: ev.Entry}
+	if ev.Entry != nil {
+		rec.LastUpdated = ev.Entry.LastUpdated
+		rec.ExpiresAt = ev.Entry.ExpiresAt
+		rec.Slide = ev.Entry.slide
+	}
+	line, err := json.Marshal(rec)
+
+	ls.qmu.Lock()
+	defer ls.qmu.Unlock()
+	if ls.closed {
+		err = fmt.Errorf("write after close")
+	}
+	if err != nil {
+		if ls.err == nil {
+			ls.err = err
+		}
+		return
+	}
+	ls.pending = append(append(ls.pending, line...), '\n')
+}
+
+// takePending empties the record queue, returning its contents unless the log
+// has already failed
+func (ls *LogStore) takePending() ([]byte, error) {
+	ls.qmu.Lock()
+	defer ls.qmu.Unlock()
+	lines := ls.pending
+	ls.pending = nil
+	return lines, ls.err
+}
+
+// fail records err as the log's failure unless an earlier one is already kept
+func (ls *LogStore) fail(err error) {
+	ls.qmu.Lock()
+	defer ls.qmu.Unlock()
+	if ls.err == nil {
+		ls.err = err
+	}
+}
+
+// commit writes every queued record to the file and returns the log's error,
+// if any. Mutations call it after releasing the segment lock, so a writer that
+// finds its record already written by a concurrent commit returns straight
+// away. In async mode commit hands the records to drain instead, waiting for
+// room in its queue without holding any segment lock.
+func (ls *LogStore) commit() error {
+	if ls.queue != nil {
+		ls.enqueuePending()
+	}
+	ls.mu.Lock()
+	if ls.queue == nil {
+		ls.writePending()
+	}
+	err := ls.Err()
+	due := ls.compactRatio > 0 && ls.records > minCompactRecords && !ls.closed
+	records := ls.records
+	ls.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("appending to %s: %w", ls.path, err)
+	}
+	if due && records > ls.compactRatio*ls.table.Count() && ls.compacting.CompareAndSwap(false, true) {
+		go func() {
+			defer ls.compacting.Store(false)
+			if err := ls.CompactLog(); err != nil {
+				ls.table.logger.Warn("compacting data file", "path", ls.path, "err", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// writePending writes and flushes the queued records. The caller holds ls.mu,
+// which keeps records in queue order across concurrent commits.
+func (ls *LogStore) writePending() {
+	lines, err := ls.takePending()
+	if err != nil || len(lines) == 0 {
+		return
+	}
+	err = ls.write(lines)
+	if err == nil {
+		err = ls.w.Flush()
+	}
+	if err != nil {
+		ls.fail(err)
+	}
+}
+
+// refuse returns the log's error, wrapped for the caller, once an append has
+// failed; writes are refused from then on so the table can't drift further
+// from the file
+func (ls *LogStore) refuse() error {
+	if err := ls.Err(); err != nil {
+		return fmt.Errorf("appending to %s: %w", ls.path, err)
+	}
+	return nil
+}
+
+// Put stores entry and returns once its record is written
+func (ls *LogStore) Put(key string, entry DataEntry) error {
+	if err := ls.refuse(); err != nil {
+		return err
+	}
+	err := ls.table.Put(key, entry)
+	if cerr := ls.commit(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// PutBatch stores records and returns once they are written. If the append
+// fails, every record that was otherwise accepted reports that error.
+func (ls *LogStore) PutBatch(records []BatchRecord) []error {
+	errs := make([]error, len(records))
+	if err := ls.refuse(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	errs = ls.table.PutBatch(records)
+	if cerr := ls.commit(); cerr != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = cerr
+			}
+		}
+	}
+	return errs
+}
+
+// Apply runs a transaction and returns once its records are written
+func (ls *LogStore) Apply(ops []TxnOp) error {
+	if err := ls.refuse(); err != nil {
+		return err
+	}
+	err := ls.table.Apply(ops)
+	if cerr := ls.commit(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Update applies fn and returns once the record is written
+func (ls *LogStore) Update(key string, fn func(current DataEntry, exists bool) (DataEntry, error)) (DataEntry, error) {
+	if err := ls.refuse(); err != nil {
+		return DataEntry{}, err
+	}
+	entry, err := ls.table.Update(key, fn)
+	if cerr := ls.commit(); err == nil && cerr != nil {
+		return DataEntry{}, cerr
+	}
+	return entry, err
+}
+
+// Delete removes key and returns once the record is written
+func (ls *LogStore) Delete(key string) error {
+	return ls.DeleteIf(key, nil)
+}
+
+// DeleteIf removes key if check approves and returns once the record is written
+func (ls *LogStore) DeleteIf(key string, check func(current DataEntry) error) error {
+	if err := ls.refuse(); err != nil {
+		return err
+	}
+	err := ls.table.DeleteIf(key, check)
+	if cerr := ls.commit(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// PurgeOlderThan purges like the table does and writes the resulting deletes
+func (ls *LogStore) PurgeOlderThan(cutoff time.Time) (purged int, reclaimed uint64) {
+	purged, reclaimed = ls.table.PurgeOlderThan(cutoff)
+	ls.commit()
+	return purged, reclaimed
+}
+
+// Clear empties the table and writes a delete per removed key
+func (ls *LogStore) Clear() int {
+	n := ls.table.Clear()
+	ls.commit()
+	return n
+}
+
+// Get reads key. Under WithTouchOnRead the read slides the entry's expiry, and
+// that is written like any other change so a restart doesn't undo it.
+func (ls *LogStore) Get(key string) (DataEntry, error) {
+	entry, err := ls.table.Get(key)
+	if ls.table.touchOnRead {
+		ls.commit()
+	}
+	return entry, err
+}
+
+// PutReserved stores entry against reservation tok and returns once its record
+// is written
+func (ls *LogStore) PutReserved(tok ReservationToken, key string, entry DataEntry) error {
+	if err := ls.refuse(); err != nil {
+		return err
+	}
+	err := ls.table.PutReserved(tok, key, entry)
+	if cerr := ls.commit(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SweepExpired removes expired entries and writes their deletes
+func (ls *LogStore) SweepExpired() int {
+	n := ls.table.SweepExpired()
+	ls.commit()
+	return n
+}
+
+// StartSweeper runs SweepExpired every interval until the returned stop func
+// is called
+func (ls *LogStore) StartSweeper(interval time.Duration) (stop func()) {
+	return startSweeper(interval, ls.SweepExpired)
+}
+
+// The rest of the table's methods leave its data alone and are passed through
+
+func (ls *LogStore) ForEach(fn func(key string, entry DataEntry) bool) { ls.table.ForEach(fn) }
+func (ls *LogStore) GetKeys() []string                                 { return ls.table.GetKeys() }
+func (ls *LogStore) Range(start, end string, limit int) []DataEntry {
+	return ls.table.Range(start, end, limit)
+}
+func (ls *LogStore) WithPrefix(prefix string, limit int) map[string]DataEntry {
+	return ls.table.WithPrefix(prefix, limit)
+}
+func (ls *LogStore) History(key string) ([]DataEntry, error)       { return ls.table.History(key) }
+func (ls *LogStore) HistoryEnabled() bool                          { return ls.table.HistoryEnabled() }
+func (ls *LogStore) Inspect(key string) (KeyInfo, error)           { return ls.table.Inspect(key) }
+func (ls *LogStore) Subscribe() (<-chan ChangeEvent, func())       { return ls.table.Subscribe() }
+func (ls *LogStore) NormalizeKey(key string) string                { return ls.table.NormalizeKey(key) }
+func (ls *LogStore) Compact() int                                  { return ls.table.Compact() }
+func (ls *LogStore) Size() uint64                                  { return ls.table.Size() }
+func (ls *LogStore) MaxSize() uint64                               { return ls.table.MaxSize() }
+func (ls *LogStore) Count() int                                    { return ls.table.Count() }
+func (ls *LogStore) RejectedWrites() uint64                        { return ls.table.RejectedWrites() }
+func (ls *LogStore) RegionUsage() map[string]uint64                { return ls.table.RegionUsage() }
+func (ls *LogStore) VerifySize() (tracked, actual uint64, ok bool) { return ls.table.VerifySize() }
+func (ls *LogStore) VerifyPrefixSize(prefix string) (tracked, actual uint64, ok bool) {
+	return ls.table.VerifyPrefixSize(prefix)
+}
+func (ls *LogStore) Reserve(bytes uint64) (ReservationToken, error) { return ls.table.Reserve(bytes) }
+func (ls *LogStore) ReleaseReservation(tok ReservationToken) error {
+	return ls.table.ReleaseReservation(tok)
+}
+func (ls *LogStore) SegmentIndex(key string) int { return ls.table.SegmentIndex(key) }
+func (ls *LogStore) Config() TableConfig         { return ls.table.Config() }
+func (ls *LogStore) DistributionScore() float64  { return ls.table.DistributionScore() }
+func (ls *LogStore) Evictions() uint64           { return ls.table.Evictions() }
+func (ls *LogStore) LongLockHolds() uint64       { return ls.table.LongLockHolds() }
+func (ls *LogStore) DroppedChanges() uint64      { return ls.table.DroppedChanges() }
+
+// CompactLog rewrites the log as a header plus one record per live entry. The
+// table is scanned without blocking writes; records written meanwhile are
+// appended after the scan, which replays to the same state since each record
+// carries a whole entry. The new file replaces the old one atomically, so a
+// crash at any point leaves a complete log behind.
+func (ls *LogStore) CompactLog() error {
+	ls.compactMu.Lock()
+	defer ls.compactMu.Unlock()
+
+	ls.mu.Lock()
+	if err := ls.Err(); ls.closed || err != nil {
+		ls.mu.Unlock()
+		if err == nil {
+			err = fmt.Errorf("compact after close")
+		}
+		return err
+	}
+	ls.tail = new(bytes.Buffer)
+	ls.mu.Unlock()
+
+	tmp, records, err := ls.writeSnapshot()
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	tail := ls.tail
+	ls.tail = nil
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	// Anything still buffered for the old file was copied to the tail by write
+	if err := ls.w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	records += bytes.Count(tail.Bytes(), []byte{'\n'})
+	if _, err := tmp.Write(tail.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), ls.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(ls.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	file, err := os.OpenFile(ls.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		// The compacted file is in place but can't be appended to
+		ls.fail(err)
+		return err
+	}
+	ls.file.Close()
+	ls.file = file
+	ls.w = bufio.NewWriter(file)
+	ls.records = records
+	return nil
+}
+
+// writeSnapshot writes a header and every live entry to a temporary file next
+// to the log, returning it still open along with its record count
+func (ls *LogStore) writeSnapshot() (*os.File, int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(ls.path), filepath.Base(ls.path)+".compact-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	fail := func(err error) (*os.File, int, error) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(layoutHeader(ls.table)); err != nil {
+		return fail(err)
+	}
+	records := 1
+	ls.table.ForEach(func(key string, entry DataEntry) bool {
+		rec := logRecord{Op: ChangePut, Key: key, Entry: &entry, LastUpdated: entry.LastUpdated, ExpiresAt: entry.ExpiresAt, Slide: entry.slide}
+		if err = enc.Encode(rec); err != nil {
+			return false
+		}
+		records++
+		return true
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return tmp, records, nil
+}
+
+// enqueuePending hands the queued records to the background writer one at a
+// time, blocking while its queue is full. That backpressure only stalls the
+// writer calling it, never readers of the segment it wrote, and sendMu keeps
+// records in the order they were queued.
+func (ls *LogStore) enqueuePending() {
+	ls.sendMu.Lock()
+	defer ls.sendMu.Unlock()
+	lines, err := ls.takePending()
+	if err != nil || len(lines) == 0 {
+		return
+	}
+	ls.queueMu.RLock()
+	defer ls.queueMu.RUnlock()
+	if ls.queueClosed {
+		ls.fail(fmt.Errorf("write after close"))
+		return
+	}
+	for len(lines) > 0 {
+		n := bytes.IndexByte(lines, '\n') + 1
+		ls.queue <- lines[:n:n]
+		lines = lines[n:]
+	}
+}
+
+// drain is the async writer. It flushes whenever it runs out of queued records
+// so bursts are written together.
+func (ls *LogStore) drain() {
+	defer close(ls.drained)
+	for line := range ls.queue {
+		ls.mu.Lock()
+		err := ls.write(line)
+		if err == nil && len(ls.queue) == 0 {
+			err = ls.w.Flush()
+		}
+		if err != nil {
+			ls.fail(err)
+		}
+		ls.mu.Unlock()
+	}
+}
+
+// QueueDepth returns how many records are waiting for the async writer, always
+// 0 in synchronous mode
+func (ls *LogStore) QueueDepth() int {
+	return len(ls.queue)
+}
+
+// Err returns the first error hit while appending to the log, if any. Once set,
+// the log no longer reflects every write.
+func (ls *LogStore) Err() error {
+	ls.qmu.Lock()
+	defer ls.qmu.Unlock()
+	return ls.err
+}
+
+// Close drains any queued records, flushes and fsyncs the log and closes the file
+func (ls *LogStore) Close() error {
+	ls.compactMu.Lock()
+	defer ls.compactMu.Unlock()
+	if ls.queue != nil {
+		ls.queueMu.Lock()
+		if !ls.queueClosed {
+			ls.queueClosed = true
+			close(ls.queue)
+		}
+		ls.queueMu.Unlock()
+		<-ls.drained
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.qmu.Lock()
+	ls.closed = true
+	ls.qmu.Unlock()
+	// Records of writes that haven't committed yet, e.g. sweeper deletes
+	ls.writePending()
+	if err := ls.w.Flush(); err != nil {
+		ls.file.Close()
+		return err
+	}
+	if err := ls.file.Sync(); err != nil {
+		ls.file.Close()
+		return err
+	}
+	return ls.file.Close()
+}
@@ -0,0 +1,448 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openLog opens a LogStore at path over a fresh table, closing it when the test ends
+func openLog(t testing.TB, path string, opts ...LogStoreOption) *LogStore {
+	t.Helper()
+	ls, err := OpenLogStore(path, NewSegmentedHashTable(4, 0), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ls.Close() })
+	return ls
+}
+
+func countLines(t testing.TB, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestLogStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls := openLog(t, path)
+	fill(t, ls.table, 0) // no-op; writes below go through the LogStore
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		if err := ls.Put(key, testEntry(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ls.Delete("EU-3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := openLog(t, path)
+	if replayed.Count() != 9 {
+		t.Errorf("replayed %d entries, want 9", replayed.Count())
+	}
+	if _, err := replayed.Get("EU-3"); err != ErrKeyNotFound {
+		t.Errorf("deleted key replayed: %v", err)
+	}
+}
+
+func TestLogStoreCompactLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls := openLog(t, path, WithCompaction(0))
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("EU-%d", i)
+			if err := ls.Put(key, testEntry(key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	ls.Delete("EU-9")
+	if n := countLines(t, path); n != 1+200+1 {
+		t.Fatalf("log has %d lines before compaction, want 202", n)
+	}
+
+	if err := ls.CompactLog(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countLines(t, path); n != 1+9 {
+		t.Errorf("log has %d lines after compaction, want a header and 9 entries", n)
+	}
+
+	// The store keeps appending to the compacted file
+	if err := ls.Put("EU-10", testEntry("EU-10")); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ls.Get("EU-4")
+	if err := ls.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := openLog(t, path)
+	if replayed.Count() != 10 {
+		t.Errorf("replayed %d entries, want 10", replayed.Count())
+	}
+	got, err := replayed.Get("EU-4")
+	if err != nil || got.LastUpdated != want.LastUpdated || got.ModificationCount != want.ModificationCount {
+		t.Errorf("replayed EU-4 = %+v, %v; want %+v", got, err, want)
+	}
+}
+
+func TestLogStoreAutoCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls := openLog(t, path, WithCompaction(2))
+	for i := 0; i <= minCompactRecords; i++ {
+		if err := ls.Put("EU-A1", testEntry("EU-A1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for countLines(t, path) > 10 {
+		if time.Now().After(deadline) {
+			t.Fatalf("log still has %d lines for 1 entry", countLines(t, path))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Once the file can't be written, the write that hit the failure and every
+// write after it return an error instead of being acknowledged
+func TestLogStoreAppendFailureFailsWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls := openLog(t, path)
+	if err := ls.Put("EU-A1", testEntry("EU-A1")); err != nil {
+		t.Fatal(err)
+	}
+
+	ls.mu.Lock()
+	ls.file.Close()
+	ls.mu.Unlock()
+
+	if err := ls.Put("EU-A2", testEntry("EU-A2")); err == nil {
+		t.Fatal("Put succeeded though its record could not be written")
+	}
+	if ls.Err() == nil {
+		t.Error("Err is nil after a failed append")
+	}
+	if _, err := ls.Update("EU-A3", func(DataEntry, bool) (DataEntry, error) { return testEntry("EU-A3"), nil }); err == nil {
+		t.Error("Update accepted after the log failed")
+	}
+	if _, err := ls.Get("EU-A3"); err != ErrKeyNotFound {
+		t.Errorf("a refused write reached the table: %v", err)
+	}
+	if _, err := ls.Get("EU-A1"); err != nil {
+		t.Errorf("reads should keep working: %v", err)
+	}
+}
+
+// Records are written after the segment lock is released, so a reader of the
+// segment never waits on file I/O
+func TestLogStoreAppendsOutsideSegmentLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls := openLog(t, path)
+	table := ls.table
+
+	ls.mu.Lock() // stalls the file write
+	done := make(chan error, 1)
+	go func() { done <- ls.Put("EU-A1", testEntry("EU-A1")) }()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := table.Get("EU-A1"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			ls.mu.Unlock()
+			t.Fatal("Get blocked or never saw the write while its append was pending")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Error("Put returned before its record was written")
+	default:
+	}
+	ls.mu.Unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// With the async writer stalled and its queue full, writes wait for room but
+// reads of the keys they wrote, and of their segments, carry on
+func TestLogStoreAsyncFullQueueKeepsReadsFlowing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls := openLog(t, path, WithAsyncAppends(1))
+
+	ls.mu.Lock() // stalls the background writer
+	const n = 4
+	done := make(chan error, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		go func() { done <- ls.Put(key, testEntry(key)) }()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		for {
+			if _, err := ls.Get(key); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				ls.mu.Unlock()
+				t.Fatalf("Get(%s) blocked or never saw the write while the queue was full", key)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	ls.mu.Unlock()
+	for i := 0; i < n; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ls.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := openLog(t, path).Count(); got != n {
+		t.Errorf("replayed %d entries, want %d", got, n)
+	}
+}
+
+func TestLogStoreAsyncDrainsOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls := openLog(t, path, WithAsyncAppends(16))
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		if err := ls.Put(key, testEntry(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ls.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.Put("EU-late", testEntry("EU-late")); err == nil {
+		t.Error("Put after Close succeeded")
+	}
+	if got := openLog(t, path).Count(); got != 500 {
+		t.Errorf("replayed %d entries after Close, want all 500", got)
+	}
+}
+
+// A data file records the layout it was written with; reopening it under a
+// different segment count or hash warns, or fails under WithStrictLayout, and
+// a matching layout opens silently
+func TestLogStoreLayoutHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	ls, err := OpenLogStore(path, NewSegmentedHashTable(8, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		if err := ls.Put(key, testEntry(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ls.Close()
+
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"op":"header","segments":8,"segment_hash":"fnv"}`; !strings.HasPrefix(string(first), want+"\n") {
+		t.Fatalf("data file starts %.80q, want the header %s", first, want)
+	}
+
+	cases := []struct {
+		name     string
+		segments int
+		opts     []TableOption
+		mismatch bool
+	}{
+		{"matching", 8, nil, false},
+		{"segment count", 16, nil, true},
+		{"hash", 8, []TableOption{WithSegmentHash(SegmentHashMaphash)}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&out, nil))
+			table := NewSegmentedHashTable(tc.segments, 0, append(tc.opts, WithLogger(logger))...)
+			ls, err := OpenLogStore(path, table)
+			if err != nil {
+				t.Fatalf("lenient open: %v", err)
+			}
+			if n := ls.Count(); n != 10 {
+				t.Errorf("replayed %d entries, want 10 whatever the layout", n)
+			}
+			ls.Close()
+			if warned := strings.Contains(out.String(), ErrLayoutMismatch.Error()); warned != tc.mismatch {
+				t.Errorf("warned %v, want %v (log %q)", warned, tc.mismatch, out.String())
+			}
+
+			strict, err := OpenLogStore(path, NewSegmentedHashTable(tc.segments, 0, tc.opts...), WithStrictLayout())
+			if err == nil {
+				strict.Close()
+			}
+			if got := errors.Is(err, ErrLayoutMismatch); got != tc.mismatch {
+				t.Errorf("strict open: %v, want a layout mismatch %v", err, tc.mismatch)
+			}
+		})
+	}
+}
+
+// stored returns key's entry as the table holds it, expired or not
+func stored(table *SegmentedHashTable, key string) (DataEntry, bool) {
+	segment := table.getSegment(key)
+	segment.mu.RLock()
+	defer segment.mu.RUnlock()
+	entry, ok := segment.data[key]
+	return entry, ok
+}
+
+// Every way of changing a LogStore is in its log, so a reopened store holds
+// exactly what the old one did
+func TestLogStoreMutationsSurviveReopen(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(t *testing.T, ls *LogStore)
+		want   map[string]int // key -> ModificationCount of what must be stored
+	}{
+		{"Put", func(t *testing.T, ls *LogStore) {
+			ls.Put("EU-1", testEntry("EU-1"))
+		}, map[string]int{"EU-1": 1}},
+		{"PutBatch", func(t *testing.T, ls *LogStore) {
+			ls.PutBatch([]BatchRecord{{Key: "EU-1", Entry: testEntry("EU-1")}, {Key: "EU-2", Entry: testEntry("EU-2")}})
+		}, map[string]int{"EU-1": 1, "EU-2": 1}},
+		{"Apply", func(t *testing.T, ls *LogStore) {
+			ls.Put("EU-1", testEntry("EU-1"))
+			if err := ls.Apply([]TxnOp{{Key: "EU-1", Delete: true}, {Key: "EU-2", Entry: testEntry("EU-2")}}); err != nil {
+				t.Fatal(err)
+			}
+		}, map[string]int{"EU-2": 1}},
+		{"Update", func(t *testing.T, ls *LogStore) {
+			ls.Put("EU-1", testEntry("EU-1"))
+			ls.Update("EU-1", func(current DataEntry, _ bool) (DataEntry, error) {
+				current.ModificationCount = 5
+				return current, nil
+			})
+		}, map[string]int{"EU-1": 5}},
+		{"Delete", func(t *testing.T, ls *LogStore) {
+			ls.Put("EU-1", testEntry("EU-1"))
+			ls.Put("EU-2", testEntry("EU-2"))
+			ls.Delete("EU-1")
+		}, map[string]int{"EU-2": 1}},
+		{"DeleteIf", func(t *testing.T, ls *LogStore) {
+			ls.Put("EU-1", testEntry("EU-1"))
+			ls.DeleteIf("EU-1", func(DataEntry) error { return nil })
+		}, map[string]int{}},
+		{"PurgeOlderThan", func(t *testing.T, ls *LogStore) {
+			ls.Put("EU-1", testEntry("EU-1"))
+			ls.PurgeOlderThan(time.Now().Add(time.Second))
+		}, map[string]int{}},
+		{"Clear", func(t *testing.T, ls *LogStore) {
+			ls.Put("EU-1", testEntry("EU-1"))
+			ls.Put("EU-2", testEntry("EU-2"))
+			ls.Clear()
+		}, map[string]int{}},
+		{"PutReserved", func(t *testing.T, ls *LogStore) {
+			tok, err := ls.Reserve(1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ls.PutReserved(tok, "EU-1", testEntry("EU-1")); err != nil {
+				t.Fatal(err)
+			}
+		}, map[string]int{"EU-1": 1}},
+		{"SweepExpired", func(t *testing.T, ls *LogStore) {
+			entry := testEntry("EU-1")
+			entry.ExpiresAt = time.Now().Add(time.Millisecond).UnixNano()
+			ls.Put("EU-1", entry)
+			time.Sleep(5 * time.Millisecond)
+			if n := ls.SweepExpired(); n != 1 {
+				t.Fatalf("swept %d, want 1", n)
+			}
+		}, map[string]int{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.log")
+			ls := openLog(t, path)
+			tc.mutate(t, ls)
+			if err := ls.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened := openLog(t, path)
+			if n := reopened.table.Count(); n != len(tc.want) {
+				t.Errorf("reopened table holds %d entries, want %d", n, len(tc.want))
+			}
+			for key, version := range tc.want {
+				entry, ok := stored(reopened.table, key)
+				if !ok || entry.ModificationCount != version {
+					t.Errorf("%s after reopen = %+v (present %v), want version %d", key, entry, ok, version)
+				}
+			}
+		})
+	}
+}
+
+// A touch-on-read Get slides the expiry, and the slid deadline and its TTL are
+// what a reopened store has
+func TestLogStoreTouchSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.log")
+	const ttl = time.Hour
+	open := func() *LogStore {
+		ls, err := OpenLogStore(path, NewSegmentedHashTable(4, 0, WithTouchOnRead()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ls.Close() })
+		return ls
+	}
+
+	ls := open()
+	entry := testEntry("EU-1")
+	entry.ExpiresAt = time.Now().Add(ttl).UnixNano()
+	ls.Put("EU-1", entry)
+	time.Sleep(5 * time.Millisecond)
+	touched, err := ls.Get("EU-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if touched.ExpiresAt <= entry.ExpiresAt {
+		t.Fatalf("Get didn't slide the expiry: %d, was %d", touched.ExpiresAt, entry.ExpiresAt)
+	}
+	want, _ := stored(ls.table, "EU-1")
+	if err := ls.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := stored(open().table, "EU-1")
+	if !ok || got.ExpiresAt != touched.ExpiresAt {
+		t.Errorf("reopened expiry = %d, want the touched %d", got.ExpiresAt, touched.ExpiresAt)
+	}
+	if got.slide == 0 || got.slide != want.slide {
+		t.Errorf("reopened slide = %v, want %v", time.Duration(got.slide), time.Duration(want.slide))
+	}
+}
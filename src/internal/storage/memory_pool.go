@@ -2,12 +2,14 @@ package storage
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 // Pool of byte slices of fixed size
 type BytePool struct {
-	pool *sync.Pool
-	size int
+	pool     *sync.Pool
+	size     int
+	lastUsed atomic.Uint64 // PoolManager clock tick of the last Get, for LRU eviction
 }
 
 // Creates a new byte pool with slices of the specified size
@@ -43,8 +45,10 @@ func (p *BytePool) Put(b *[]byte) {
 }
 
 type PoolManager struct {
-	pools map[int]*BytePool
-	mu    sync.RWMutex
+	pools      map[int]*BytePool
+	mu         sync.RWMutex
+	maxClasses int           // 0 means unbounded
+	clock      atomic.Uint64 // bumped on every GetPool, orders pools by recency
 }
 
 func NewPoolManager() *PoolManager {
@@ -53,12 +57,21 @@ func NewPoolManager() *PoolManager {
 	}
 }
 
+// NewBoundedPoolManager caps the number of distinct size classes. Asking for a
+// new size once the cap is reached evicts the least recently used class.
+func NewBoundedPoolManager(maxClasses int) *PoolManager {
+	pm := NewPoolManager()
+	pm.maxClasses = maxClasses
+	return pm
+}
+
 func (pm *PoolManager) GetPool(size int) *BytePool {
 	pm.mu.RLock()
 	pool, ok := pm.pools[size]
 	pm.mu.RUnlock()
 
 	if ok {
+		pool.lastUsed.Store(pm.clock.Add(1))
 		return pool
 	}
 
@@ -71,19 +84,52 @@ func (pm *PoolManager) GetPool(size int) *BytePool {
 		return pool
 	}
 
+	if pm.maxClasses > 0 && len(pm.pools) >= pm.maxClasses {
+		pm.evictLRULocked()
+	}
 	pool = NewBytePool(size)
+	pool.lastUsed.Store(pm.clock.Add(1))
 	pm.pools[size] = pool
 	return pool
 }
 
+// evictLRULocked drops the least recently used size class. Buffers already
+// handed out from it are simply discarded when returned.
+func (pm *PoolManager) evictLRULocked() {
+	var victim *BytePool
+	for _, pool := range pm.pools {
+		if victim == nil || pool.lastUsed.Load() < victim.lastUsed.Load() {
+			victim = pool
+		}
+	}
+	if victim != nil {
+		delete(pm.pools, victim.size)
+	}
+}
+
+// ClassCount returns how many distinct size classes are currently pooled
+func (pm *PoolManager) ClassCount() int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return len(pm.pools)
+}
+
 // GetBuffer gets a buffer of the specified size from the appropriate pool
 func (pm *PoolManager) GetBuffer(size int) *[]byte {
 	return pm.GetPool(size).Get()
 }
 
-// PutBuffer returns a buffer to the appropriate pool
+// PutBuffer returns a buffer to the appropriate pool. Buffers whose size class
+// no longer exists (evicted, or never requested) are dropped rather than
+// creating a new class.
 func (pm *PoolManager) PutBuffer(buffer *[]byte) {
-	pm.GetPool(cap(*buffer)).Put(buffer)
+	pm.mu.RLock()
+	pool, ok := pm.pools[cap(*buffer)]
+	pm.mu.RUnlock()
+
+	if ok {
+		pool.Put(buffer)
+	}
 }
 
 // Cleanup releases all pools
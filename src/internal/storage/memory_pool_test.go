@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPoolManagerClassBound(t *testing.T) {
+	pm := NewBoundedPoolManager(8)
+	for size := 1; size <= 1000; size++ {
+		buf := pm.GetBuffer(size)
+		if len(*buf) != size {
+			t.Fatalf("GetBuffer(%d) returned %d bytes", size, len(*buf))
+		}
+		pm.PutBuffer(buf)
+		if n := pm.ClassCount(); n > 8 {
+			t.Fatalf("%d size classes after %d distinct sizes, want at most 8", n, size)
+		}
+	}
+	if n := pm.ClassCount(); n != 8 {
+		t.Errorf("ClassCount = %d, want 8", n)
+	}
+
+	// The least recently used class goes first: keep 1000 warm while new sizes arrive
+	for size := 2000; size < 2020; size++ {
+		pm.GetPool(1000)
+		pm.GetPool(size)
+	}
+	pm.mu.RLock()
+	_, kept := pm.pools[1000]
+	pm.mu.RUnlock()
+	if !kept {
+		t.Error("the most used class was evicted")
+	}
+
+	unbounded := NewPoolManager()
+	for size := 1; size <= 100; size++ {
+		unbounded.GetPool(size)
+	}
+	if n := unbounded.ClassCount(); n != 100 {
+		t.Errorf("unbounded ClassCount = %d, want 100", n)
+	}
+}
+
+func TestPoolManagerClassBoundConcurrent(t *testing.T) {
+	pm := NewBoundedPoolManager(4)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				buf := pm.GetBuffer(64 + (g*200+i)%50)
+				pm.PutBuffer(buf)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := pm.ClassCount(); n > 4 {
+		t.Errorf("ClassCount = %d under concurrent use, want at most 4", n)
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+// MissLoader fetches an entry the table doesn't hold, e.g. from a slower
+// backing store. It returns ErrKeyNotFound when the key doesn't exist there
+// either.
+type MissLoader func(key string) (DataEntry, error)
+
+// WithMissLoader makes Get fall back to fn for keys the table doesn't hold and
+// keep what it finds. Concurrent misses on the same key share a single call to
+// fn, so a key many clients are polling costs one backend lookup at a time.
+func WithMissLoader(fn MissLoader) TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.missLoader = fn
+	}
+}
+
+// loadMiss runs the miss loader for key, joining a load already in flight. A
+// loaded entry is stored before it is returned; if it doesn't fit it is still
+// served, just not kept.
+func (sht *SegmentedHashTable) loadMiss(key string) (DataEntry, error) {
+	v, err, _ := sht.misses.Do(key, func() (any, error) {
+		// A write may have landed while we waited to get here
+		if entry, err := sht.getLocal(key); err == nil {
+			return entry, nil
+		}
+		entry, err := sht.missLoader(key)
+		if err != nil {
+			return DataEntry{}, err
+		}
+		if sht.Put(key, entry) == nil {
+			if stored, err := sht.getLocal(key); err == nil {
+				entry = stored
+			}
+		}
+		return entry, nil
+	})
+	return v.(DataEntry), err
+}
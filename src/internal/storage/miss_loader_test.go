@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingLoader counts its calls and holds each one until release is closed,
+// so concurrent misses pile up behind the first
+type blockingLoader struct {
+	calls   atomic.Int32
+	entered chan struct{}
+	release chan struct{}
+	found   bool
+}
+
+func newBlockingLoader(found bool) *blockingLoader {
+	return &blockingLoader{entered: make(chan struct{}, 1), release: make(chan struct{}), found: found}
+}
+
+func (l *blockingLoader) load(key string) (DataEntry, error) {
+	l.calls.Add(1)
+	select {
+	case l.entered <- struct{}{}:
+	default:
+	}
+	<-l.release
+	if !l.found {
+		return DataEntry{}, ErrKeyNotFound
+	}
+	return DataEntry{LocationId: key, ModificationCount: 7}, nil
+}
+
+// getConcurrently runs n Gets of key at once, releasing the loader once the
+// first has reached it and the rest have had time to queue up behind it
+func getConcurrently(t *testing.T, table *SegmentedHashTable, loader *blockingLoader, key string, n int) ([]DataEntry, []error) {
+	t.Helper()
+	entries := make([]DataEntry, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entries[i], errs[i] = table.Get(key)
+		}(i)
+	}
+	select {
+	case <-loader.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("miss loader never called")
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(loader.release)
+	wg.Wait()
+	return entries, errs
+}
+
+func TestMissLoaderCoalesces(t *testing.T) {
+	const n = 50
+	loader := newBlockingLoader(true)
+	table := NewSegmentedHashTable(4, 10000, WithMissLoader(loader.load))
+
+	entries, errs := getConcurrently(t, table, loader, "EU-new", n)
+	if got := loader.calls.Load(); got != 1 {
+		t.Errorf("%d concurrent misses made %d loader calls, want 1", n, got)
+	}
+	for i := range entries {
+		if errs[i] != nil || entries[i].ModificationCount != 7 {
+			t.Fatalf("Get %d = %+v, %v; want the loaded entry", i, entries[i], errs[i])
+		}
+	}
+
+	// The loaded entry is kept, so the next miss never reaches the loader
+	if got := table.Count(); got != 1 {
+		t.Errorf("Count() = %d after the load, want 1", got)
+	}
+	if _, err := table.Get("EU-new"); err != nil {
+		t.Fatalf("Get after the load: %v", err)
+	}
+	if got := loader.calls.Load(); got != 1 {
+		t.Errorf("loader called %d times after the entry was stored, want 1", got)
+	}
+}
+
+func TestMissLoaderNotFound(t *testing.T) {
+	const n = 20
+	loader := newBlockingLoader(false)
+	table := NewSegmentedHashTable(4, 10000, WithMissLoader(loader.load))
+
+	_, errs := getConcurrently(t, table, loader, "EU-none", n)
+	if got := loader.calls.Load(); got != 1 {
+		t.Errorf("%d concurrent misses made %d loader calls, want 1", n, got)
+	}
+	for i, err := range errs {
+		if err != ErrKeyNotFound {
+			t.Fatalf("Get %d: got %v, want ErrKeyNotFound", i, err)
+		}
+	}
+	if got := table.Count(); got != 0 {
+		t.Errorf("Count() = %d after a failed load, want 0", got)
+	}
+}
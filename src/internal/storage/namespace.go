@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Separates a namespace from the key in stored keys
+const namespaceSeparator = ":"
+
+// Longest accepted namespace, in bytes
+const maxNamespaceLen = 64
+
+// ValidateNamespace checks ns is 1 to 64 ASCII letters, digits or '_', so it
+// can never contain the separator, nor the '-' that region parsing and
+// hash-suffix placement split keys on.
+func ValidateNamespace(ns string) error {
+	if ns == "" || len(ns) > maxNamespaceLen {
+		return fmt.Errorf("namespace must be 1 to %d characters", maxNamespaceLen)
+	}
+	for _, c := range ns {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		default:
+			return fmt.Errorf("namespace %q may only contain letters, digits and '_'", ns)
+		}
+	}
+	return nil
+}
+
+// Namespaced is a view of a Store in which every key is stored as
+// "namespace:key". Keys going in get the prefix and keys coming out (listings,
+// scans, the change feed, Inspect) have it stripped, and listings skip keys of
+// other namespaces, so several logical stores can share one table without their
+// keys colliding. The prefix is part of the stored key, so size accounting,
+// segment placement and region quotas (the region becomes "namespace:EU") all
+// see it.
+//
+// Maintenance that removes or reports on entries (Clear, PurgeOlderThan,
+// Compact's count, VerifySize) only touches this namespace. Store-wide figures
+// (Size, Count, MaxSize, RegionUsage, ...) are not scoped and cover every
+// namespace.
+type Namespaced struct {
+	Store
+	ns     string
+	prefix string
+}
+
+// NewNamespaced wraps store so all keys live under ns. ns must pass
+// ValidateNamespace.
+func NewNamespaced(store Store, ns string) (*Namespaced, error) {
+	if err := ValidateNamespace(ns); err != nil {
+		return nil, err
+	}
+	return &Namespaced{Store: store, ns: ns, prefix: store.NormalizeKey(ns + namespaceSeparator)}, nil
+}
+
+// key returns the stored form of a caller's key
+func (n *Namespaced) key(key string) string {
+	return n.prefix + key
+}
+
+// strip returns the caller's form of a stored key, false if it belongs to
+// another namespace
+func (n *Namespaced) strip(key string) (string, bool) {
+	if !strings.HasPrefix(key, n.prefix) {
+		return "", false
+	}
+	return key[len(n.prefix):], true
+}
+
+func (n *Namespaced) Get(key string) (DataEntry, error) {
+	return n.Store.Get(n.key(key))
+}
+
+func (n *Namespaced) Put(key string, entry DataEntry) error {
+	return n.Store.Put(n.key(key), entry)
+}
+
+func (n *Namespaced) PutBatch(records []BatchRecord) []error {
+	prefixed := make([]BatchRecord, len(records))
+	for i, rec := range records {
+		rec.Key = n.key(rec.Key)
+		prefixed[i] = rec
+	}
+	return n.Store.PutBatch(prefixed)
+}
+
+func (n *Namespaced) Apply(ops []TxnOp) error {
+	prefixed := make([]TxnOp, len(ops))
+	for i, op := range ops {
+		op.Key = n.key(op.Key)
+		prefixed[i] = op
+	}
+	return n.Store.Apply(prefixed)
+}
+
+func (n *Namespaced) Update(key string, fn func(current DataEntry, exists bool) (DataEntry, error)) (DataEntry, error) {
+	return n.Store.Update(n.key(key), fn)
+}
+
+func (n *Namespaced) Delete(key string) error {
+	return n.Store.Delete(n.key(key))
+}
+
+func (n *Namespaced) DeleteIf(key string, check func(current DataEntry) error) error {
+	return n.Store.DeleteIf(n.key(key), check)
+}
+
+func (n *Namespaced) ForEach(fn func(key string, entry DataEntry) bool) {
+	n.Store.ForEach(func(key string, entry DataEntry) bool {
+		if key, ok := n.strip(key); ok {
+			return fn(key, entry)
+		}
+		return true
+	})
+}
+
+func (n *Namespaced) GetKeys() []string {
+	keys := make([]string, 0)
+	for _, key := range n.Store.GetKeys() {
+		if key, ok := n.strip(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (n *Namespaced) Range(start, end string, limit int) []DataEntry {
+	return n.Store.Range(n.key(start), n.key(end), limit)
+}
+
+func (n *Namespaced) WithPrefix(prefix string, limit int) map[string]DataEntry {
+	out := make(map[string]DataEntry)
+	for key, entry := range n.Store.WithPrefix(n.key(prefix), limit) {
+		key, _ = n.strip(key)
+		out[key] = entry
+	}
+	return out
+}
+
+func (n *Namespaced) History(key string) ([]DataEntry, error) {
+	return n.Store.History(n.key(key))
+}
+
+func (n *Namespaced) Inspect(key string) (KeyInfo, error) {
+	info, err := n.Store.Inspect(n.key(key))
+	info.Key, _ = n.strip(info.Key)
+	return info, err
+}
+
+// Subscribe delivers only this namespace's events, with the prefix stripped.
+// Like the underlying feed it drops the oldest event rather than block.
+func (n *Namespaced) Subscribe() (<-chan ChangeEvent, func()) {
+	in, cancel := n.Store.Subscribe()
+	out := make(chan ChangeEvent, changeFeedBuffer)
+	go func() {
+		defer close(out)
+		for ev := range in {
+			key, ok := n.strip(ev.Key)
+			if !ok {
+				continue
+			}
+			ev.Key = key
+			select {
+			case out <- ev:
+				continue
+			default:
+			}
+			select {
+			case <-out:
+			default:
+			}
+			select {
+			case out <- ev:
+			default:
+			}
+		}
+	}()
+	return out, cancel
+}
+
+// NormalizeKey returns key as this namespace reports it, without the prefix
+func (n *Namespaced) NormalizeKey(key string) string {
+	key, _ = n.strip(n.Store.NormalizeKey(n.key(key)))
+	return key
+}
+
+// SegmentIndex reports the segment key's stored form lands in, when the
+// underlying store can tell
+func (n *Namespaced) SegmentIndex(key string) int {
+	if s, ok := n.Store.(interface{ SegmentIndex(string) int }); ok {
+		return s.SegmentIndex(n.key(key))
+	}
+	return -1
+}
+
+// Clear removes only this namespace's entries. They are deleted key by key,
+// so unlike the table's Clear a concurrent scan can see a segment part cleared.
+func (n *Namespaced) Clear() int {
+	cleared := 0
+	for _, key := range n.GetKeys() {
+		if n.Delete(key) == nil {
+			cleared++
+		}
+	}
+	return cleared
+}
+
+// PurgeOlderThan removes only this namespace's entries last written before
+// cutoff. Each goes with a conditional delete, so an entry rewritten meanwhile
+// is kept.
+func (n *Namespaced) PurgeOlderThan(cutoff time.Time) (purged int, reclaimed uint64) {
+	limit := cutoff.UnixNano()
+	var old []string
+	n.ForEach(func(key string, entry DataEntry) bool {
+		if entry.LastUpdated < limit {
+			old = append(old, key)
+		}
+		return true
+	})
+	for _, key := range old {
+		info, err := n.Store.Inspect(n.key(key))
+		if err != nil {
+			continue
+		}
+		err = n.Store.DeleteIf(n.key(key), func(current DataEntry) error {
+			if current.LastUpdated >= limit {
+				return errNotPurged
+			}
+			return nil
+		})
+		if err == nil {
+			purged++
+			reclaimed += info.ChargedBytes
+		}
+	}
+	return purged, reclaimed
+}
+
+// errNotPurged keeps an entry rewritten since PurgeOlderThan listed it
+var errNotPurged = errors.New("written after the purge cutoff")
+
+// Compact rebuilds the shared table's maps, which changes no namespace's
+// entries, and returns how many entries this namespace holds
+func (n *Namespaced) Compact() int {
+	n.Store.Compact()
+	return len(n.GetKeys())
+}
+
+// VerifySize checks size accounting with this namespace's share as the
+// figures; see SegmentedHashTable.VerifyPrefixSize. Stores that can't split
+// the check by prefix report for the whole store.
+func (n *Namespaced) VerifySize() (tracked, actual uint64, ok bool) {
+	if v, ok := n.Store.(interface {
+		VerifyPrefixSize(prefix string) (tracked, actual uint64, ok bool)
+	}); ok {
+		return v.VerifyPrefixSize(n.prefix)
+	}
+	return n.Store.VerifySize()
+}
+
+// Namespace returns the namespace keys are stored under
+func (n *Namespaced) Namespace() string {
+	return n.ns
+}
+
+// Unwrap returns the underlying store
+func (n *Namespaced) Unwrap() Store {
+	return n.Store
+}
+
+// Underlying returns the store beneath any Namespaced views, which is where
+// optional methods such as QueueDepth or Err live
+func Underlying(store Store) Store {
+	for {
+		u, ok := store.(interface{ Unwrap() Store })
+		if !ok {
+			return store
+		}
+		store = u.Unwrap()
+	}
+}
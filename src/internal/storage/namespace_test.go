@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newNamespaced(t testing.TB, store Store, ns string) *Namespaced {
+	t.Helper()
+	n, err := NewNamespaced(store, ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// The same key in two namespaces is two entries, each listed, ranged and
+// deleted only through its own namespace, and charged with its prefix
+func TestNamespacesDontCollide(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0)
+	a, b := newNamespaced(t, table, "a"), newNamespaced(t, table, "tenant_b")
+	a.Put("EU-1", DataEntry{LocationId: "EU-1", ModificationCount: 1})
+	b.Put("EU-1", DataEntry{LocationId: "EU-1", ModificationCount: 7})
+	b.Put("EU-2", DataEntry{LocationId: "EU-2", ModificationCount: 1})
+
+	if got, _ := a.Get("EU-1"); got.ModificationCount != 1 {
+		t.Errorf("a EU-1 = %+v, want its own entry", got)
+	}
+	if got, _ := b.Get("EU-1"); got.ModificationCount != 7 {
+		t.Errorf("tenant_b EU-1 = %+v, want its own entry", got)
+	}
+	if keys := a.GetKeys(); len(keys) != 1 || keys[0] != "EU-1" {
+		t.Errorf("a keys = %v, want [EU-1]", keys)
+	}
+	if n := len(b.WithPrefix("EU-", 0)); n != 2 {
+		t.Errorf("tenant_b prefix EU- = %d entries, want 2", n)
+	}
+	if n := len(a.Range("EU-0", "EU-9", 0)); n != 1 {
+		t.Errorf("a range = %d entries, want 1", n)
+	}
+
+	want := StructSizeEstimator("a:EU-1", DataEntry{LocationId: "EU-1"}) +
+		StructSizeEstimator("tenant_b:EU-1", DataEntry{LocationId: "EU-1"}) +
+		StructSizeEstimator("tenant_b:EU-2", DataEntry{LocationId: "EU-2"})
+	if got := table.Size(); got != want {
+		t.Errorf("Size() = %d, want %d with every prefix charged", got, want)
+	}
+
+	a.Delete("EU-1")
+	if _, err := b.Get("EU-1"); err != nil {
+		t.Errorf("deleting a EU-1 took tenant_b's: %v", err)
+	}
+
+	for _, ns := range []string{"", "a:b", "with space", string(make([]byte, 65))} {
+		if _, err := NewNamespaced(table, ns); err == nil {
+			t.Errorf("NewNamespaced(%q) accepted", ns)
+		}
+	}
+}
+
+// Purge, clear, compact and size checks through one namespace leave every
+// other namespace alone, over a plain table and a LogStore alike
+func TestNamespacedMaintenanceIsScoped(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		store func(t *testing.T) (Store, *SegmentedHashTable)
+	}{
+		{"table", func(t *testing.T) (Store, *SegmentedHashTable) {
+			table := NewSegmentedHashTable(4, 0)
+			return table, table
+		}},
+		{"log store", func(t *testing.T) (Store, *SegmentedHashTable) {
+			ls := openLog(t, filepath.Join(t.TempDir(), "data.log"))
+			return ls, ls.table
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store, table := tc.store(t)
+			a, b := newNamespaced(t, store, "a"), newNamespaced(t, store, "b")
+			old := time.Now().Add(-48 * time.Hour).UnixNano()
+			for _, key := range []string{"a:EU-old", "b:EU-old"} {
+				if err := table.restore(key, testEntry(key), old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			a.Put("EU-new", testEntry("EU-new"))
+			b.Put("EU-new", testEntry("EU-new"))
+
+			if tracked, actual, ok := a.VerifySize(); !ok || tracked != actual || actual != table.Size()/2 {
+				t.Errorf("a VerifySize = %d, %d, %v; want ok with half the table's %d bytes", tracked, actual, ok, table.Size())
+			}
+
+			size := table.Size()
+			purged, reclaimed := a.PurgeOlderThan(time.Now().Add(-24 * time.Hour))
+			if purged != 1 || reclaimed != size-table.Size() {
+				t.Errorf("a purge = %d entries, %d bytes; want 1, %d", purged, reclaimed, size-table.Size())
+			}
+			if _, err := b.Get("EU-old"); err != nil {
+				t.Errorf("a's purge removed b's old entry: %v", err)
+			}
+			if n := a.Compact(); n != 1 {
+				t.Errorf("a Compact() = %d, want a's 1 entry", n)
+			}
+
+			if n := a.Clear(); n != 1 {
+				t.Errorf("a Clear() = %d, want 1", n)
+			}
+			if keys := b.GetKeys(); len(keys) != 2 {
+				t.Errorf("b keys after clearing a = %v, want both kept", keys)
+			}
+			if tracked, actual, ok := b.VerifySize(); !ok || actual != table.Size() {
+				t.Errorf("b VerifySize = %d, %d, %v; want ok with all %d bytes", tracked, actual, ok, table.Size())
+			}
+		})
+	}
+}
+
+// A hyphen in a namespace would end up in the region, so it's refused; with an
+// underscore instead, the quota named "namespace:REGION" applies
+func TestNamespacedRegionQuota(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0, WithSizeEstimator(flatSize),
+		WithRegionQuotas(map[string]uint64{"my_ns:US": 200}))
+	if _, err := NewNamespaced(table, "my-ns"); err == nil {
+		t.Fatal("NewNamespaced accepted a namespace with '-'")
+	}
+
+	ns := newNamespaced(t, table, "my_ns")
+	for _, key := range []string{"US-1", "US-2"} {
+		if err := ns.Put(key, testEntry(key)); err != nil {
+			t.Fatalf("Put(%s) within quota: %v", key, err)
+		}
+	}
+	if err := ns.Put("US-3", testEntry("US-3")); err != ErrQuotaExceeded {
+		t.Fatalf("Put past my_ns:US's quota: got %v, want ErrQuotaExceeded", err)
+	}
+	if err := ns.Put("EU-1", testEntry("EU-1")); err != nil {
+		t.Errorf("Put in another region of the namespace: %v", err)
+	}
+	usage := table.RegionUsage()
+	if usage["my_ns:US"] != 200 || usage["my_ns:EU"] != 100 {
+		t.Errorf("RegionUsage = %v, want my_ns:US at 200 and my_ns:EU at 100", usage)
+	}
+}
+
+func TestRegionOf(t *testing.T) {
+	for key, want := range map[string]string{
+		"EU-1":          "EU",
+		"EU":            "EU",
+		"my_ns:US-1":    "my_ns:US",
+		"my_ns:US-1-2b": "my_ns:US",
+	} {
+		if got := RegionOf(key); got != want {
+			t.Errorf("RegionOf(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+)
+
+// placement pins keys to the segment they were first written to when balanced
+// placement is on. An entry is removed, under the key's segment lock, as soon
+// as the key leaves the table. Writers confirm their key's placement once they
+// hold the segment lock (see lockSegments), so a writer that raced a delete
+// places the key again rather than writing where Get won't look.
+type placement struct {
+	mu    sync.RWMutex
+	index map[string]uint64
+}
+
+// WithBalancedPlacement puts each new key in the segment currently holding the
+// fewest entries instead of its hash segment, recording the choice in a
+// key->segment index. Segments stay evenly loaded regardless of key skew, at
+// the cost of an index lookup on every operation and memory for every live key.
+func WithBalancedPlacement() TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.placement = &placement{index: make(map[string]uint64)}
+	}
+}
+
+// lookup returns where key lives, or its hash segment if it was never placed
+// (a lookup there simply misses)
+func (sht *SegmentedHashTable) lookupIndex(key string) uint64 {
+	if sht.placement == nil {
+		return sht.hashIndex(key)
+	}
+	sht.placement.mu.RLock()
+	idx, ok := sht.placement.index[key]
+	sht.placement.mu.RUnlock()
+	if !ok {
+		return sht.hashIndex(key)
+	}
+	return idx
+}
+
+// placeIndex returns the segment a write to key must go to, assigning the least
+// loaded segment to keys seen for the first time
+func (sht *SegmentedHashTable) placeIndex(key string) uint64 {
+	if sht.placement == nil {
+		return sht.hashIndex(key)
+	}
+	p := sht.placement
+	p.mu.RLock()
+	idx, ok := p.index[key]
+	p.mu.RUnlock()
+	if ok {
+		return idx
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if idx, ok := p.index[key]; ok {
+		return idx
+	}
+	best := uint64(0)
+	for i := range sht.segments {
+		if sht.segments[i].count.Load() < sht.segments[best].count.Load() {
+			best = uint64(i)
+		}
+	}
+	p.index[key] = best
+	return best
+}
+
+// placedAt reports whether key is placed in segment idx: indexed there when
+// create is set, otherwise wherever lookupIndex would look. The caller holds
+// p.mu.
+func (sht *SegmentedHashTable) placedAt(key string, idx uint64, create bool) bool {
+	got, ok := sht.placement.index[key]
+	if !ok {
+		return !create && idx == sht.hashIndex(key)
+	}
+	return got == idx
+}
+
+// unplaceLocked forgets where key lives once it has left the table. The caller
+// holds the write lock of the segment key was placed in.
+func (sht *SegmentedHashTable) unplaceLocked(key string) {
+	if sht.placement == nil {
+		return
+	}
+	sht.placement.mu.Lock()
+	delete(sht.placement.index, key)
+	sht.placement.mu.Unlock()
+}
+
+// lockSegments write-locks the segments holding keys, in ascending index order
+// so concurrent callers can't deadlock, and returns each key's segment index.
+// Keys that may be created (create nil means all) are placed first. Under
+// balanced placement every key's placement is confirmed once the locks are
+// held, starting over if a concurrent delete unplaced one in between.
+//
+// unlock forgets the placement of any key that isn't in the table by then,
+// e.g. a create that was refused, before releasing the locks.
+func (sht *SegmentedHashTable) lockSegments(keys []string, create []bool) (idx []uint64, unlock func()) {
+	creates := func(i int) bool { return create == nil || create[i] }
+	idx = make([]uint64, len(keys))
+	for {
+		for i, key := range keys {
+			if creates(i) {
+				idx[i] = sht.placeIndex(key)
+			} else {
+				idx[i] = sht.lookupIndex(key)
+			}
+		}
+		order := append([]uint64(nil), idx...)
+		sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+		n := 0
+		for i, seg := range order {
+			if i == 0 || seg != order[n-1] {
+				order[n] = seg
+				n++
+			}
+		}
+		order = order[:n]
+		for _, seg := range order {
+			sht.segments[seg].mu.Lock()
+		}
+		unlockAll := func() {
+			for _, seg := range order {
+				sht.segments[seg].mu.Unlock()
+			}
+		}
+		if sht.placement == nil {
+			return idx, unlockAll
+		}
+
+		placed := true
+		sht.placement.mu.RLock()
+		for i, key := range keys {
+			if !sht.placedAt(key, idx[i], creates(i)) {
+				placed = false
+				break
+			}
+		}
+		sht.placement.mu.RUnlock()
+		if !placed {
+			unlockAll()
+			continue
+		}
+		return idx, func() {
+			for i, key := range keys {
+				if _, ok := sht.segments[idx[i]].data[key]; !ok {
+					sht.unplaceLocked(key)
+				}
+			}
+			unlockAll()
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func placed(sht *SegmentedHashTable) int {
+	sht.placement.mu.RLock()
+	defer sht.placement.mu.RUnlock()
+	return len(sht.placement.index)
+}
+
+// skewedKeys returns n keys that all hash to segment 0 of a 16-segment table
+func skewedKeys(n int) []string {
+	plain := NewSegmentedHashTable(16, 0)
+	var keys []string
+	for i := 0; len(keys) < n; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		if plain.SegmentIndex(key) == 0 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestBalancedPlacementSpreadsSkewedKeys(t *testing.T) {
+	keys := skewedKeys(160)
+	plain := NewSegmentedHashTable(16, 0)
+	balanced := NewSegmentedHashTable(16, 0, WithBalancedPlacement())
+	for _, key := range keys {
+		plain.Put(key, testEntry(key))
+		balanced.Put(key, testEntry(key))
+	}
+	if score := plain.DistributionScore(); score > 0.1 {
+		t.Fatalf("hash placement scored %.2f on keys chosen to collide", score)
+	}
+	if score := balanced.DistributionScore(); score < 0.99 {
+		t.Errorf("balanced placement scored %.2f, want the 160 keys spread evenly", score)
+	}
+	for _, key := range keys {
+		if _, err := balanced.Get(key); err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+	}
+}
+
+// The index holds live keys only, whichever way a key leaves the table
+func TestPlacementPrunedOnRemoval(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0, WithBalancedPlacement())
+	fill(t, table, 10)
+	if placed(table) != 10 {
+		t.Fatalf("index holds %d keys, want 10", placed(table))
+	}
+
+	table.Delete("EU-0")
+	table.DeleteIf("EU-1", func(DataEntry) error { return nil })
+	table.Apply([]TxnOp{{Key: "EU-2", Delete: true}})
+	table.PurgeOlderThan(time.Now().Add(-time.Hour)) // nothing that old
+	if placed(table) != 7 {
+		t.Errorf("index holds %d keys after 3 deletes, want 7", placed(table))
+	}
+
+	table.Put("EU-3", DataEntry{LocationId: "EU-3", ExpiresAt: time.Now().Add(-time.Second).UnixNano()})
+	table.SweepExpired()
+	if placed(table) != 6 {
+		t.Errorf("index holds %d keys after an expiry sweep, want 6", placed(table))
+	}
+
+	// Creates that never land leave nothing behind
+	table.Update("EU-NEW", func(DataEntry, bool) (DataEntry, error) { return DataEntry{}, ErrKeyNotFound })
+	table.Apply([]TxnOp{{Key: "EU-NEW2"}, {Key: "EU-MISSING", Delete: true}})
+	if placed(table) != 6 {
+		t.Errorf("index holds %d keys after refused creates, want 6", placed(table))
+	}
+
+	table.PurgeOlderThan(time.Now().Add(time.Hour))
+	if placed(table) != 0 || table.Count() != 0 {
+		t.Errorf("index holds %d keys, table %d, after purging everything", placed(table), table.Count())
+	}
+
+	fill(t, table, 10)
+	table.Clear()
+	if placed(table) != 0 {
+		t.Errorf("index holds %d keys after Clear", placed(table))
+	}
+}
+
+// A write racing a delete of the same key must never strand the key outside
+// the segment its index entry points to
+func TestPlacementRecreateRace(t *testing.T) {
+	table := NewSegmentedHashTable(8, 0, WithBalancedPlacement())
+	const key = "EU-A1"
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				table.Put(key, testEntry(key))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				table.Delete(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	copies := 0
+	for _, segment := range table.segments {
+		if _, ok := segment.data[key]; ok {
+			copies++
+		}
+	}
+	_, err := table.Get(key)
+	switch {
+	case copies > 1:
+		t.Fatalf("key stored in %d segments", copies)
+	case copies == 1 && err != nil:
+		t.Fatalf("key stored but Get fails: %v", err)
+	case copies == 0 && placed(table) != 0:
+		t.Fatal("deleted key left in the index")
+	}
+}
+
+// BenchmarkPlacementGet compares lookup cost with and without the placement index
+func BenchmarkPlacementGet(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []TableOption
+	}{
+		{"hash", nil},
+		{"balanced", []TableOption{WithBalancedPlacement()}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			table := NewSegmentedHashTable(16, 0, tc.opts...)
+			keys := skewedKeys(1000)
+			for _, key := range keys {
+				table.Put(key, testEntry(key))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				table.Get(keys[i%len(keys)])
+			}
+			b.ReportMetric(table.DistributionScore(), "balance")
+		})
+	}
+}
+
+// BenchmarkPlacementPutDelete measures the index upkeep on key churn
+func BenchmarkPlacementPutDelete(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []TableOption
+	}{
+		{"hash", nil},
+		{"balanced", []TableOption{WithBalancedPlacement()}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			table := NewSegmentedHashTable(16, 0, tc.opts...)
+			for i := 0; i < b.N; i++ {
+				key := fmt.Sprintf("EU-%d", i%1024)
+				table.Put(key, testEntry(key))
+				table.Delete(key)
+			}
+		})
+	}
+}
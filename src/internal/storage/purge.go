@@ -0,0 +1,27 @@
+package storage
+
+import "time"
+
+// PurgeOlderThan removes every entry last written before cutoff, whatever its
+// TTL, returning how many were removed and the bytes released. Segments are
+// purged one at a time under their write lock.
+func (sht *SegmentedHashTable) PurgeOlderThan(cutoff time.Time) (purged int, reclaimed uint64) {
+	limit := cutoff.UnixNano()
+	for _, segment := range sht.segments {
+		segment.mu.Lock()
+		for key, entry := range segment.data {
+			if entry.LastUpdated >= limit {
+				continue
+			}
+			size := sht.estimateSize(key, entry)
+			if h, ok := segment.history[key]; ok {
+				size += h.bytes
+			}
+			sht.removeLocked(segment, key, entry)
+			purged++
+			reclaimed += size
+		}
+		segment.mu.Unlock()
+	}
+	return purged, reclaimed
+}
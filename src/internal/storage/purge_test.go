@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Only entries last written before the cutoff go, with their history, and the
+// bytes reported match what the table stops charging
+func TestPurgeOlderThan(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0, WithHistory(3))
+	now := time.Now()
+	ages := []time.Duration{time.Minute, 12 * time.Hour, 23 * time.Hour, 25 * time.Hour, 48 * time.Hour, 30 * 24 * time.Hour}
+	for i, age := range ages {
+		key := fmt.Sprintf("EU-%d", i)
+		if err := table.restore(key, testEntry(key), now.Add(-age).UnixNano()); err != nil {
+			t.Fatalf("restore(%s): %v", key, err)
+		}
+	}
+	// A key with history written long ago, whose series goes with it
+	table.Put("EU-old", testEntry("EU-old"))
+	table.Put("EU-old", testEntry("EU-old"))
+	segment := table.segments[table.SegmentIndex("EU-old")]
+	segment.mu.Lock()
+	entry := segment.data["EU-old"]
+	entry.LastUpdated = now.Add(-72 * time.Hour).UnixNano()
+	segment.data["EU-old"] = entry
+	segment.mu.Unlock()
+
+	before := table.Size()
+	purged, reclaimed := table.PurgeOlderThan(now.Add(-24 * time.Hour))
+	if purged != 4 {
+		t.Errorf("purged %d entries, want the 4 older than a day", purged)
+	}
+	if got := before - table.Size(); got != reclaimed {
+		t.Errorf("reported %d bytes reclaimed, table shrank by %d", reclaimed, got)
+	}
+	if tracked, actual, ok := table.VerifySize(); !ok {
+		t.Errorf("after purge: tracked %d bytes, actual %d", tracked, actual)
+	}
+	for i, age := range ages {
+		key := fmt.Sprintf("EU-%d", i)
+		_, err := table.Get(key)
+		if kept := age < 24*time.Hour; kept != (err == nil) {
+			t.Errorf("%s aged %v: Get error %v, kept = %v", key, age, err, kept)
+		}
+	}
+	if _, err := table.History("EU-old"); err != ErrKeyNotFound {
+		t.Errorf("History of a purged key: got %v, want ErrKeyNotFound", err)
+	}
+}
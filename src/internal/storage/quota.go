@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var ErrQuotaExceeded = errors.New("region quota exceeded") // to be cascaded to 429
+
+// regionQuotas tracks bytes charged per region (the key prefix before the first
+// '-') and caps the regions that have a quota
+type regionQuotas struct {
+	mu     sync.Mutex
+	limits map[string]uint64
+	usage  map[string]uint64
+}
+
+// WithRegionQuotas caps how many bytes each listed region may use, so one
+// region's sensors can't consume the whole store. A region is the key prefix
+// before the first '-'; regions without a quota are tracked but unlimited.
+func WithRegionQuotas(limits map[string]uint64) TableOption {
+	return func(sht *SegmentedHashTable) {
+		q := &regionQuotas{
+			limits: make(map[string]uint64, len(limits)),
+			usage:  make(map[string]uint64),
+		}
+		for region, limit := range limits {
+			q.limits[region] = limit
+		}
+		sht.quotas = q
+	}
+}
+
+// RegionOf is the region a key belongs to: everything before its first '-'.
+// Namespaces can't contain '-', so a namespaced key's region is "namespace:EU".
+func RegionOf(key string) string {
+	region, _, _ := strings.Cut(key, "-")
+	return region
+}
+
+// charge moves region's usage from oldSize to newSize bytes, refusing growth
+// past its quota
+func (q *regionQuotas) charge(region string, oldSize, newSize uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	used := q.usage[region]
+	if newSize > oldSize {
+		grown, ok := addSize(used, newSize-oldSize)
+		if !ok {
+			return ErrInsufficientMemory
+		}
+		if limit, capped := q.limits[region]; capped && grown > limit {
+			return ErrQuotaExceeded
+		}
+	}
+	used = used - oldSize + newSize
+	if used == 0 {
+		delete(q.usage, region)
+	} else {
+		q.usage[region] = used
+	}
+	return nil
+}
+
+// RegionUsage returns the bytes used per region, or nil when region quotas
+// are off
+func (sht *SegmentedHashTable) RegionUsage() map[string]uint64 {
+	if sht.quotas == nil {
+		return nil
+	}
+	sht.quotas.mu.Lock()
+	defer sht.quotas.mu.Unlock()
+
+	out := make(map[string]uint64, len(sht.quotas.usage))
+	for region, used := range sht.quotas.usage {
+		out[region] = used
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRegionQuota(t *testing.T) {
+	table := NewSegmentedHashTable(4, 10000, WithSizeEstimator(flatSize),
+		WithRegionQuotas(map[string]uint64{"EU": 300}))
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		if err := table.Put(key, testEntry(key)); err != nil {
+			t.Fatalf("Put(%s) within quota: %v", key, err)
+		}
+	}
+	if err := table.Put("EU-3", testEntry("EU-3")); err != ErrQuotaExceeded {
+		t.Fatalf("Put past EU's quota: got %v, want ErrQuotaExceeded", err)
+	}
+	// Overwriting in place doesn't grow the region
+	if err := table.Put("EU-0", testEntry("EU-0")); err != nil {
+		t.Errorf("overwrite at quota: %v", err)
+	}
+	// Other regions, capped or not, still accept writes
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("US-%d", i)
+		if err := table.Put(key, testEntry(key)); err != nil {
+			t.Fatalf("Put(%s) in an unlimited region: %v", key, err)
+		}
+	}
+
+	usage := table.RegionUsage()
+	if usage["EU"] != 300 || usage["US"] != 500 {
+		t.Errorf("RegionUsage() = %v, want EU:300 US:500", usage)
+	}
+	if got := table.Size(); got != 800 {
+		t.Errorf("Size() = %d after a refused write, want 800", got)
+	}
+
+	// Deleting frees quota for new keys
+	if err := table.Delete("EU-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Put("EU-3", testEntry("EU-3")); err != nil {
+		t.Errorf("Put after freeing quota: %v", err)
+	}
+	table.Clear()
+	if usage := table.RegionUsage(); len(usage) != 0 {
+		t.Errorf("RegionUsage() = %v after Clear, want empty", usage)
+	}
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrUnknownReservation = errors.New("unknown or expired reservation")
+
+// How long an unused reservation holds capacity before it lapses
+const defaultReservationTTL = 30 * time.Second
+
+// ReservationToken identifies capacity set aside by Reserve; 0 is never issued
+type ReservationToken uint64
+
+type reservation struct {
+	remaining uint64
+	expires   time.Time
+}
+
+// WithReservationTTL sets how long reserved capacity is held before an
+// abandoned reservation is returned to the pool
+func WithReservationTTL(ttl time.Duration) TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.reservationTTL = ttl
+	}
+}
+
+// Reserve sets aside bytes of capacity for an upcoming bulk write, failing with
+// ErrInsufficientMemory up front if they won't fit. Writes made through
+// PutReserved draw the reservation down; ReleaseReservation hands back whatever
+// is left. Reservations lapse after the reservation TTL so abandoned ones can't
+// leak capacity.
+func (sht *SegmentedHashTable) Reserve(bytes uint64) (ReservationToken, error) {
+	sht.sizeLock.Lock()
+	defer sht.sizeLock.Unlock()
+
+	now := sht.clock()
+	sht.expireReservationsLocked(now)
+	if !sht.fitsLocked(sht.currentSize, bytes) {
+		return 0, ErrInsufficientMemory
+	}
+
+	if sht.reservations == nil {
+		sht.reservations = make(map[ReservationToken]*reservation)
+	}
+	sht.nextReservation++
+	tok := sht.nextReservation
+	ttl := sht.reservationTTL
+	if ttl <= 0 {
+		ttl = defaultReservationTTL
+	}
+	sht.reservations[tok] = &reservation{remaining: bytes, expires: now.Add(ttl)}
+	sht.reservedBytes += bytes
+	return tok, nil
+}
+
+// ReleaseReservation returns a reservation's unused capacity
+func (sht *SegmentedHashTable) ReleaseReservation(tok ReservationToken) error {
+	sht.sizeLock.Lock()
+	defer sht.sizeLock.Unlock()
+
+	r, ok := sht.reservations[tok]
+	if !ok {
+		return ErrUnknownReservation
+	}
+	sht.reservedBytes -= r.remaining
+	delete(sht.reservations, tok)
+	return nil
+}
+
+// PutReserved is Put, charging growth to the reservation first and only then to
+// free capacity
+func (sht *SegmentedHashTable) PutReserved(tok ReservationToken, key string, entry DataEntry) error {
+	key = sht.NormalizeKey(key)
+	idx, unlock := sht.lockSegments([]string{key}, nil)
+	defer unlock()
+
+	_, err := sht.storeLockedReserved(sht.segments[idx[0]], key, entry, tok)
+	return err
+}
+
+func (sht *SegmentedHashTable) expireReservationsLocked(now time.Time) {
+	for tok, r := range sht.reservations {
+		if now.After(r.expires) {
+			sht.reservedBytes -= r.remaining
+			delete(sht.reservations, tok)
+		}
+	}
+}
+
+// charge moves the table's usage from oldSize to newSize bytes for one key,
+// drawing growth from reservation tok (if any) before free capacity.
+// Nothing changes when it returns ErrInsufficientMemory.
+func (sht *SegmentedHashTable) charge(oldSize, newSize uint64, tok ReservationToken) error {
+	sht.sizeLock.Lock()
+	defer sht.sizeLock.Unlock()
+
+	if newSize <= oldSize {
+		sht.releaseLocked(oldSize - newSize)
+		return nil
+	}
+	delta := newSize - oldSize
+
+	var r *reservation
+	var fromReservation uint64
+	if tok != 0 {
+		r = sht.reservations[tok]
+		if r != nil && sht.clock().After(r.expires) {
+			sht.expireReservationsLocked(sht.clock())
+			r = nil
+		}
+		if r != nil {
+			fromReservation = min(delta, r.remaining)
+		}
+	}
+
+	need := delta - fromReservation
+	if need > 0 && !sht.fitsLocked(sht.currentSize, need) {
+		// Abandoned reservations may be what's in the way
+		sht.expireReservationsLocked(sht.clock())
+		if !sht.fitsLocked(sht.currentSize, need) {
+			return ErrInsufficientMemory
+		}
+	}
+
+	if r != nil {
+		r.remaining -= fromReservation
+		sht.reservedBytes -= fromReservation
+	}
+	sht.currentSize += delta
+	return nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// Writes through a reservation draw it down while other writes only see the
+// capacity left outside it, and releasing it hands back what wasn't used
+func TestPutReserved(t *testing.T) {
+	table := NewSegmentedHashTable(4, 400, WithSizeEstimator(flatSize))
+	tok, err := table.Reserve(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Put("US-1", testEntry("US-1")); err != nil {
+		t.Fatalf("Put into the unreserved 100 bytes: %v", err)
+	}
+	if err := table.Put("US-2", testEntry("US-2")); err != ErrInsufficientMemory {
+		t.Fatalf("Put into reserved capacity: got %v, want ErrInsufficientMemory", err)
+	}
+	for _, key := range []string{"EU-1", "EU-2"} {
+		if err := table.PutReserved(tok, key, testEntry(key)); err != nil {
+			t.Fatalf("PutReserved(%s): %v", key, err)
+		}
+	}
+	if got := table.Size(); got != 300 {
+		t.Errorf("Size() = %d, want 300", got)
+	}
+	// The 100 bytes still reserved stay off limits to ordinary writes
+	if err := table.Put("US-2", testEntry("US-2")); err != ErrInsufficientMemory {
+		t.Errorf("Put with 100 bytes still reserved: got %v, want ErrInsufficientMemory", err)
+	}
+
+	if err := table.ReleaseReservation(tok); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Put("US-2", testEntry("US-2")); err != nil {
+		t.Errorf("Put after releasing the rest of the reservation: %v", err)
+	}
+	if err := table.ReleaseReservation(tok); err != ErrUnknownReservation {
+		t.Errorf("second ReleaseReservation: got %v, want ErrUnknownReservation", err)
+	}
+	if tracked, actual, ok := table.VerifySize(); !ok || actual != 400 {
+		t.Errorf("VerifySize = %d tracked, %d actual, want 400", tracked, actual)
+	}
+}
+
+// A reservation nobody releases lapses after its TTL and its bytes become
+// available to ordinary writes again
+func TestReservationExpires(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	table := NewSegmentedHashTable(4, 300, WithSizeEstimator(flatSize),
+		WithClock(func() time.Time { return now }), WithReservationTTL(time.Minute))
+	tok, err := table.Reserve(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Put("EU-1", testEntry("EU-1")); err != ErrInsufficientMemory {
+		t.Fatalf("Put with everything reserved: got %v, want ErrInsufficientMemory", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	fill(t, table, 3)
+	if got := table.Size(); got != 300 {
+		t.Errorf("Size() = %d, want the reservation's 300 bytes in use", got)
+	}
+	if err := table.ReleaseReservation(tok); err != ErrUnknownReservation {
+		t.Errorf("releasing a lapsed reservation: got %v, want ErrUnknownReservation", err)
+	}
+	// A lapsed token is no better than none
+	if err := table.PutReserved(tok, "EU-3", testEntry("EU-3")); err != ErrInsufficientMemory {
+		t.Errorf("PutReserved on a lapsed reservation into a full table: got %v, want ErrInsufficientMemory", err)
+	}
+}
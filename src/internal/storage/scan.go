@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// Range returns the entries whose keys fall lexically within [start, end], sorted
+// by key. Segments keep no ordering, so this is an O(n) scan of the whole table
+// followed by a sort of the matches. A limit <= 0 means no limit.
+func (sht *SegmentedHashTable) Range(start, end string, limit int) []DataEntry {
+	start, end = sht.NormalizeKey(start), sht.NormalizeKey(end)
+	var matches []keyedEntry
+	sht.ForEach(func(key string, entry DataEntry) bool {
+		if key >= start && key <= end {
+			matches = append(matches, keyedEntry{key: key, entry: entry})
+		}
+		return true
+	})
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].key < matches[j].key })
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	out := make([]DataEntry, len(matches))
+	for i, m := range matches {
+		out[i] = m.entry
+	}
+	return out
+}
+
+// WithPrefix returns every entry whose key starts with prefix, keyed by key. With
+// a limit > 0 the scan stops once that many matches are collected, so which
+// entries are returned is unspecified.
+func (sht *SegmentedHashTable) WithPrefix(prefix string, limit int) map[string]DataEntry {
+	prefix = sht.NormalizeKey(prefix)
+	out := make(map[string]DataEntry)
+	sht.ForEach(func(key string, entry DataEntry) bool {
+		if strings.HasPrefix(key, prefix) {
+			out[key] = entry
+		}
+		return limit <= 0 || len(out) < limit
+	})
+	return out
+}
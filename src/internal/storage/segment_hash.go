@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"hash/maphash"
+)
+
+type SegmentHash int
+
+const (
+	SegmentHashFNV     SegmentHash = iota // FNV-1a (default)
+	SegmentHashMaphash                    // runtime maphash, randomly seeded per table
+)
+
+// String returns the name the hash is recorded under in data file headers
+func (h SegmentHash) String() string {
+	if h == SegmentHashMaphash {
+		return "maphash"
+	}
+	return "fnv"
+}
+
+// WithSegmentHash picks the hash used for segment selection. FNV-1a is fast but
+// mixes its low bits weakly on short, similar keys like "EU-0001"/"EU-0002",
+// which can skew segments; maphash mixes more thoroughly at similar speed. maphash is seeded per
+// table, so placement differs between runs, which is harmless for an in-memory
+// table but rules out persisting segment indexes.
+func WithSegmentHash(h SegmentHash) TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.segmentHash = h
+		if h == SegmentHashMaphash {
+			sht.hashSeed = maphash.MakeSeed()
+		}
+	}
+}
+
+// hashKey hashes the (already salt/suffix-adjusted) key with the table's hash
+func (sht *SegmentedHashTable) hashKey(key string) uint64 {
+	if sht.segmentHash == SegmentHashMaphash {
+		var h maphash.Hash
+		h.SetSeed(sht.hashSeed)
+		h.WriteString(sht.hashSalt)
+		h.WriteString(key)
+		return h.Sum64()
+	}
+	if sht.hashSalt != "" {
+		return fnv1aExtend(fnv1a(sht.hashSalt), key)
+	}
+	return fnv1a(key)
+}
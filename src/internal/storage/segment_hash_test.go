@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+// sensorKeys is a realistic key set: a few region prefixes, each with
+// sequential zero-padded sensor numbers
+func sensorKeys() []string {
+	var keys []string
+	for _, region := range []string{"EU", "US", "AS", "AF"} {
+		for i := 0; i < 2000; i++ {
+			keys = append(keys, fmt.Sprintf("%s-%05d", region, i))
+		}
+	}
+	return keys
+}
+
+// chiSquare is Pearson's statistic for keys spread across table's segments
+// against a uniform spread
+func chiSquare(table *SegmentedHashTable, keys []string) float64 {
+	counts := make([]int, len(table.segments))
+	for _, key := range keys {
+		counts[table.SegmentIndex(key)]++
+	}
+	expected := float64(len(keys)) / float64(len(counts))
+	var chi2 float64
+	for _, c := range counts {
+		d := float64(c) - expected
+		chi2 += d * d / expected
+	}
+	return chi2
+}
+
+func TestSegmentHashChiSquare(t *testing.T) {
+	// Upper tail critical value for 63 degrees of freedom at p = 1e-6, so a
+	// randomly seeded maphash practically never fails by chance
+	const critical = 132.0
+	keys := sensorKeys()
+	for _, h := range []SegmentHash{SegmentHashFNV, SegmentHashMaphash} {
+		t.Run(h.String(), func(t *testing.T) {
+			table := NewSegmentedHashTable(64, 0, WithSegmentHash(h))
+			if chi2 := chiSquare(table, keys); chi2 > critical {
+				t.Errorf("chi-square %.1f over 64 segments exceeds %.0f: keys are not spread uniformly", chi2, critical)
+			}
+		})
+	}
+}
+
+func BenchmarkSegmentHash(b *testing.B) {
+	keys := sensorKeys()
+	for _, h := range []SegmentHash{SegmentHashFNV, SegmentHashMaphash} {
+		b.Run(h.String(), func(b *testing.B) {
+			table := NewSegmentedHashTable(64, 0, WithSegmentHash(h))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				table.SegmentIndex(keys[i%len(keys)])
+			}
+			b.ReportMetric(chiSquare(table, keys), "chi2")
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+import "unsafe"
+
+// SizeEstimator returns the bytes an entry stored under key is charged against
+// the table's capacity. It must be deterministic: the same key and entry are
+// charged on write and released on delete.
+type SizeEstimator func(key string, entry DataEntry) uint64
+
+// StructSizeEstimator is the estimator tables use unless WithSizeEstimator
+// replaces it. It charges the entry struct as stored in the segment map, the
+// key's string header and bytes, and LocationId's bytes when they aren't the key
+// itself (normally they share storage), so capacity tracks real memory use.
+func StructSizeEstimator(key string, entry DataEntry) uint64 {
+	size := uint64(unsafe.Sizeof(entry)) + uint64(unsafe.Sizeof(key)) + uint64(len(key))
+	if entry.LocationId != key {
+		size += uint64(len(entry.LocationId))
+	}
+	return size
+}
+
+// LegacySizeEstimator charges a flat 100 bytes of overhead plus the key and Id
+// bytes, the formula used before StructSizeEstimator became the default. It
+// undercounts real memory use but fits more entries in the same capacity, so
+// deployments sized against it can keep it (-legacy-size-estimate).
+func LegacySizeEstimator(key string, entry DataEntry) uint64 {
+	return 100 + uint64(len(key)) + uint64(len(entry.Id))
+}
+
+// WithSizeEstimator replaces StructSizeEstimator, e.g. for values whose size
+// the default can't see
+func WithSizeEstimator(fn SizeEstimator) TableOption {
+	return func(sht *SegmentedHashTable) {
+		if fn != nil {
+			sht.sizeOf = fn
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/google/uuid"
+)
+
+// Ten bytes per key byte plus one per modification, so rewriting an entry
+// changes its charge
+func versionSize(key string, entry DataEntry) uint64 {
+	return 10*uint64(len(key)) + uint64(entry.ModificationCount)
+}
+
+func TestDefaultSizeEstimator(t *testing.T) {
+	entry := DataEntry{Id: uuid.New(), LocationId: "EU-1"}
+	want := StructSizeEstimator("EU-1", entry)
+	if want != uint64(unsafe.Sizeof(entry))+uint64(unsafe.Sizeof(""))+4 {
+		t.Errorf("StructSizeEstimator = %d, want the struct, string header and key bytes", want)
+	}
+	if other := StructSizeEstimator("EU-1", DataEntry{LocationId: "EU-2"}); other != want+4 {
+		t.Errorf("StructSizeEstimator with a distinct LocationId = %d, want %d", other, want+4)
+	}
+	table := NewSegmentedHashTable(4, 1000)
+	table.Put("EU-1", entry)
+	if got := table.Size(); got != want {
+		t.Errorf("Size() = %d with no estimator set, want StructSizeEstimator's %d", got, want)
+	}
+
+	if got, want := LegacySizeEstimator("EU-1", entry), uint64(100+4+16); got != want {
+		t.Errorf("LegacySizeEstimator = %d, want %d", got, want)
+	}
+	legacy := NewSegmentedHashTable(4, 1000, WithSizeEstimator(LegacySizeEstimator))
+	legacy.Put("EU-1", entry)
+	if got := legacy.Size(); got != 120 {
+		t.Errorf("Size() = %d with the legacy estimator, want 120", got)
+	}
+}
+
+// Every write path charges through the custom estimator and every delete path
+// releases the same amount, so the table drains back to zero
+func TestCustomSizeEstimatorBalances(t *testing.T) {
+	table := NewSegmentedHashTable(4, 10000, WithSizeEstimator(versionSize))
+	wantSize := func(step string, want uint64) {
+		t.Helper()
+		if got := table.Size(); got != want {
+			t.Fatalf("%s: Size() = %d, want %d", step, got, want)
+		}
+		if tracked, actual, ok := table.VerifySize(); !ok {
+			t.Fatalf("%s: VerifySize tracked %d, actual %d", step, tracked, actual)
+		}
+	}
+
+	table.Put("EU-1", DataEntry{LocationId: "EU-1", ModificationCount: 5})
+	wantSize("Put", 45)
+	table.Put("EU-1", DataEntry{LocationId: "EU-1", ModificationCount: 20})
+	wantSize("overwrite", 60)
+
+	table.Update("EU-22", func(DataEntry, bool) (DataEntry, error) {
+		return DataEntry{LocationId: "EU-22", ModificationCount: 3}, nil
+	})
+	wantSize("Update", 60+53)
+
+	errs := table.PutBatch([]BatchRecord{
+		{Key: "EU-3", Entry: DataEntry{LocationId: "EU-3", ModificationCount: 1}},
+		{Key: "EU-4", Entry: DataEntry{LocationId: "EU-4", ModificationCount: 2}},
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("PutBatch record %d: %v", i, err)
+		}
+	}
+	wantSize("PutBatch", 60+53+41+42)
+
+	if err := table.Apply([]TxnOp{
+		{Key: "EU-3", Delete: true},
+		{Key: "EU-5", Entry: DataEntry{LocationId: "EU-5", ModificationCount: 7}},
+	}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	wantSize("Apply", 60+53+42+47)
+
+	table.Delete("EU-1")
+	table.DeleteIf("EU-22", func(DataEntry) error { return nil })
+	table.Delete("EU-4")
+	table.Delete("EU-5")
+	wantSize("deleting everything", 0)
+}
+
+// Capacity is enforced in the estimator's units, not the default's
+func TestCustomSizeEstimatorLimitsCapacity(t *testing.T) {
+	table := NewSegmentedHashTable(4, 100, WithSizeEstimator(versionSize))
+	if err := table.Put("EU-1", DataEntry{LocationId: "EU-1", ModificationCount: 50}); err != nil {
+		t.Fatalf("Put of 90 bytes into 100: %v", err)
+	}
+	if err := table.Put("EU-2", DataEntry{LocationId: "EU-2", ModificationCount: 1}); err != ErrInsufficientMemory {
+		t.Fatalf("Put of 41 more bytes: got %v, want ErrInsufficientMemory", err)
+	}
+	table.Delete("EU-1")
+	if err := table.Put("EU-2", DataEntry{LocationId: "EU-2", ModificationCount: 1}); err != nil {
+		t.Fatalf("Put after freeing the first entry: %v", err)
+	}
+}
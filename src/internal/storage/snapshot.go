@@ -0,0 +1,97 @@
+package storage
+
+import "time"
+
+// Snapshot is a frozen, point-in-time view of the table taken without copying
+// any entries. Segments holding a live snapshot copy their map on the next
+// write (copy-on-write), so writers pay a one-off copy per segment instead of
+// stalling behind a long read lock. Release the snapshot when done so segments
+// stop copying on behalf of it.
+type Snapshot struct {
+	sht   *SegmentedHashTable
+	views []snapshotView
+	taken time.Time
+}
+
+type snapshotView struct {
+	data map[string]DataEntry
+	gen  uint64
+}
+
+// Snapshot captures every segment's current map. Each segment is read-locked
+// only long enough to take a reference.
+func (sht *SegmentedHashTable) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		sht:   sht,
+		views: make([]snapshotView, len(sht.segments)),
+		taken: sht.clock(),
+	}
+	for i, segment := range sht.segments {
+		segment.mu.RLock()
+		segment.snapshots.Add(1)
+		snap.views[i] = snapshotView{data: segment.data, gen: segment.gen}
+		segment.mu.RUnlock()
+	}
+	return snap
+}
+
+// Taken returns when the snapshot was captured
+func (snap *Snapshot) Taken() time.Time {
+	return snap.taken
+}
+
+// Len returns the number of entries in the snapshot, expired ones included
+func (snap *Snapshot) Len() int {
+	n := 0
+	for _, v := range snap.views {
+		n += len(v.data)
+	}
+	return n
+}
+
+// ForEach calls fn for every entry that was live when the snapshot was taken,
+// stopping early if fn returns false. No locks are held while fn runs.
+func (snap *Snapshot) ForEach(fn func(key string, entry DataEntry) bool) {
+	now := snap.taken.UnixNano()
+	for _, v := range snap.views {
+		for k, e := range v.data {
+			if e.expired(now) {
+				continue
+			}
+			if !fn(k, e) {
+				return
+			}
+		}
+	}
+}
+
+// Release tells segments whose map hasn't been copied yet that this snapshot no
+// longer needs it. Calling Release more than once is a no-op.
+func (snap *Snapshot) Release() {
+	if snap.views == nil {
+		return
+	}
+	for i, segment := range snap.sht.segments {
+		segment.mu.RLock()
+		if segment.gen == snap.views[i].gen {
+			segment.snapshots.Add(-1)
+		}
+		segment.mu.RUnlock()
+	}
+	snap.views = nil
+}
+
+// ownLocked makes segment.data safe to mutate, copying it first if a snapshot
+// still references it. The caller must hold segment's write lock.
+func (segment *segment) ownLocked() {
+	if segment.snapshots.Load() == 0 {
+		return
+	}
+	fresh := make(map[string]DataEntry, len(segment.data))
+	for k, v := range segment.data {
+		fresh[k] = v
+	}
+	segment.data = fresh
+	segment.snapshots.Store(0)
+	segment.gen++
+}
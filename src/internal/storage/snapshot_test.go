@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+// A scan through ForEach must not leave segments copy-on-write, or the next
+// write to every segment would copy its whole map
+func TestForEachLeavesNoCopyOnWrite(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0)
+	fill(t, table, 100)
+
+	table.ForEach(func(string, DataEntry) bool { return true })
+	for i, segment := range table.segments {
+		if n := segment.snapshots.Load(); n != 0 {
+			t.Errorf("segment %d holds %d snapshots after ForEach", i, n)
+		}
+	}
+	gens := make([]uint64, len(table.segments))
+	for i, segment := range table.segments {
+		gens[i] = segment.gen
+	}
+	fill(t, table, 100)
+	for i, segment := range table.segments {
+		if segment.gen != gens[i] {
+			t.Errorf("segment %d copied its map on write after ForEach", i)
+		}
+	}
+}
+
+func TestSnapshotIsPointInTime(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0)
+	fill(t, table, 10)
+
+	snap := table.Snapshot()
+	table.Delete("EU-0")
+	table.Put("EU-10", testEntry("EU-10"))
+
+	seen := map[string]bool{}
+	snap.ForEach(func(key string, _ DataEntry) bool {
+		seen[key] = true
+		return true
+	})
+	if !seen["EU-0"] || seen["EU-10"] || len(seen) != 10 {
+		t.Errorf("snapshot saw %d entries (EU-0 %v, EU-10 %v), want the 10 present when taken",
+			len(seen), seen["EU-0"], seen["EU-10"])
+	}
+
+	snap.Release()
+	for i, segment := range table.segments {
+		if n := segment.snapshots.Load(); n != 0 {
+			t.Errorf("segment %d holds %d snapshots after Release", i, n)
+		}
+	}
+}
+
+// BenchmarkWriteAfterScan measures a write that follows a full scan: walking a
+// Snapshot makes the write copy the segment's map, ForEach does not
+func BenchmarkWriteAfterScan(b *testing.B) {
+	scans := map[string]func(*SegmentedHashTable){
+		"foreach": func(sht *SegmentedHashTable) {
+			sht.ForEach(func(string, DataEntry) bool { return true })
+		},
+		"snapshot": func(sht *SegmentedHashTable) {
+			snap := sht.Snapshot()
+			snap.ForEach(func(string, DataEntry) bool { return true })
+			// Writes while the snapshot is live pay the copy
+			for i := 0; i < len(sht.segments); i++ {
+				key := fmt.Sprintf("EU-%d", i)
+				sht.Put(key, testEntry(key))
+			}
+			snap.Release()
+		},
+	}
+	for _, name := range []string{"foreach", "snapshot"} {
+		b.Run(name, func(b *testing.B) {
+			table := NewSegmentedHashTable(16, 0)
+			fill(b, table, 10000)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				scans[name](table)
+				for j := 0; j < len(table.segments); j++ {
+					key := fmt.Sprintf("EU-%d", j)
+					table.Put(key, testEntry(key))
+				}
+			}
+		})
+	}
+}
@@ -3,7 +3,12 @@ package storage
 import (
 	"errors"
 	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+	"hash/maphash"
+	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,17 +19,41 @@ type DataEntry struct {
 	RadiationLevel    float32   `json:"radiation_level"`
 	LocationId        string    `json:"location_id"`
 	ModificationCount int       `json:"modification_count"`
+	SchemaVersion     int       `json:"schema_version,omitempty"` // payload schema the writer used, DefaultSchemaVersion unless it said otherwise
 	LastUpdated       int64     `json:"-"`
+	ExpiresAt         int64     `json:"-"` // Unix nanos, 0 means use the table default
+	slide             int64     // TTL that touch-on-read renews, fixed at the first touch after a write
+}
+
+// Schema version stored for writes that don't declare one
+const DefaultSchemaVersion = 1
+
+// withDefaults fills in what a write left unset, before the entry is charged
+// and stored. Every write path goes through it.
+func (e DataEntry) withDefaults() DataEntry {
+	if e.SchemaVersion == 0 {
+		e.SchemaVersion = DefaultSchemaVersion
+	}
+	return e
 }
 
 var (
 	ErrKeyNotFound        = errors.New("key not found")       // to be cascaded to 404
 	ErrInsufficientMemory = errors.New("insufficient memory") // to be cascaded to 507
+	ErrKeyExists          = errors.New("key already exists")  // to be cascaded to 412
+	ErrVersionMismatch    = errors.New("version mismatch")    // to be cascaded to 412
 )
 
 type segment struct {
-	data map[string]DataEntry
-	mu   sync.RWMutex
+	data    map[string]DataEntry
+	history map[string]*history // only populated when history mode is on
+	mu      rwLocker
+	count   atomic.Int64 // len(data), readable without the lock
+
+	snapshots atomic.Int32 // live snapshots sharing data, see ownLocked; taken under the read lock
+	gen       uint64       // bumped whenever data is copied away from snapshots
+
+	accessed sync.Map // key -> *atomic.Int64 last Get time, only kept when eviction is on
 }
 
 type SegmentedHashTable struct {
@@ -32,12 +61,84 @@ type SegmentedHashTable struct {
 	segmentMask uint64 // used to determine which segment a key belongs to
 	maxSize     uint64 // sets max storage capacity
 	currentSize uint64
-	sizeLock    sync.RWMutex // for thread-safe concurrent access to all the *Size fields
+	sizeLock    sync.RWMutex // for thread-safe concurrent access to all the *Size fields and reservations
+
+	sizeOf SizeEstimator // bytes charged per entry, see WithSizeEstimator
+
+	reservedBytes   uint64 // capacity held back by outstanding reservations
+	reservations    map[ReservationToken]*reservation
+	nextReservation ReservationToken
+	reservationTTL  time.Duration
+
+	feed       changeFeed
+	onChange   func(ChangeEvent) // synchronous mutation hook, e.g. LogStore's append
+	hashSuffix bool              // hash only the key part after the first '-'
+	hashSalt   string            // mixed into segment selection, never stored
+	historyLen int               // readings kept per key, 0 disables history
+	fairLocks  bool              // segments use fairRWMutex instead of sync.RWMutex
+	keyCase    KeyCase
+	placement  *placement       // nil unless balanced placement is on
+	defaultTTL time.Duration    // applied to entries written without their own expiry
+	clock      func() time.Time // write stamps and expiry checks, see WithClock
+
+	touchOnRead bool // Get slides per-entry expiry forward
+
+	missLoader MissLoader         // consulted by Get on a miss, nil when unset
+	misses     singleflight.Group // collapses concurrent loads of one key
+
+	lockThreshold time.Duration // watchdog threshold, 0 leaves locks uninstrumented
+	longLockHolds atomic.Uint64
+
+	segmentHash SegmentHash
+	hashSeed    maphash.Seed // only used with SegmentHashMaphash
+
+	quotas       *regionQuotas // nil unless per-region quotas are on
+	evictSamples int           // keys sampled per eviction, 0 disables eviction
+	evictions    atomic.Uint64 // entries evicted to make room
+
+	logger          *slog.Logger  // warnings about capacity, drift and slow locks, see WithLogger
+	rejectedWrites  atomic.Uint64 // Puts refused with ErrInsufficientMemory
+	lastRejectLogNs atomic.Int64
 }
 
-func NewSegmentedHashTable(numSegments int, maxSizeBytes uint64) *SegmentedHashTable {
+// Minimum gap between "store full" warnings so a full store doesn't flood the log
+const rejectLogInterval = 10 * time.Second
+
+// TableOption tweaks optional SegmentedHashTable behaviour at construction time
+type TableOption func(*SegmentedHashTable)
+
+// WithLogger sends the table's warnings, and those of a LogStore over it, to
+// logger instead of slog.Default()
+func WithLogger(logger *slog.Logger) TableOption {
+	return func(sht *SegmentedHashTable) {
+		if logger != nil {
+			sht.logger = logger
+		}
+	}
+}
+
+// WithHashSuffix makes segment selection hash only the part of the key after its
+// first '-', so a shared region prefix doesn't influence placement
+func WithHashSuffix() TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.hashSuffix = true
+	}
+}
+
+// WithHashSalt mixes a per-deployment salt into segment selection. Keys are
+// stored unchanged; only the segment they land in moves.
+func WithHashSalt(salt string) TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.hashSalt = salt
+	}
+}
+
+// NewSegmentedHashTable creates a table of numSegments segments, rounded up to a
+// power of two; anything below 1 gets a single segment
+func NewSegmentedHashTable(numSegments int, maxSizeBytes uint64, opts ...TableOption) *SegmentedHashTable {
+	numSegments = max(numSegments, 1)
 	// numSegments should always be a power of 2 for effiicient modulo with bit masking
-	if numSegments <= 0 || (numSegments&(numSegments-1)) != 0 {
+	if (numSegments & (numSegments - 1)) != 0 {
 		numSegments--
 		numSegments |= numSegments >> 1
 		numSegments |= numSegments >> 2
@@ -47,93 +148,284 @@ func NewSegmentedHashTable(numSegments int, maxSizeBytes uint64) *SegmentedHashT
 		numSegments++
 	}
 
-	segments := make([]*segment, numSegments)
+	sht := &SegmentedHashTable{
+		segmentMask: uint64(numSegments - 1),
+		maxSize:     maxSizeBytes,
+		currentSize: 0,
+		sizeOf:      StructSizeEstimator,
+		clock:       time.Now,
+		logger:      slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(sht)
+	}
+
+	sht.segments = make([]*segment, numSegments)
 	for i := 0; i < numSegments; i++ {
-		segments[i] = &segment{
-			data: make(map[string]DataEntry),
+		var mu rwLocker = &sync.RWMutex{}
+		if sht.fairLocks {
+			mu = newFairRWMutex()
+		}
+		if sht.lockThreshold > 0 {
+			mu = &watchedLock{rwLocker: mu}
+		}
+		sht.segments[i] = &segment{
+			data:    make(map[string]DataEntry),
+			history: make(map[string]*history),
+			mu:      mu,
 		}
 	}
+	return sht
+}
 
-	return &SegmentedHashTable{
-		segments:    segments,
-		segmentMask: uint64(numSegments - 1),
-		maxSize:     maxSizeBytes,
-		currentSize: 0,
+// estimateSize is the number of bytes an entry is charged against maxSize.
+// Every path that charges or releases an entry goes through it, so a custom
+// estimator stays balanced between Put and Delete.
+func (sht *SegmentedHashTable) estimateSize(key string, entry DataEntry) uint64 {
+	return sht.sizeOf(key, entry)
+}
+
+// hashIndex is the segment key hashes to
+func (sht *SegmentedHashTable) hashIndex(key string) uint64 {
+	if sht.hashSuffix {
+		if i := strings.IndexByte(key, '-'); i >= 0 {
+			key = key[i+1:]
+		}
 	}
+	return sht.hashKey(key) & sht.segmentMask
 }
 
 func (sht *SegmentedHashTable) getSegment(key string) *segment {
-	h := fnv1a(key)
-	return sht.segments[h&sht.segmentMask]
+	return sht.segments[sht.lookupIndex(key)]
 }
 
 func (sht *SegmentedHashTable) Get(key string) (DataEntry, error) {
+	key = sht.NormalizeKey(key)
+	entry, err := sht.getLocal(key)
+	if err == ErrKeyNotFound && sht.missLoader != nil {
+		return sht.loadMiss(key)
+	}
+	return entry, err
+}
+
+// getLocal looks key up in the table itself
+func (sht *SegmentedHashTable) getLocal(key string) (DataEntry, error) {
 	segment := sht.getSegment(key)
+	if sht.touchOnRead {
+		segment.mu.Lock()
+		defer segment.mu.Unlock()
+		now := sht.now()
+		if entry, ok := segment.data[key]; ok && !entry.expired(now) {
+			sht.recordAccess(segment, key, now)
+			return sht.touchLocked(segment, key, entry, now), nil
+		}
+		return DataEntry{}, ErrKeyNotFound
+	}
 	segment.mu.RLock()
 	defer segment.mu.RUnlock()
 
-	if entry, ok := segment.data[key]; ok {
+	now := sht.now()
+	if entry, ok := segment.data[key]; ok && !entry.expired(now) {
+		sht.recordAccess(segment, key, now)
 		return entry, nil
 	}
 	return DataEntry{}, ErrKeyNotFound
 }
 
 func (sht *SegmentedHashTable) Put(key string, entry DataEntry) error {
-	sht.sizeLock.RLock()
-	if sht.currentSize >= sht.maxSize {
+	key = sht.NormalizeKey(key)
+	sht.makeRoom(key, sht.estimateSize(key, entry))
+	if !sht.unlimited() {
+		// Refuse outright once not even one more byte fits
+		sht.sizeLock.RLock()
+		full := !sht.fitsLocked(sht.currentSize, 1)
 		sht.sizeLock.RUnlock()
-		return ErrInsufficientMemory
+		if full {
+			// Abandoned reservations may be all that's in the way
+			sht.sizeLock.Lock()
+			sht.expireReservationsLocked(sht.clock())
+			full = !sht.fitsLocked(sht.currentSize, 1)
+			sht.sizeLock.Unlock()
+		}
+		if full {
+			sht.recordRejection()
+			return ErrInsufficientMemory
+		}
 	}
-	sht.sizeLock.RUnlock()
 
-	segment := sht.getSegment(key)
-	segment.mu.Lock()
-	defer segment.mu.Unlock()
+	idx, unlock := sht.lockSegments([]string{key}, nil)
+	defer unlock()
+
+	_, err := sht.storeLocked(sht.segments[idx[0]], key, entry)
+	return err
+}
 
-	var entrySize uint64 = 100
-	entrySize += uint64(len(key))
-	entrySize += uint64(len(entry.Id))
+// Update atomically reads the current entry for key and replaces it with whatever
+// fn returns, all under the key's segment lock. If fn returns an error nothing is
+// written and that error is passed through, which makes it a compare-and-set.
+func (sht *SegmentedHashTable) Update(key string, fn func(current DataEntry, exists bool) (DataEntry, error)) (DataEntry, error) {
+	key = sht.NormalizeKey(key)
+	sht.makeRoom(key, sht.estimateSize(key, DataEntry{LocationId: key}))
+	idx, unlock := sht.lockSegments([]string{key}, nil)
+	defer unlock()
+	segment := sht.segments[idx[0]]
+
+	current, exists := segment.data[key]
+	if exists && current.expired(sht.now()) {
+		current, exists = DataEntry{}, false
+	}
+	next, err := fn(current, exists)
+	if err != nil {
+		return DataEntry{}, err
+	}
+	return sht.storeLocked(segment, key, next)
+}
+
+// storeLocked charges the entry against maxSize and stores it. The caller must
+// hold segment's write lock.
+func (sht *SegmentedHashTable) storeLocked(segment *segment, key string, entry DataEntry) (DataEntry, error) {
+	return sht.storeLockedReserved(segment, key, entry, 0)
+}
+
+// storeLockedReserved is storeLocked drawing growth from reservation tok first
+func (sht *SegmentedHashTable) storeLockedReserved(segment *segment, key string, entry DataEntry, tok ReservationToken) (DataEntry, error) {
+	entry = entry.withDefaults()
+	entrySize := sht.estimateSize(key, entry)
 
-	exists := false
 	var oldSize uint64 = 0
-	if oldEntry, exists := segment.data[key]; exists {
-		oldSize = 100 + uint64(len(key)) + uint64(len(oldEntry.Id))
+	oldEntry, exists := segment.data[key]
+	if exists {
+		oldSize = sht.estimateSize(key, oldEntry)
 	}
-	sht.sizeLock.Lock()
-	if entrySize > oldSize {
-		if sht.currentSize+(entrySize-oldSize) > sht.maxSize {
-			sht.sizeLock.Unlock()
-			return ErrInsufficientMemory
+	if sht.historyLen > 0 {
+		// The key is charged for its live entry plus its whole retained series
+		h := segment.history[key]
+		if h != nil {
+			oldSize = sumSizes(oldSize, h.bytes)
 		}
-		sht.currentSize += (entrySize - oldSize)
-	} else if exists {
-		sht.currentSize -= (oldSize - entrySize)
-	} else {
-		sht.currentSize += entrySize
+		entrySize = sumSizes(entrySize, h.bytesAfterPush(sht.estimateSize(key, entry), sht.historyLen))
+	}
+	if sht.quotas != nil {
+		if err := sht.quotas.charge(RegionOf(key), oldSize, entrySize); err != nil {
+			return DataEntry{}, err
+		}
+	}
+	if err := sht.charge(oldSize, entrySize, tok); err != nil {
+		if sht.quotas != nil {
+			sht.quotas.charge(RegionOf(key), entrySize, oldSize)
+		}
+		sht.recordRejection()
+		return DataEntry{}, err
 	}
-	sht.sizeLock.Unlock()
 
-	entry.LastUpdated = time.Now().UnixNano()
+	entry.LastUpdated = sht.now()
+	entry.slide = 0
+	if entry.ExpiresAt == 0 && sht.defaultTTL > 0 {
+		entry.ExpiresAt = entry.LastUpdated + int64(sht.defaultTTL)
+	}
+	segment.ownLocked()
 	segment.data[key] = entry
+	if !exists {
+		segment.count.Add(1)
+	}
+	if sht.historyLen > 0 {
+		sht.appendHistoryLocked(segment, key, entry)
+	}
+	sht.emit(ChangeEvent{Type: ChangePut, Key: key, Entry: &entry})
+	return entry, nil
+}
+
+// restore stores an entry with its original LastUpdated and touch-on-read
+// slide, e.g. when replaying a log. It goes through normal size accounting.
+func (sht *SegmentedHashTable) restore(key string, entry DataEntry, lastUpdated int64) error {
+	key = sht.NormalizeKey(key)
+	idx, unlock := sht.lockSegments([]string{key}, nil)
+	defer unlock()
+	segment := sht.segments[idx[0]]
+
+	if entry.ExpiresAt == 0 && sht.defaultTTL > 0 {
+		entry.ExpiresAt = lastUpdated + int64(sht.defaultTTL)
+	}
+	stored, err := sht.storeLocked(segment, key, entry)
+	if err != nil {
+		return err
+	}
+	stored.LastUpdated = lastUpdated
+	stored.slide = entry.slide
+	segment.ownLocked()
+	segment.data[key] = stored
 	return nil
 }
 
+func (sht *SegmentedHashTable) appendHistoryLocked(segment *segment, key string, entry DataEntry) {
+	h := segment.history[key]
+	if h == nil {
+		h = &history{}
+		segment.history[key] = h
+	}
+	h.push(entry, sht.estimateSize(key, entry), sht.historyLen)
+}
+
 func (sht *SegmentedHashTable) Delete(key string) error {
+	return sht.DeleteIf(key, nil)
+}
+
+// DeleteIf removes key only if check (when non-nil) approves the current entry.
+// The check and the delete happen under one segment lock, so nothing can update
+// the entry in between. A check error is returned as-is and nothing is deleted.
+func (sht *SegmentedHashTable) DeleteIf(key string, check func(current DataEntry) error) error {
+	key = sht.NormalizeKey(key)
 	segment := sht.getSegment(key)
 	segment.mu.Lock()
 	defer segment.mu.Unlock()
 
+	entry, exists := segment.data[key]
+	if !exists || entry.expired(sht.now()) {
+		return ErrKeyNotFound
+	}
+	if check != nil {
+		if err := check(entry); err != nil {
+			return err
+		}
+	}
+	sht.removeLocked(segment, key, entry)
+	return nil
+}
+
+// forget removes key whether or not it has expired, e.g. when replaying a
+// logged delete of an entry that has expired since
+func (sht *SegmentedHashTable) forget(key string) {
+	key = sht.NormalizeKey(key)
+	segment := sht.getSegment(key)
+	segment.mu.Lock()
+	defer segment.mu.Unlock()
 	if entry, exists := segment.data[key]; exists {
-		entrySize := 100 + uint64(len(key)) + uint64(len(entry.Id))
+		sht.removeLocked(segment, key, entry)
+	}
+}
 
-		sht.sizeLock.Lock()
-		sht.currentSize -= entrySize
-		sht.sizeLock.Unlock()
+// removeLocked deletes a present key and releases its charge. The caller must
+// hold segment's write lock.
+func (sht *SegmentedHashTable) removeLocked(segment *segment, key string, entry DataEntry) {
+	entrySize := sht.estimateSize(key, entry)
+	if h, ok := segment.history[key]; ok {
+		entrySize += h.bytes
+		delete(segment.history, key)
+	}
 
-		delete(segment.data, key)
-		return nil
+	sht.sizeLock.Lock()
+	sht.releaseLocked(entrySize)
+	sht.sizeLock.Unlock()
+	if sht.quotas != nil {
+		sht.quotas.charge(RegionOf(key), entrySize, 0)
 	}
-	return ErrKeyNotFound
+
+	segment.ownLocked()
+	delete(segment.data, key)
+	segment.accessed.Delete(key)
+	segment.count.Add(-1)
+	sht.unplaceLocked(key)
+	sht.emit(ChangeEvent{Type: ChangeDelete, Key: key})
 }
 
 // Size returns the current size in bytes of the hash table
@@ -143,36 +435,131 @@ func (sht *SegmentedHashTable) Size() uint64 {
 	return sht.currentSize
 }
 
-// MaxSize returns the maximum size in bytes of the hash table
+// MaxSize returns the maximum size in bytes of the hash table, 0 meaning unlimited
 func (sht *SegmentedHashTable) MaxSize() uint64 {
 	return sht.maxSize
 }
 
+// unlimited reports whether the size cap is disabled (maxSize == 0). Usage is
+// still tracked so Size() stays meaningful.
+func (sht *SegmentedHashTable) unlimited() bool {
+	return sht.maxSize == 0
+}
+
+// RejectedWrites returns how many Puts were refused because the table was full
+func (sht *SegmentedHashTable) RejectedWrites() uint64 {
+	return sht.rejectedWrites.Load()
+}
+
+func (sht *SegmentedHashTable) recordRejection() {
+	n := sht.rejectedWrites.Add(1)
+
+	now := time.Now().UnixNano()
+	last := sht.lastRejectLogNs.Load()
+	if now-last < int64(rejectLogInterval) || !sht.lastRejectLogNs.CompareAndSwap(last, now) {
+		return
+	}
+	sht.logger.Warn("store at capacity", "used_bytes", sht.Size(), "max_bytes", sht.maxSize, "rejected_writes", n)
+}
+
+// Count returns the number of live entries. Expired entries the sweeper hasn't
+// reclaimed yet are left out, as Get leaves them out.
 func (sht *SegmentedHashTable) Count() int {
 	count := 0
 	for _, segment := range sht.segments {
 		segment.mu.RLock()
-		count += len(segment.data)
+		now := sht.now()
+		for _, e := range segment.data {
+			if !e.expired(now) {
+				count++
+			}
+		}
 		segment.mu.RUnlock()
 	}
 	return count
 }
 
+// GetKeys returns the keys of every live entry, skipping expired ones like Count
 func (sht *SegmentedHashTable) GetKeys() []string {
 	keys := make([]string, 0)
 	for _, segment := range sht.segments {
 		segment.mu.RLock()
-		for k := range segment.data {
-			keys = append(keys, k)
+		now := sht.now()
+		for k, e := range segment.data {
+			if !e.expired(now) {
+				keys = append(keys, k)
+			}
 		}
 		segment.mu.RUnlock()
 	}
 	return keys
 }
 
+// Compact rebuilds every segment's map so the oversized backing arrays left behind
+// by mass deletes can be garbage collected. Segments are rebuilt one at a time
+// under their own write lock to keep each pause short. Returns the entry count.
+func (sht *SegmentedHashTable) Compact() int {
+	total := 0
+	for _, segment := range sht.segments {
+		segment.mu.Lock()
+		fresh := make(map[string]DataEntry, len(segment.data))
+		for k, v := range segment.data {
+			fresh[k] = v
+		}
+		segment.data = fresh
+		segment.snapshots.Store(0)
+		segment.gen++
+		total += len(fresh)
+
+		freshHistory := make(map[string]*history, len(segment.history))
+		for k, v := range segment.history {
+			freshHistory[k] = v
+		}
+		segment.history = freshHistory
+		segment.mu.Unlock()
+	}
+	return total
+}
+
+type keyedEntry struct {
+	key   string
+	entry DataEntry
+}
+
+// ForEach calls fn for every live entry in the table, stopping early if fn
+// returns false. Each segment's entries are copied out under its read lock and
+// fn runs after the lock is released, so a slow consumer (e.g. a network write)
+// never blocks writers and writers never have to copy a map on its behalf. Each
+// segment is seen at one point in time, but not all segments at the same one;
+// use Snapshot for a single point-in-time view.
+func (sht *SegmentedHashTable) ForEach(fn func(key string, entry DataEntry) bool) {
+	var batch []keyedEntry
+	for _, segment := range sht.segments {
+		segment.mu.RLock()
+		now := sht.now()
+		batch = batch[:0]
+		for k, e := range segment.data {
+			if !e.expired(now) {
+				batch = append(batch, keyedEntry{k, e})
+			}
+		}
+		segment.mu.RUnlock()
+
+		for _, ke := range batch {
+			if !fn(ke.key, ke.entry) {
+				return
+			}
+		}
+	}
+}
+
 // fnv1a is a simple non-cryptographic hash function
 func fnv1a(s string) uint64 {
-	var h uint64 = 0xcbf29ce484222325
+	return fnv1aExtend(0xcbf29ce484222325, s)
+}
+
+// fnv1aExtend continues an fnv1a hash h over more bytes
+func fnv1aExtend(h uint64, s string) uint64 {
 	for i := 0; i < len(s); i++ {
 		h ^= uint64(s[i])
 		h *= 0x100000001b3
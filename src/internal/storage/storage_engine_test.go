@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry(key string) DataEntry {
+	return DataEntry{LocationId: key, ModificationCount: 1}
+}
+
+// fill puts n entries named EU-0..EU-n-1 into table
+func fill(t testing.TB, table *SegmentedHashTable, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("EU-%d", i)
+		if err := table.Put(key, testEntry(key)); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+}
+
+// A ForEach callback stands in for a slow network write: if it ran under the
+// segment lock, a write to the same segment from inside it would never finish
+func TestForEachCallbackHoldsNoLock(t *testing.T) {
+	table := NewSegmentedHashTable(1, 0)
+	fill(t, table, 10)
+
+	visited := 0
+	table.ForEach(func(key string, entry DataEntry) bool {
+		visited++
+		done := make(chan error, 1)
+		go func() { done <- table.Put(key, entry) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Put(%s) inside ForEach: %v", key, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Put(%s) blocked: ForEach holds the segment lock while calling fn", key)
+		}
+		return true
+	})
+	if visited != 10 {
+		t.Errorf("ForEach visited %d entries, want 10", visited)
+	}
+}
+
+func TestForEachStopsEarly(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0)
+	fill(t, table, 20)
+
+	visited := 0
+	table.ForEach(func(string, DataEntry) bool {
+		visited++
+		return visited < 3
+	})
+	if visited != 3 {
+		t.Errorf("ForEach visited %d entries after fn returned false, want 3", visited)
+	}
+}
+
+// FNV-1a already spreads sequential keys behind a shared region prefix evenly,
+// so hashing only the suffix or salting the hash must keep that balance while
+// moving keys the way each option promises
+func TestPrefixedKeyBalance(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []TableOption
+	}{
+		{"plain", nil},
+		{"suffix", []TableOption{WithHashSuffix()}},
+		{"salted", []TableOption{WithHashSalt("deployment-7")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			table := NewSegmentedHashTable(16, 0, tc.opts...)
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("EU-%05d", i)
+				table.Put(key, testEntry(key))
+			}
+			if score := table.DistributionScore(); score < 0.99 {
+				t.Errorf("distribution score %.4f for 1000 prefixed keys, want >= 0.99", score)
+			}
+			if _, err := table.Get("EU-00042"); err != nil {
+				t.Errorf("Get of a stored key: %v", err)
+			}
+		})
+	}
+
+	suffix := NewSegmentedHashTable(16, 0, WithHashSuffix())
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("%05d", i)
+		if a, b := suffix.SegmentIndex("EU-"+id), suffix.SegmentIndex("US-"+id); a != b {
+			t.Fatalf("suffix hashing put EU-%s in segment %d and US-%s in %d; the region must not matter", id, a, id, b)
+		}
+	}
+
+	plain := NewSegmentedHashTable(16, 0)
+	salted := NewSegmentedHashTable(16, 0, WithHashSalt("deployment-7"))
+	moved := 0
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("EU-%05d", i)
+		if plain.SegmentIndex(key) != salted.SegmentIndex(key) {
+			moved++
+		}
+	}
+	if moved < 50 {
+		t.Errorf("salt moved %d of 100 keys to another segment, want most of them", moved)
+	}
+}
+
+func TestUnlimitedAcceptsWritesPastCap(t *testing.T) {
+	const limit = 2000
+	capped := NewSegmentedHashTable(4, limit)
+	n := 0
+	for ; ; n++ {
+		key := fmt.Sprintf("EU-%d", n)
+		if err := capped.Put(key, testEntry(key)); err == ErrInsufficientMemory {
+			break
+		} else if err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+
+	unlimited := NewSegmentedHashTable(4, 0)
+	fill(t, unlimited, 10*n)
+	if unlimited.Count() != 10*n {
+		t.Errorf("Count = %d, want %d", unlimited.Count(), 10*n)
+	}
+	if size := unlimited.Size(); size <= limit || size < 9*capped.Size() {
+		t.Errorf("Size = %d after %d entries, want the real usage (capped table held %d bytes in %d)",
+			size, 10*n, capped.Size(), n)
+	}
+	if unlimited.MaxSize() != 0 {
+		t.Errorf("MaxSize = %d, want 0 for unlimited", unlimited.MaxSize())
+	}
+}
+
+// Segment counts are rounded up to a power of two, and anything below 1 still
+// gives a usable table rather than an out-of-range panic on the first Put
+func TestSegmentCountRounding(t *testing.T) {
+	for _, tc := range []struct{ asked, want int }{{-4, 1}, {0, 1}, {1, 1}, {3, 4}, {16, 16}, {17, 32}} {
+		table := NewSegmentedHashTable(tc.asked, 0)
+		if got := len(table.segments); got != tc.want {
+			t.Errorf("NewSegmentedHashTable(%d) has %d segments, want %d", tc.asked, got, tc.want)
+		}
+		fill(t, table, 10)
+		if _, err := table.Get("EU-3"); err != nil {
+			t.Errorf("%d segments: Get: %v", tc.asked, err)
+		}
+	}
+}
+
+// Warnings go to the logger passed with WithLogger, as structured fields
+func TestWithLoggerCapacityWarning(t *testing.T) {
+	var out bytes.Buffer
+	table := NewSegmentedHashTable(4, 200, WithSizeEstimator(flatSize),
+		WithLogger(slog.New(slog.NewTextHandler(&out, nil))))
+	fill(t, table, 2)
+	if err := table.Put("EU-full", testEntry("EU-full")); err != ErrInsufficientMemory {
+		t.Fatalf("Put into a full table: got %v, want ErrInsufficientMemory", err)
+	}
+	for _, want := range []string{"level=WARN", `msg="store at capacity"`, "used_bytes=200", "max_bytes=200", "rejected_writes=1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("log %q missing %s", out.String(), want)
+		}
+	}
+}
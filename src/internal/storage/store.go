@@ -0,0 +1,38 @@
+package storage
+
+import "time"
+
+// Store is everything the HTTP layer needs from a storage engine.
+// SegmentedHashTable is the default in-memory implementation; LogStore adds
+// durability on top of it.
+type Store interface {
+	Get(key string) (DataEntry, error)
+	Put(key string, entry DataEntry) error
+	PutBatch(records []BatchRecord) []error
+	Apply(ops []TxnOp) error
+	Update(key string, fn func(current DataEntry, exists bool) (DataEntry, error)) (DataEntry, error)
+	Delete(key string) error
+	DeleteIf(key string, check func(current DataEntry) error) error
+
+	ForEach(fn func(key string, entry DataEntry) bool)
+	GetKeys() []string
+	Range(start, end string, limit int) []DataEntry
+	WithPrefix(prefix string, limit int) map[string]DataEntry
+	History(key string) ([]DataEntry, error)
+	HistoryEnabled() bool
+	Inspect(key string) (KeyInfo, error)
+	Subscribe() (<-chan ChangeEvent, func())
+	NormalizeKey(key string) string
+
+	Compact() int
+	PurgeOlderThan(cutoff time.Time) (purged int, reclaimed uint64)
+	Clear() int
+	Size() uint64
+	MaxSize() uint64
+	Count() int
+	RejectedWrites() uint64
+	RegionUsage() map[string]uint64
+	VerifySize() (tracked, actual uint64, ok bool)
+}
+
+var _ Store = (*SegmentedHashTable)(nil)
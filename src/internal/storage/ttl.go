@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// NeverExpires pins an entry regardless of the table's default TTL
+const NeverExpires int64 = math.MaxInt64
+
+// WithDefaultTTL expires entries ttl after their last write unless the write
+// carried its own expiry. Expired entries are invisible to reads immediately and
+// reclaimed by SweepExpired.
+func WithDefaultTTL(ttl time.Duration) TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.defaultTTL = ttl
+	}
+}
+
+// WithClock replaces time.Now as the table's source of the current time for
+// write stamps and entry and reservation expiry, so tests can move time
+// without sleeping
+func WithClock(now func() time.Time) TableOption {
+	return func(sht *SegmentedHashTable) {
+		if now != nil {
+			sht.clock = now
+		}
+	}
+}
+
+// now returns the table's current time in Unix nanoseconds
+func (sht *SegmentedHashTable) now() int64 {
+	return sht.clock().UnixNano()
+}
+
+// WithTouchOnRead gives per-entry TTLs sliding semantics: every Get of a live
+// entry with an expiry pushes the deadline out by its original TTL (the gap
+// between its last write and the expiry that write set), so frequently read entries stay
+// alive. Gets then take the segment's write lock, which costs read
+// concurrency. A LogStore writes each refreshed deadline to its log.
+func WithTouchOnRead() TableOption {
+	return func(sht *SegmentedHashTable) {
+		sht.touchOnRead = true
+	}
+}
+
+// touchLocked slides key's expiry forward if it has one. The caller must hold
+// segment's write lock and have checked the entry is live.
+func (sht *SegmentedHashTable) touchLocked(segment *segment, key string, entry DataEntry, now int64) DataEntry {
+	if entry.ExpiresAt == 0 || entry.ExpiresAt == NeverExpires || entry.ExpiresAt <= entry.LastUpdated {
+		return entry
+	}
+	if entry.slide == 0 {
+		entry.slide = entry.ExpiresAt - entry.LastUpdated
+	}
+	entry.ExpiresAt = now + entry.slide
+	segment.ownLocked()
+	segment.data[key] = entry
+	// Logged under the segment lock like any write, but not a change
+	// subscribers need to hear about
+	if sht.onChange != nil {
+		sht.onChange(ChangeEvent{Type: ChangePut, Key: key, Entry: &entry})
+	}
+	return entry
+}
+
+func (e DataEntry) expired(now int64) bool {
+	return e.ExpiresAt > 0 && now >= e.ExpiresAt
+}
+
+// SweepExpired deletes every expired entry, one segment at a time under its
+// write lock, and returns how many were removed
+func (sht *SegmentedHashTable) SweepExpired() int {
+	removed := 0
+	for _, segment := range sht.segments {
+		segment.mu.Lock()
+		now := sht.now()
+		for key, entry := range segment.data {
+			if entry.expired(now) {
+				sht.removeLocked(segment, key, entry)
+				removed++
+			}
+		}
+		segment.mu.Unlock()
+	}
+	return removed
+}
+
+// StartSweeper runs SweepExpired every interval until the returned stop func
+// is called; calling stop again does nothing
+func (sht *SegmentedHashTable) StartSweeper(interval time.Duration) (stop func()) {
+	return startSweeper(interval, sht.SweepExpired)
+}
+
+func startSweeper(interval time.Duration, sweep func() int) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				sweep()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
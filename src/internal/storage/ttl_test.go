@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func expiringEntry(key string, ttl time.Duration) DataEntry {
+	e := testEntry(key)
+	e.ExpiresAt = time.Now().Add(ttl).UnixNano()
+	return e
+}
+
+func TestTouchOnReadKeepsEntryAlive(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	table := NewSegmentedHashTable(4, 0, WithTouchOnRead())
+	plain := NewSegmentedHashTable(4, 0)
+	table.Put("EU-A1", expiringEntry("EU-A1", ttl))
+	plain.Put("EU-A1", expiringEntry("EU-A1", ttl))
+
+	// Read well past the original expiry, more often than the TTL
+	for end := time.Now().Add(4 * ttl); time.Now().Before(end); time.Sleep(ttl / 4) {
+		if _, err := table.Get("EU-A1"); err != nil {
+			t.Fatalf("Get with touch-on-read: %v after %v", err, time.Since(end.Add(-4*ttl)))
+		}
+		plain.Get("EU-A1")
+	}
+	if _, err := plain.Get("EU-A1"); err != ErrKeyNotFound {
+		t.Errorf("without touch-on-read the entry outlived its TTL: %v", err)
+	}
+
+	// Once reads stop it expires one TTL after the last of them
+	time.Sleep(2 * ttl)
+	if _, err := table.Get("EU-A1"); err != ErrKeyNotFound {
+		t.Errorf("entry still live %v after the last read: %v", 2*ttl, err)
+	}
+}
+
+// Only entries with their own expiry slide; pinned and TTL-less entries are untouched
+func TestTouchOnReadLeavesOtherEntries(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0, WithTouchOnRead())
+	pinned := testEntry("EU-P")
+	pinned.ExpiresAt = NeverExpires
+	table.Put("EU-P", pinned)
+	table.Put("EU-N", testEntry("EU-N"))
+
+	for _, key := range []string{"EU-P", "EU-N"} {
+		before, _ := table.Get(key)
+		after, err := table.Get(key)
+		if err != nil || after.ExpiresAt != before.ExpiresAt {
+			t.Errorf("%s: expiry moved from %d to %d on read (%v)", key, before.ExpiresAt, after.ExpiresAt, err)
+		}
+	}
+}
+
+// Count and GetKeys leave out entries that have expired but not been swept,
+// agreeing with Get
+func TestCountSkipsExpired(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	table := NewSegmentedHashTable(4, 0, WithClock(func() time.Time { return now }), WithDefaultTTL(time.Minute))
+	table.Put("EU-short", testEntry("EU-short"))
+	pinned := testEntry("EU-long")
+	pinned.ExpiresAt = now.Add(time.Hour).UnixNano()
+	table.Put("EU-long", pinned)
+
+	if n, keys := table.Count(), table.GetKeys(); n != 2 || len(keys) != 2 {
+		t.Fatalf("Count() = %d, GetKeys() = %v before expiry, want both entries", n, keys)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := table.Get("EU-short"); err != ErrKeyNotFound {
+		t.Fatalf("Get past the TTL: %v, want ErrKeyNotFound", err)
+	}
+	if n := table.Count(); n != 1 {
+		t.Errorf("Count() = %d with one entry expired, want 1", n)
+	}
+	if keys := table.GetKeys(); len(keys) != 1 || keys[0] != "EU-long" {
+		t.Errorf("GetKeys() = %v with one entry expired, want [EU-long]", keys)
+	}
+	// It is still held, and charged, until the sweeper reclaims it
+	if swept := table.SweepExpired(); swept != 1 {
+		t.Errorf("SweepExpired() = %d, want 1", swept)
+	}
+}
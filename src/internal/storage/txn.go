@@ -0,0 +1,229 @@
+package storage
+
+import "errors"
+
+var ErrDuplicateTxnKey = errors.New("key appears more than once in transaction") // to be cascaded to 400
+
+// TxnOp is one step of a transaction: delete Key, or put a new entry for it.
+// A put uses Update when set, computing the entry from the current one (e.g.
+// to bump ModificationCount), and Entry otherwise. Check, when set, runs first
+// under the transaction's locks; an error from it aborts the transaction.
+type TxnOp struct {
+	Key    string
+	Delete bool
+	Entry  DataEntry
+	Update func(current DataEntry, exists bool) (DataEntry, error)
+	Check  func(current DataEntry, exists bool) error
+}
+
+// txnStep is an op resolved against the locked table
+type txnStep struct {
+	op      TxnOp
+	segment *segment
+	old     DataEntry
+	exists  bool // old is present (possibly expired)
+	live    bool // old is present and not expired
+	before  uint64
+	after   uint64
+}
+
+// Apply runs ops as one all-or-nothing transaction. Every segment involved is
+// write-locked in ascending index order, the same order PutBatch uses, so
+// concurrent transactions and batches can't deadlock. While they are held the
+// whole transaction is resolved first: each key's size before and after is
+// computed and the aggregate delta is checked against capacity (and region
+// quotas) in one step under sizeLock. Only if everything fits, and no Update
+// func or delete of a missing key failed, are the ops applied; otherwise the
+// table is untouched and the first error is returned.
+//
+// Each key may appear only once. Change events (and so LogStore records) are
+// emitted per op once the transaction commits.
+func (sht *SegmentedHashTable) Apply(ops []TxnOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	steps := make([]txnStep, len(ops))
+	seen := make(map[string]bool, len(ops))
+	for i, op := range ops {
+		op.Key = sht.NormalizeKey(op.Key)
+		if seen[op.Key] {
+			return ErrDuplicateTxnKey
+		}
+		seen[op.Key] = true
+		steps[i].op = op
+	}
+
+	if sht.evictSamples > 0 && !sht.unlimited() {
+		var incoming uint64
+		for _, st := range steps {
+			if !st.op.Delete && !sht.has(st.op.Key) {
+				incoming = sumSizes(incoming, sht.estimateSize(st.op.Key, st.op.Entry))
+			}
+		}
+		sht.evictUntilFits(incoming)
+	}
+
+	keys := make([]string, len(steps))
+	creates := make([]bool, len(steps))
+	for i, st := range steps {
+		keys[i], creates[i] = st.op.Key, !st.op.Delete
+	}
+	idx, unlock := sht.lockSegments(keys, creates)
+	defer unlock()
+	for i := range steps {
+		steps[i].segment = sht.segments[idx[i]]
+	}
+
+	now := sht.now()
+	for i := range steps {
+		if err := sht.resolveLocked(&steps[i], now); err != nil {
+			return err
+		}
+	}
+	if err := sht.chargeTxn(steps); err != nil {
+		if err == ErrInsufficientMemory {
+			sht.recordRejection()
+		}
+		return err
+	}
+
+	for _, st := range steps {
+		sht.commitLocked(st, now)
+	}
+	return nil
+}
+
+// resolveLocked works out what st will change and what that costs. The caller
+// holds st.segment's write lock.
+func (sht *SegmentedHashTable) resolveLocked(st *txnStep, now int64) error {
+	key, segment := st.op.Key, st.segment
+	st.old, st.exists = segment.data[key]
+	st.live = st.exists && !st.old.expired(now)
+	h := segment.history[key]
+	if st.exists {
+		st.before = sht.estimateSize(key, st.old)
+	}
+	if h != nil {
+		st.before += h.bytes
+	}
+	if st.op.Check != nil {
+		current := st.old
+		if !st.live {
+			current = DataEntry{}
+		}
+		if err := st.op.Check(current, st.live); err != nil {
+			return err
+		}
+	}
+
+	if st.op.Delete {
+		if !st.live {
+			return ErrKeyNotFound
+		}
+		return nil
+	}
+
+	if st.op.Update != nil {
+		current, live := st.old, st.live
+		if !live {
+			current = DataEntry{}
+		}
+		next, err := st.op.Update(current, live)
+		if err != nil {
+			return err
+		}
+		st.op.Entry = next
+	}
+	st.op.Entry = st.op.Entry.withDefaults()
+	st.after = sht.estimateSize(key, st.op.Entry)
+	if sht.historyLen > 0 {
+		st.after += h.bytesAfterPush(sht.estimateSize(key, st.op.Entry), sht.historyLen)
+	}
+	return nil
+}
+
+// chargeTxn applies the transaction's net size change to the table and to any
+// region quotas, or changes nothing and reports why it doesn't fit
+func (sht *SegmentedHashTable) chargeTxn(steps []txnStep) error {
+	var before, after uint64
+	regions := make(map[string][2]uint64) // region -> {before, after}
+	for _, st := range steps {
+		before = sumSizes(before, st.before)
+		after = sumSizes(after, st.after)
+		r := regions[RegionOf(st.op.Key)]
+		regions[RegionOf(st.op.Key)] = [2]uint64{sumSizes(r[0], st.before), sumSizes(r[1], st.after)}
+	}
+
+	if sht.quotas != nil {
+		q := sht.quotas
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		for region, r := range regions {
+			limit, capped := q.limits[region]
+			if r[1] <= r[0] {
+				continue
+			}
+			used, ok := addSize(q.usage[region], r[1]-r[0])
+			if !ok {
+				return ErrInsufficientMemory
+			}
+			if capped && used > limit {
+				return ErrQuotaExceeded
+			}
+		}
+	}
+
+	sht.sizeLock.Lock()
+	defer sht.sizeLock.Unlock()
+	if after > before && !sht.fitsLocked(sht.currentSize, after-before) {
+		sht.expireReservationsLocked(sht.clock())
+		if !sht.fitsLocked(sht.currentSize, after-before) {
+			return ErrInsufficientMemory
+		}
+	}
+	sht.releaseLocked(before)
+	sht.currentSize += after
+
+	if sht.quotas != nil {
+		for region, r := range regions {
+			used := sht.quotas.usage[region] - r[0] + r[1]
+			if used == 0 {
+				delete(sht.quotas.usage, region)
+			} else {
+				sht.quotas.usage[region] = used
+			}
+		}
+	}
+	return nil
+}
+
+// commitLocked applies an already charged step. The caller holds its segment's
+// write lock.
+func (sht *SegmentedHashTable) commitLocked(st txnStep, now int64) {
+	key, segment := st.op.Key, st.segment
+	segment.ownLocked()
+
+	if st.op.Delete {
+		delete(segment.data, key)
+		delete(segment.history, key)
+		segment.accessed.Delete(key)
+		segment.count.Add(-1)
+		sht.emit(ChangeEvent{Type: ChangeDelete, Key: key})
+		return
+	}
+
+	entry := st.op.Entry
+	entry.LastUpdated = now
+	entry.slide = 0
+	if entry.ExpiresAt == 0 && sht.defaultTTL > 0 {
+		entry.ExpiresAt = now + int64(sht.defaultTTL)
+	}
+	segment.data[key] = entry
+	if !st.exists {
+		segment.count.Add(1)
+	}
+	if sht.historyLen > 0 {
+		sht.appendHistoryLocked(segment, key, entry)
+	}
+	sht.emit(ChangeEvent{Type: ChangePut, Key: key, Entry: &entry})
+}
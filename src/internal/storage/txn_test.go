@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyCommits(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0, WithSizeEstimator(flatSize))
+	fill(t, table, 3)
+
+	err := table.Apply([]TxnOp{
+		{Key: "EU-0", Delete: true},
+		{Key: "EU-1", Entry: DataEntry{LocationId: "EU-1", ModificationCount: 2}},
+		{Key: "EU-9", Update: func(current DataEntry, exists bool) (DataEntry, error) {
+			if exists {
+				t.Error("Update saw EU-9 as existing")
+			}
+			return testEntry("EU-9"), nil
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if _, err := table.Get("EU-0"); err != ErrKeyNotFound {
+		t.Errorf("deleted EU-0: %v", err)
+	}
+	if e, _ := table.Get("EU-1"); e.ModificationCount != 2 {
+		t.Errorf("EU-1 modification count %d, want 2", e.ModificationCount)
+	}
+	if _, err := table.Get("EU-9"); err != nil {
+		t.Errorf("created EU-9: %v", err)
+	}
+	if table.Count() != 3 || table.Size() != 300 {
+		t.Errorf("Count %d Size %d, want 3 entries of 100 bytes", table.Count(), table.Size())
+	}
+}
+
+// A failing op anywhere in the transaction leaves every key as it was
+func TestApplyRollsBack(t *testing.T) {
+	errBoom := errors.New("boom")
+	cases := []struct {
+		name string
+		last TxnOp
+		want error
+	}{
+		{"update error", TxnOp{Key: "US-1", Update: func(DataEntry, bool) (DataEntry, error) { return DataEntry{}, errBoom }}, errBoom},
+		{"check error", TxnOp{Key: "US-1", Entry: testEntry("US-1"), Check: func(DataEntry, bool) error { return errBoom }}, errBoom},
+		{"delete of a missing key", TxnOp{Key: "US-404", Delete: true}, ErrKeyNotFound},
+		{"over capacity", TxnOp{Key: "US-2", Entry: testEntry("US-2")}, ErrInsufficientMemory},
+		{"duplicate key", TxnOp{Key: "EU-0", Delete: true}, ErrDuplicateTxnKey},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Room for the put of US-1 but not for US-2 as well
+			table := NewSegmentedHashTable(4, 350, WithSizeEstimator(flatSize))
+			fill(t, table, 3)
+			ops := []TxnOp{
+				{Key: "EU-0", Entry: DataEntry{LocationId: "EU-0", ModificationCount: 7}},
+				{Key: "EU-1", Delete: true},
+				{Key: "US-1", Entry: testEntry("US-1")},
+			}
+			if tc.last.Key == "US-1" {
+				ops = ops[:2]
+			}
+			if err := table.Apply(append(ops, tc.last)); !errors.Is(err, tc.want) {
+				t.Fatalf("Apply: got %v, want %v", err, tc.want)
+			}
+
+			if e, _ := table.Get("EU-0"); e.ModificationCount != 1 {
+				t.Errorf("EU-0 was overwritten by a rolled back put")
+			}
+			if _, err := table.Get("EU-1"); err != nil {
+				t.Errorf("EU-1 was deleted by a rolled back delete")
+			}
+			if _, err := table.Get("US-1"); err != ErrKeyNotFound {
+				t.Errorf("US-1 was created by a rolled back put")
+			}
+			if table.Count() != 3 || table.Size() != 300 {
+				t.Errorf("Count %d Size %d after rollback, want 3 and 300", table.Count(), table.Size())
+			}
+		})
+	}
+}
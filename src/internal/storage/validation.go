@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// MaxKeyLength is the longest key any write path accepts
+const MaxKeyLength = 256
+
+// ValidationError lists every rule a DataEntry broke, not just the first
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid entry: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the invariants every stored entry must satisfy. The Id needs no
+// check of its own since uuid.UUID can only hold a well-formed value.
+func (e DataEntry) Validate() error {
+	var problems []string
+
+	checkFinite := func(name string, v float32) {
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			problems = append(problems, fmt.Sprintf("%s must be a finite number", name))
+		}
+	}
+	checkFinite("seismic_activity", e.SeismicActivity)
+	checkFinite("temperature_c", e.TemperatureC)
+	checkFinite("radiation_level", e.RadiationLevel)
+
+	if e.LocationId == "" {
+		problems = append(problems, "location_id must not be empty")
+	}
+	if e.ModificationCount < 0 {
+		problems = append(problems, "modification_count must not be negative")
+	}
+	if e.SchemaVersion < 0 {
+		problems = append(problems, "schema_version must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateKey checks that key can be addressed as /{key}: non-empty, at most
+// MaxKeyLength bytes and free of whitespace and control characters. Every
+// write path (PUT, /batch, /txn, /import and gRPC) checks keys with it.
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("key must be at most %d bytes", MaxKeyLength)
+	}
+	if strings.IndexFunc(key, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) >= 0 {
+		return fmt.Errorf("key %q must not contain whitespace or control characters", key)
+	}
+	return nil
+}
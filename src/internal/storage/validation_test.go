@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	cases := []struct {
+		key string
+		ok  bool
+	}{
+		{"EU-A1", true},
+		{"tenant_b:EU-1", true},
+		{"eu/a1", true},
+		{"Zürich-1", true},
+		{strings.Repeat("k", MaxKeyLength), true},
+		{"", false},
+		{strings.Repeat("k", MaxKeyLength+1), false},
+		{"EU A1", false},
+		{"EU-A1\n", false},
+		{"EU\tA1", false},
+		{"EU\x00A1", false},
+		{"EU A1", false}, // non-breaking space
+	}
+	for _, tc := range cases {
+		if err := ValidateKey(tc.key); (err == nil) != tc.ok {
+			t.Errorf("ValidateKey(%q) = %v, want ok %v", tc.key, err, tc.ok)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	nan := float32(math.NaN())
+	cases := []struct {
+		name     string
+		entry    DataEntry
+		problems int
+	}{
+		{"valid", DataEntry{LocationId: "EU-A1", ModificationCount: 1}, 0},
+		{"no location", DataEntry{}, 1},
+		{"negative version", DataEntry{LocationId: "EU-A1", ModificationCount: -1}, 1},
+		{"negative schema", DataEntry{LocationId: "EU-A1", SchemaVersion: -1}, 1},
+		{"NaN", DataEntry{LocationId: "EU-A1", SeismicActivity: nan}, 1},
+		{"infinite", DataEntry{LocationId: "EU-A1", TemperatureC: float32(math.Inf(1))}, 1},
+		{"everything", DataEntry{ModificationCount: -1, SchemaVersion: -1, SeismicActivity: nan, TemperatureC: nan, RadiationLevel: nan}, 6},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.entry.Validate()
+			if tc.problems == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			if len(verr.Problems) != tc.problems {
+				t.Errorf("%d problems %q, want %d", len(verr.Problems), verr.Problems, tc.problems)
+			}
+		})
+	}
+}
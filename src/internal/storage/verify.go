@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// VerifySize recomputes what the table should be charging by walking every
+// entry and history series, and compares it with the tracked currentSize. All
+// segments are locked (in index order) for the duration, so the two figures
+// describe the same instant; it is an O(n) stop-the-world check meant for
+// diagnostics, not the hot path.
+func (sht *SegmentedHashTable) VerifySize() (tracked, actual uint64, ok bool) {
+	return sht.VerifyPrefixSize("")
+}
+
+// VerifyPrefixSize is VerifySize for the keys starting with prefix. actual is
+// what those keys should be charged; tracked is the tracked size less what
+// every other key should be charged, so drift anywhere in the table still
+// shows, but neither figure counts other keys' bytes.
+func (sht *SegmentedHashTable) VerifyPrefixSize(prefix string) (tracked, actual uint64, ok bool) {
+	for _, segment := range sht.segments {
+		segment.mu.RLock()
+	}
+	defer func() {
+		for _, segment := range sht.segments {
+			segment.mu.RUnlock()
+		}
+	}()
+
+	var others uint64 // what keys outside prefix should be charged
+	charge := func(key string, size uint64) {
+		if strings.HasPrefix(key, prefix) {
+			actual += size
+		} else {
+			others += size
+		}
+	}
+	for _, segment := range sht.segments {
+		for key, entry := range segment.data {
+			charge(key, sht.estimateSize(key, entry))
+		}
+		for key, h := range segment.history {
+			for _, size := range h.sizes {
+				charge(key, size)
+			}
+		}
+	}
+
+	sht.sizeLock.RLock()
+	current := sht.currentSize
+	sht.sizeLock.RUnlock()
+	return current - min(others, current), actual, current == actual+others
+}
+
+// StartSizeVerifier runs VerifySize every interval, logging a warning whenever
+// the tracked size has drifted from the real one, until the returned stop func
+// is called
+func (sht *SegmentedHashTable) StartSizeVerifier(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if tracked, actual, ok := sht.VerifySize(); !ok {
+					sht.logger.Warn("size accounting drift", "tracked_bytes", tracked, "actual_bytes", actual)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVerifySizeDetectsDrift(t *testing.T) {
+	table := NewSegmentedHashTable(4, 0, WithHistory(3))
+	fill(t, table, 20)
+	fill(t, table, 20) // second readings land in history too
+	if tracked, actual, ok := table.VerifySize(); !ok {
+		t.Fatalf("fresh table reports drift: tracked %d, actual %d", tracked, actual)
+	}
+
+	table.sizeLock.Lock()
+	table.currentSize += 17
+	table.sizeLock.Unlock()
+	tracked, actual, ok := table.VerifySize()
+	if ok || tracked-actual != 17 {
+		t.Errorf("VerifySize() = %d, %d, %v after corrupting the count by 17", tracked, actual, ok)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to write from the verifier goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSizeVerifierWarnsOnDrift(t *testing.T) {
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+
+	table := NewSegmentedHashTable(4, 0, WithLogger(logger))
+	fill(t, table, 5)
+	stop := table.StartSizeVerifier(5 * time.Millisecond)
+	defer stop()
+
+	time.Sleep(20 * time.Millisecond)
+	if strings.Contains(out.String(), "drift") {
+		t.Fatalf("verifier warned about an accurate table: %s", out.String())
+	}
+	table.sizeLock.Lock()
+	table.currentSize--
+	table.sizeLock.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "size accounting drift") {
+		if time.Now().After(deadline) {
+			t.Fatal("verifier never warned about drift")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,18 @@
+package internal
+
+import (
+	"net/http/httptest"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// Capacity of the store behind NewTestServer
+const testStoreSize = 64 * 1024 * 1024
+
+// NewTestServer starts an httptest.Server backed by a brand-new store and mux,
+// for end-to-end HTTP tests. Callers must Close it when done.
+func NewTestServer(opts ...ServerOption) *httptest.Server {
+	store := storage.NewSegmentedHashTable(16, testStoreSize)
+	server := CreateServer(store, storage.NewPoolManager(), opts...)
+	return httptest.NewServer(server.Handler())
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t testing.TB, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue signs a certificate for cn, usable as a localhost server certificate
+// and as a client certificate
+func (ca *testCA) issue(t testing.TB, cn string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writePair writes cert as PEM certificate and key files for StartTLS
+func writePair(t testing.TB, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+// freePort returns a TCP port nothing is listening on
+func freePort(t testing.TB) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startListener runs start in the background until the test ends and waits
+// for its port to accept connections
+func startListener(t testing.TB, s *Server, port int, start func() error) {
+	t.Helper()
+	served := make(chan error, 1)
+	go func() { served <- start() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+		<-served
+	})
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+			return
+		}
+		select {
+		case err := <-served:
+			t.Fatalf("listener stopped: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nothing listening on %d: %v", port, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// mtlsFixture is a CA with a server certificate on disk, a client certificate
+// it issued and one from an unrelated CA
+type mtlsFixture struct {
+	ca                *testCA
+	certFile, keyFile string
+	valid, stranger   tls.Certificate
+}
+
+func newMTLSFixture(t testing.TB) mtlsFixture {
+	ca := newTestCA(t, "hub CA")
+	certFile, keyFile := writePair(t, ca.issue(t, "localhost"))
+	return mtlsFixture{
+		ca:       ca,
+		certFile: certFile,
+		keyFile:  keyFile,
+		valid:    ca.issue(t, "sensor-fleet-7"),
+		stranger: newTestCA(t, "other CA").issue(t, "intruder"),
+	}
+}
+
+func (f mtlsFixture) clientConfig(certs ...tls.Certificate) *tls.Config {
+	return &tls.Config{RootCAs: f.ca.pool, Certificates: certs}
+}
+
+func TestMutualTLS(t *testing.T) {
+	f := newMTLSFixture(t)
+	var logged logBuffer
+	s := CreateServer(newTestStore(), storage.NewPoolManager(), WithLogger(slog.New(slog.NewTextHandler(&logged, nil)), 1))
+	port := freePort(t)
+	startListener(t, s, port, func() error { return s.StartTLS(port, f.certFile, f.keyFile, WithClientCAs(f.ca.pool)) })
+	url := fmt.Sprintf("https://127.0.0.1:%d/ping", port)
+
+	cases := []struct {
+		name  string
+		certs []tls.Certificate
+		ok    bool
+	}{
+		{"valid client certificate", []tls.Certificate{f.valid}, true},
+		{"no client certificate", nil, false},
+		{"certificate from another CA", []tls.Certificate{f.stranger}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: f.clientConfig(tc.certs...)}}
+			defer client.CloseIdleConnections()
+			resp, err := client.Get(url)
+			if !tc.ok {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("request succeeded with status %d, want the handshake refused", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200", resp.StatusCode)
+			}
+		})
+	}
+	if lines := strings.Join(logged.lines(), "\n"); !strings.Contains(lines, "client_cn=sensor-fleet-7") {
+		t.Errorf("request log lacks the client CN: %s", lines)
+	}
+}
+
+// The gRPC listener serves the same certificate and demands the same client
+// certificates as HTTPS
+func TestGRPCMutualTLS(t *testing.T) {
+	f := newMTLSFixture(t)
+	s := CreateServer(newTestStore(), storage.NewPoolManager())
+	port := freePort(t)
+	startListener(t, s, port, func() error { return s.StartGRPCTLS(port, f.certFile, f.keyFile, WithClientCAs(f.ca.pool)) })
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	cases := []struct {
+		name  string
+		creds credentials.TransportCredentials
+		ok    bool
+	}{
+		{"valid client certificate", credentials.NewTLS(f.clientConfig(f.valid)), true},
+		{"no client certificate", credentials.NewTLS(f.clientConfig()), false},
+		{"certificate from another CA", credentials.NewTLS(f.clientConfig(f.stranger)), false},
+		{"plaintext", insecure.NewCredentials(), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(tc.creds))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			_, err = storepb.NewStoreClient(conn).Get(ctx, &storepb.GetRequest{Key: "EU-A1"})
+			code := status.Code(err)
+			if tc.ok && code != codes.NotFound {
+				t.Errorf("Get over mTLS: %v, want NotFound from the store", err)
+			}
+			if !tc.ok && code != codes.Unavailable {
+				t.Errorf("Get: %v, want the connection refused", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// Most ops accepted in one POST /txn
+const maxTxnOps = 1000
+
+type txnOpRequest struct {
+	Op    string       `json:"op"` // "put" or "delete"
+	Key   string       `json:"key"`
+	Entry *RequestData `json:"entry,omitempty"`
+}
+
+// txnHandler serves POST /txn: a list of put/delete ops applied all-or-nothing
+// (see storage.SegmentedHashTable.Apply). Puts follow PUT /{key} semantics,
+// bumping the modification count of existing entries and recording the
+// request's X-Schema-Version. Any failure leaves the store untouched. Ops are
+// decoded one at a time like /batch, so a body over maxTxnOps gets 413 without
+// being read to the end.
+func (s *Server) txnHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.acquireWrite(w) {
+		return
+	}
+	defer s.releaseWrite()
+	r, cancel, ok := s.withClientDeadline(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+	schemaVersion, err := parseSchemaVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reqOps, err := decodeBatchOps(r.Body, maxTxnOps)
+	if err == errBatchTooLarge {
+		http.Error(w, fmt.Sprintf("A transaction holds at most %d ops", maxTxnOps), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, "Invalid transaction body", http.StatusBadRequest)
+		return
+	}
+	if len(reqOps) == 0 {
+		http.Error(w, "A transaction needs at least one op", http.StatusBadRequest)
+		return
+	}
+
+	store := s.table()
+	ops := make([]storage.TxnOp, len(reqOps))
+	for i, in := range reqOps {
+		key := store.NormalizeKey(in.Key)
+		if err := storage.ValidateKey(key); err != nil {
+			http.Error(w, fmt.Sprintf("op %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		switch in.Op {
+		case "delete":
+			ops[i] = storage.TxnOp{Key: key, Delete: true}
+		case "put":
+			if in.Entry == nil {
+				http.Error(w, fmt.Sprintf("op %d: put needs an entry", i), http.StatusBadRequest)
+				return
+			}
+			id, err := s.parseID(in.Entry.ID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("op %d: %v", i, err), http.StatusBadRequest)
+				return
+			}
+			reading := *in.Entry
+			ops[i] = storage.TxnOp{Key: key, Update: func(current storage.DataEntry, exists bool) (storage.DataEntry, error) {
+				data := current
+				if exists {
+					data.ModificationCount = s.nextVersion(data.ModificationCount)
+				} else {
+					data = storage.DataEntry{Id: id, ModificationCount: 1, LocationId: key}
+				}
+				data.SeismicActivity = reading.SeismicActivity
+				data.TemperatureC = reading.TemperatureC
+				data.RadiationLevel = reading.RadiationLevel
+				data.SchemaVersion = schemaVersion
+				data.ExpiresAt = 0
+				return data, data.Validate()
+			}}
+		default:
+			http.Error(w, fmt.Sprintf("op %d: unknown op %q", i, in.Op), http.StatusBadRequest)
+			return
+		}
+	}
+
+	write := func(gate *commitGate) {
+		ops[0].Check = func(storage.DataEntry, bool) error { return gate.commit() }
+		err = store.Apply(ops)
+	}
+	if !callWriteWithDeadline(r.Context(), write) {
+		gatewayTimeout(w)
+		return
+	}
+	if err != nil {
+		var verr *storage.ValidationError
+		switch {
+		case errors.As(err, &verr), err == storage.ErrDuplicateTxnKey:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case err == storage.ErrKeyNotFound:
+			http.Error(w, "Delete of a missing location ID", http.StatusNotFound)
+		case err == storage.ErrInsufficientMemory:
+			http.Error(w, "Insufficient storage", http.StatusInsufficientStorage)
+		case err == storage.ErrQuotaExceeded:
+			http.Error(w, "Region quota exceeded", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "Transaction rejected", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]int{"applied": len(ops)}, false)
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTxnCommits(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodPut, "/EU-A2", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = do(t, ts, http.MethodPost, "/txn", `{"ops":[
+		{"op":"put","key":"EU-A1","entry":`+testReading+`},
+		{"op":"put","key":"EU-A3","entry":`+testReading+`},
+		{"op":"delete","key":"EU-A2"}]}`)
+	wantStatus(t, resp, body, http.StatusOK)
+	var applied map[string]int
+	decode(t, body, &applied)
+	if applied["applied"] != 3 {
+		t.Errorf("applied = %d, want 3", applied["applied"])
+	}
+
+	var entry struct {
+		ModificationCount int `json:"modification_count"`
+	}
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &entry)
+	if entry.ModificationCount != 2 {
+		t.Errorf("EU-A1 modification_count = %d after a txn put, want 2", entry.ModificationCount)
+	}
+	resp, body = do(t, ts, http.MethodGet, "/EU-A3", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, &entry)
+	if entry.ModificationCount != 1 {
+		t.Errorf("EU-A3 modification_count = %d for a txn create, want 1", entry.ModificationCount)
+	}
+	resp, body = do(t, ts, http.MethodGet, "/EU-A2", "")
+	wantStatus(t, resp, body, http.StatusNotFound)
+}
+
+// A failing op rejects the whole transaction and leaves earlier ops unapplied
+func TestTxnRollsBack(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	cases := []struct {
+		name string
+		last string
+		want int
+	}{
+		{"delete of a missing key", `{"op":"delete","key":"EU-404"}`, http.StatusNotFound},
+		{"duplicate key", `{"op":"delete","key":"EU-A1"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := do(t, ts, http.MethodPost, "/txn", `{"ops":[
+				{"op":"put","key":"EU-A1","entry":`+testReading+`},
+				{"op":"put","key":"EU-A9","entry":`+testReading+`},
+				`+tc.last+`]}`)
+			wantStatus(t, resp, body, tc.want)
+
+			var entry struct {
+				ModificationCount int `json:"modification_count"`
+			}
+			resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+			wantStatus(t, resp, body, http.StatusOK)
+			decode(t, body, &entry)
+			if entry.ModificationCount != 1 {
+				t.Errorf("EU-A1 modification_count = %d, the rolled back put was applied", entry.ModificationCount)
+			}
+			resp, body = do(t, ts, http.MethodGet, "/EU-A9", "")
+			wantStatus(t, resp, body, http.StatusNotFound)
+		})
+	}
+}
+
+func TestTxnTooLarge(t *testing.T) {
+	s, ts := newTestServer(t, newTestStore())
+	ops := make([]string, maxTxnOps+1)
+	for i := range ops {
+		ops[i] = fmt.Sprintf(`{"op":"put","key":"EU-%d","entry":%s}`, i, testReading)
+	}
+	resp, body := do(t, ts, http.MethodPost, "/txn", `{"ops":[`+strings.Join(ops, ",")+`]}`)
+	wantStatus(t, resp, body, http.StatusRequestEntityTooLarge)
+	if n := s.table().Count(); n != 0 {
+		t.Errorf("%d entries stored from a rejected transaction, want 0", n)
+	}
+
+	if rec := postEndless(t, s, "/txn"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("endless transaction: status %d, want 413", rec.Code)
+	}
+}
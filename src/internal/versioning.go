@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// An entry's version is its ModificationCount, exposed as a strong ETag
+
+func entryETag(e storage.DataEntry) string {
+	return `"` + strconv.Itoa(e.ModificationCount) + `"`
+}
+
+// etagMatches reports whether an If-Match header value (a list of ETags or
+// "*") matches the entry's current version
+func etagMatches(header string, e storage.DataEntry) bool {
+	current := entryETag(e)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
+
+// nextVersion is the ModificationCount an entry at version current gets on its
+// next write. With a version cap set, the write after the cap rolls over to 1;
+// without one the count only rolls over where it would overflow. A corrupt
+// negative count also restarts at 1. After a rollover an old ETag can match
+// again, so clients holding versions across a rollover may see a stale
+// If-Match succeed.
+func (s *Server) nextVersion(current int) int {
+	if current < 0 || current == math.MaxInt || s.maxVersion > 0 && current >= s.maxVersion {
+		return 1
+	}
+	return current + 1
+}
+
+// HTTP dates only carry whole seconds, so LastUpdated is truncated before it is
+// sent or compared. Otherwise an entry written at 12:00:00.5 would look newer
+// than the "12:00:00" Last-Modified the client echoes back, and never 304.
+
+func lastModified(e storage.DataEntry) time.Time {
+	return time.Unix(0, e.LastUpdated).UTC().Truncate(time.Second)
+}
+
+// notModifiedSince reports whether an If-Modified-Since header shows the client
+// already has the current entry. Unparseable dates are ignored, per RFC 9110.
+func notModifiedSince(header string, e storage.DataEntry) bool {
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	return !lastModified(e).After(since)
+}
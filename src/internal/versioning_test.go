@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+func TestLastModified(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+	wantStatus(t, resp, body, http.StatusOK)
+	stamp := resp.Header.Get("Last-Modified")
+	modified, err := http.ParseTime(stamp)
+	if err != nil {
+		t.Fatalf("Last-Modified %q: %v", stamp, err)
+	}
+
+	// The client echoing back a second-granular stamp of a nanosecond write is unmodified
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "", "If-Modified-Since", stamp)
+	wantStatus(t, resp, body, http.StatusNotModified)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "",
+		"If-Modified-Since", modified.Add(-time.Second).Format(http.TimeFormat))
+	wantStatus(t, resp, body, http.StatusOK)
+
+	// If-None-Match wins over If-Modified-Since, and bad dates are ignored
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "", "If-Modified-Since", stamp, "If-None-Match", `"stale"`)
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "", "If-Modified-Since", "yesterday")
+	wantStatus(t, resp, body, http.StatusOK)
+
+	// A write in a later second makes the old stamp stale
+	time.Sleep(time.Until(modified.Add(time.Second)) + 10*time.Millisecond)
+	resp, body = do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+	resp, body = do(t, ts, http.MethodGet, "/EU-A1", "", "If-Modified-Since", stamp)
+	wantStatus(t, resp, body, http.StatusOK)
+	if got := resp.Header.Get("Last-Modified"); got == stamp {
+		t.Errorf("Last-Modified still %q after a later write", got)
+	}
+}
+
+// Writes past the cap roll the version over to 1, and the ETag follows it
+func TestMaxVersionRollsOver(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore(), WithMaxVersion(3))
+	for i, want := range []int{1, 2, 3, 1, 2} {
+		resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+		wantStatus(t, resp, body, http.StatusCreated)
+		resp, body = do(t, ts, http.MethodGet, "/EU-A1", "")
+		wantStatus(t, resp, body, http.StatusOK)
+		var entry struct {
+			ModificationCount int `json:"modification_count"`
+		}
+		decode(t, body, &entry)
+		if entry.ModificationCount != want {
+			t.Errorf("after PUT %d: modification_count = %d, want %d", i, entry.ModificationCount, want)
+		}
+		if etag := resp.Header.Get("ETag"); etag != `"`+strconv.Itoa(want)+`"` {
+			t.Errorf("after PUT %d: ETag %s, want %q", i, etag, want)
+		}
+	}
+}
+
+// Without a cap the count still never overflows or stays negative
+func TestVersionOverflow(t *testing.T) {
+	store := newTestStore()
+	_, ts := newTestServer(t, store)
+	for _, current := range []int{math.MaxInt, -5} {
+		store.Put("EU-A1", storage.DataEntry{LocationId: "EU-A1", ModificationCount: current})
+		resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+		wantStatus(t, resp, body, http.StatusCreated)
+		entry, _ := store.Get("EU-A1")
+		if entry.ModificationCount != 1 {
+			t.Errorf("write after version %d: modification_count = %d, want 1", current, entry.ModificationCount)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Minimal RFC 6455 server support: just enough to push text frames and notice
+// when the client goes away. We don't need to read client messages.
+
+const (
+	wsAcceptGUID   = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsOpText       = 0x1
+	wsOpClose      = 0x8
+	wsOpPing       = 0x9
+	wsOpPong       = 0xA
+	wsWriteTimeout = 5 * time.Second
+)
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, bool) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		http.Error(w, "Expected WebSocket upgrade", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "Unsupported WebSocket handshake", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, false
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, false
+	}
+	return conn, rw, true
+}
+
+func wsWriteFrame(w *bufio.Writer, opcode byte, payload []byte) error {
+	w.WriteByte(0x80 | opcode) // FIN + opcode, server frames are never masked
+	switch n := len(payload); {
+	case n < 126:
+		w.WriteByte(byte(n))
+	case n <= 0xFFFF:
+		w.WriteByte(126)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		w.Write(b[:])
+	default:
+		w.WriteByte(127)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		w.Write(b[:])
+	}
+	w.Write(payload)
+	return w.Flush()
+}
+
+// wsReadLoop drains client frames, answers pings and returns once the client
+// closes or the connection breaks. Control replies go through ctrl so only the
+// writer goroutine touches the connection's write side. When the client sent a
+// close frame its status code is returned, empty if it gave none, so the close
+// can be echoed; a broken connection returns nil.
+func wsReadLoop(r *bufio.Reader, ctrl chan<- []byte) []byte {
+	for {
+		var hdr [2]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil
+		}
+		opcode := hdr[0] & 0x0F
+		masked := hdr[1]&0x80 != 0
+		length := uint64(hdr[1] & 0x7F)
+		switch length {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return nil
+			}
+			length = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return nil
+			}
+			length = binary.BigEndian.Uint64(b[:])
+		}
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(r, mask[:]); err != nil {
+				return nil
+			}
+		}
+		if (opcode == wsOpPing || opcode == wsOpClose) && length <= 125 {
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return nil
+			}
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+			if opcode == wsOpClose {
+				return payload[:min(len(payload), 2)]
+			}
+			select {
+			case ctrl <- payload:
+			default:
+			}
+			continue
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+			return nil
+		}
+	}
+}
+
+// wsHandler streams change events as JSON text frames, optionally restricted to
+// keys starting with ?prefix=. Events are dropped for slow clients by the change
+// feed, so a stalled socket never holds up store writers.
+func (s *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+
+	// Subscribed before the handshake completes, so a client sees every change
+	// made after it has connected
+	events, cancel := s.table().Subscribe()
+	defer cancel()
+
+	conn, rw, ok := wsUpgrade(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	ctrl := make(chan []byte, 1)
+	done := make(chan struct{})
+	var closeCode []byte
+	go func() {
+		closeCode = wsReadLoop(rw.Reader, ctrl)
+		close(done)
+	}()
+
+	stopping := s.servers.stopping()
+	for {
+		select {
+		case <-done:
+			if closeCode != nil {
+				// Echo the client's close to complete the closing handshake
+				conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				wsWriteFrame(rw.Writer, wsOpClose, closeCode)
+			}
+			return
+		case <-stopping:
+			// 1001: the server is going away
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			wsWriteFrame(rw.Writer, wsOpClose, []byte{0x03, 0xE9})
+			return
+		case payload := <-ctrl:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := wsWriteFrame(rw.Writer, wsOpPong, payload); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if prefix != "" && !strings.HasPrefix(ev.Key, prefix) {
+				continue
+			}
+			payload, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := wsWriteFrame(rw.Writer, wsOpText, payload); err != nil {
+				return
+			}
+		}
+	}
+}
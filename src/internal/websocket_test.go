@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// wsClient is the client end of a /ws connection
+type wsClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialWS opens path on the server at addr and completes the WebSocket
+// handshake
+func dialWS(t testing.TB, addr, path string) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake answered %d, want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != wsAcceptKey(key) {
+		t.Fatalf("Sec-WebSocket-Accept = %q, want %q", got, wsAcceptKey(key))
+	}
+	return &wsClient{conn: conn, r: r}
+}
+
+// read returns the next frame from the server, which never masks or fragments
+func (c *wsClient) read(t testing.TB) (opcode byte, payload []byte) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	length := uint64(hdr[1] & 0x7F)
+	switch length {
+	case 126:
+		var b [2]byte
+		io.ReadFull(c.r, b[:])
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		io.ReadFull(c.r, b[:])
+		length = binary.BigEndian.Uint64(b[:])
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatalf("reading frame payload: %v", err)
+	}
+	return hdr[0] & 0x0F, payload
+}
+
+// write sends a masked frame, as clients must
+func (c *wsClient) write(t testing.TB, opcode byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A /ws client receives a change as a JSON text frame, and closing is
+// answered with a close frame carrying the same status
+func TestWebSocketRoundTrip(t *testing.T) {
+	_, ts := newTestServer(t, newTestStore())
+	ws := dialWS(t, ts.Listener.Addr().String(), "/ws?prefix=EU-")
+
+	do(t, ts, http.MethodPut, "/US-A1", testReading)
+	resp, body := do(t, ts, http.MethodPut, "/EU-A1", testReading)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	op, payload := ws.read(t)
+	if op != wsOpText {
+		t.Fatalf("got opcode %x, want a text frame", op)
+	}
+	var ev storage.ChangeEvent
+	decode(t, string(payload), &ev)
+	if ev.Type != storage.ChangePut || ev.Key != "EU-A1" || ev.Entry == nil || ev.Entry.ModificationCount != 1 {
+		t.Errorf("event %s, want the put of EU-A1 (the US key is filtered out)", payload)
+	}
+
+	ws.write(t, wsOpClose, []byte{0x03, 0xE8}) // 1000, normal closure
+	if op, payload := ws.read(t); op != wsOpClose || len(payload) != 2 || binary.BigEndian.Uint16(payload) != 1000 {
+		t.Errorf("close answered with frame %x %v, want a 1000 close", op, payload)
+	}
+	ws.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ws.r.ReadByte(); err != io.EOF {
+		t.Errorf("after the close handshake read %v, want EOF", err)
+	}
+}
@@ -0,0 +1,37 @@
+package internal
+
+import "net/http"
+
+// acquireWrite admits a write if the in-flight write limit allows it, answering
+// 429 straight away otherwise. Unlike scans, writes never queue: a write storm
+// is shed immediately so it can't build up behind the segment and size locks
+// and drag read latency down with it.
+func (s *Server) acquireWrite(w http.ResponseWriter) bool {
+	if !s.tryAcquireWrite() {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many concurrent writes", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// tryAcquireWrite takes a write slot if one is free, for callers that answer
+// the refusal themselves
+func (s *Server) tryAcquireWrite() bool {
+	if s.writeSem != nil {
+		select {
+		case s.writeSem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	s.metrics.inflightWrites.Add(1)
+	return true
+}
+
+func (s *Server) releaseWrite() {
+	s.metrics.inflightWrites.Add(-1)
+	if s.writeSem != nil {
+		<-s.writeSem
+	}
+}
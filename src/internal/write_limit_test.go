@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// With every write slot taken, each write route sheds load with 429 while
+// reads carry on
+func TestWriteLimitCoversEveryWriteRoute(t *testing.T) {
+	raw := storage.NewBlobTable(4, 1<<20, storage.NewPoolManager())
+	s, ts := newTestServer(t, newTestStore(), WithMaxInflightWrites(1), WithRawStore(raw))
+	s.writeSem <- struct{}{} // one write in flight
+
+	writes := []struct{ method, path, body string }{
+		{http.MethodPut, "/EU-A1", testReading},
+		{http.MethodPatch, "/EU-A1", `{}`},
+		{http.MethodDelete, "/EU-A1", ""},
+		{http.MethodPut, "/raw/blob", "bytes"},
+		{http.MethodDelete, "/raw/blob", ""},
+		{http.MethodPost, "/batch", `{"ops":[]}`},
+		{http.MethodPost, "/txn", `{"ops":[]}`},
+		{http.MethodPost, "/import", ""},
+		{http.MethodDelete, "/admin/purge?older_than=1h", ""},
+		{http.MethodDelete, "/admin/clear", ""},
+		{http.MethodPost, "/admin/compact", ""},
+	}
+	for _, wr := range writes {
+		resp, body := do(t, ts, wr.method, wr.path, wr.body)
+		wantStatus(t, resp, body, http.StatusTooManyRequests)
+	}
+	for _, path := range []string{"/EU-A1", "/raw/blob"} {
+		resp, body := do(t, ts, http.MethodGet, path, "")
+		wantStatus(t, resp, body, http.StatusNotFound)
+	}
+
+	<-s.writeSem
+	resp, body := do(t, ts, http.MethodPut, "/raw/blob", "bytes")
+	wantStatus(t, resp, body, http.StatusNoContent)
+	resp, body = do(t, ts, http.MethodDelete, "/raw/blob", "")
+	wantStatus(t, resp, body, http.StatusNoContent)
+	if n := s.metrics.inflightWrites.Load(); n != 0 {
+		t.Errorf("inflight_writes = %d after every write finished", n)
+	}
+}
@@ -1,23 +1,374 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/keshavrathinvael/Big-O-Solution/internal"
 	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
 )
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until shutdown and returns, rather than exiting, on any error so
+// deferred cleanup such as closing the data file always runs
+func run() error {
 	println("Starting Pandora's Data Hub...")
 	port := flag.Int("port", 5555, "Port the application should run on")
-	storeSize := uint64(3 * 1024 * 1024 * 1024)
-	poolManager := storage.NewPoolManager()
-	segHashTable := storage.NewSegmentedHashTable(16, storeSize)
-	server := internal.CreateServer(segHashTable, poolManager)
-	server.SetReady(true)
-	err := server.Start(*port)
+	maxScans := flag.Int("max-scans", 4, "Maximum number of concurrent full-store scans")
+	enableFaults := flag.Bool("enable-faults", false, "Expose /admin/faults for client fault-injection testing (never in production)")
+	logLevel := flag.String("log-level", envOr("LOG_LEVEL", "info"), "Log level: debug, info, warn or error (env LOG_LEVEL)")
+	logSample := flag.Int("log-sample", envIntOr("LOG_SAMPLE", 1), "Log 1 in N successful requests; errors are always logged (env LOG_SAMPLE)")
+	alertThresholds := flag.String("alert-thresholds", "", `JSON thresholds for the derived GET status, e.g. {"radiation_level":{"warning":5,"critical":10}}`)
+	hashSalt := flag.String("hash-salt", "", "Salt mixed into segment selection to spread prefixed keys")
+	hashSuffix := flag.Bool("hash-suffix", false, "Select segments by hashing only the key part after the first '-'")
+	maxServeAge := flag.Duration("max-serve-age", 0, "Answer GET with 410 for entries older than this (0 disables)")
+	capacityHeaders := flag.Bool("capacity-headers", false, "Add X-Store-* capacity headers to GET/PUT responses")
+	historyLen := flag.Int("history", 0, "Keep the last N readings per key, served at /{key}/history (0 disables)")
+	storeSize := flag.Uint64("max-size", 3*1024*1024*1024, "Store capacity in bytes (0 means unlimited)")
+	fairLocks := flag.Bool("fair-locks", false, "Use reader/writer-alternating segment locks to bound read latency under heavy writes")
+	keyCase := flag.String("key-case", "", "Fold keys to one case before storage: lower or upper (default case-sensitive)")
+	encodeBuffer := flag.Int("encode-buffer", 512, "Size of pooled GET response buffers in bytes (0 disables pooling)")
+	exportBuffer := flag.Int("export-buffer", 32*1024, "Size of the pooled buffer /export batches NDJSON lines in, in bytes (0 disables pooling)")
+	streamThreshold := flag.Int("stream-threshold", 64*1024, "Send JSON responses larger than this many bytes with chunked transfer encoding (0 never)")
+	debug := flag.Bool("debug", false, "Expose diagnostic endpoints such as /admin/inspect/{key}")
+	readyThreshold := flag.Float64("ready-capacity", 0, "Report unready once usage stays above this fraction of capacity, e.g. 0.95 (0 disables)")
+	readyGrace := flag.Duration("ready-grace", 30*time.Second, "How long the capacity condition must persist before readiness changes")
+	dataFile := flag.String("data-file", "", "Persist every write to this append-only log and replay it at startup (default in-memory only)")
+	balanced := flag.Bool("balanced-placement", false, "Place new keys in the least-loaded segment and track them in an index")
+	defaultTTL := flag.Duration("ttl", 0, "Expire entries this long after their last write unless PUT sets X-TTL-Seconds (0 disables)")
+	sweepInterval := flag.Duration("sweep-interval", time.Minute, "How often expired entries are reclaimed")
+	segments := flag.Int("segments", 16, "Number of store segments (locks), rounded up to a power of two")
+	tuneKeys := flag.String("tune-segments", "", "Measure key spread and lock contention for candidate -segments values using the keys in this file (one per line), print a report and exit")
+	selftest := flag.Bool("selftest", false, "Run a quick storage self-test, print PASS/FAIL and exit instead of serving")
+	poolClasses := flag.Int("pool-classes", 32, "Maximum number of distinct buffer size classes kept pooled (0 means unbounded)")
+	grpcPort := flag.Int("grpc-port", 0, "Also serve the gRPC API (Get/Put/Delete) on this port, over TLS when -tls-cert is set (0 disables)")
+	evictSamples := flag.Int("evict-samples", 0, "When full, evict the least recently written of this many sampled keys instead of rejecting writes (0 disables)")
+	regionQuotas := flag.String("region-quotas", "", `JSON byte quotas per region (key prefix before '-'), e.g. {"EU":1048576}`)
+	segmentHash := flag.String("segment-hash", "fnv", "Hash used to pick a key's segment: fnv or maphash (better spread for similar keys)")
+	asyncQueue := flag.Int("data-file-async", 0, "Append to -data-file from a background writer with this many queued records; acknowledged writes still queued are lost on a crash (0 appends synchronously)")
+	maxBatch := flag.Int("max-batch", 10000, "Maximum ops in one POST /batch before answering 413 (0 unlimited)")
+	maxResults := flag.Int("max-results", 10000, "Maximum entries returned by one list request (range, prefix, export, regions, history) before truncating with a cursor (0 unlimited)")
+	verifyInterval := flag.Duration("verify-size-interval", 0, "Periodically recompute the store size and warn if accounting has drifted (0 disables)")
+	adminPort := flag.Int("admin-port", 0, "Serve /metrics, /admin/, /debug/ and pprof on this port instead of -port (0 keeps them on -port)")
+	socket := flag.String("socket", "", "Serve HTTP on this Unix domain socket instead of -port")
+	tlsCert := flag.String("tls-cert", "", "Serve HTTPS on -port with this PEM certificate (requires -tls-key)")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "Require client certificates signed by the CAs in this PEM file (mutual TLS, requires -tls-cert)")
+	maxRequestTimeout := flag.Duration("max-request-timeout", 30*time.Second, "Upper bound on the budget clients may ask for with X-Timeout-Ms (0 leaves it unbounded)")
+	slowRequest := flag.Duration("slow-request", 0, "Log requests taking at least this long at warn level regardless of sampling, e.g. 250ms (0 disables)")
+	routeLog := flag.String("route-log", "", `Per-route success logging overrides, e.g. "/=sampled,/range=quiet" (levels: sampled, quiet, verbose)`)
+	lockWatchdog := flag.Duration("lock-watchdog", 0, "Warn when a segment lock is held longer than this, e.g. 5s (0 disables)")
+	rawSize := flag.Uint64("raw-max-size", 0, "Enable /raw/{key} for opaque byte values with this capacity in bytes (0 disables)")
+	touchOnRead := flag.Bool("touch-on-read", false, "Slide an entry's expiry forward by its TTL on every GET (reads take the write lock)")
+	rateLimit := flag.Float64("rate-limit", 0, "Requests per second allowed per client (valid API key, else IP), answering 429 beyond -rate-burst (0 disables)")
+	rateBurst := flag.Int("rate-burst", 20, "Requests a client may make in a burst under -rate-limit")
+	maxWrites := flag.Int("max-inflight-writes", 0, "Answer 429 to writes beyond this many in flight, leaving reads unthrottled (0 unlimited)")
+	compactRatio := flag.Int("data-file-compact", 4, "Rewrite -data-file down to the live entries once it holds this many records per entry (0 never)")
+	strictLayout := flag.Bool("data-file-strict-layout", false, "Refuse to load -data-file if it was written with a different segment count or -segment-hash (default warns)")
+	apiKeys := flag.String("api-keys", envOr("API_KEYS", ""), `Comma-separated API keys required on writes and admin routes, each "key" or "key:read" for a read-only key (env API_KEYS)`)
+	apiKeysFile := flag.String("api-keys-file", "", "File of additional API keys in -api-keys form, one per line")
+	publicReads := flag.Bool("public-reads", true, "Let reads through without an API key when API keys are configured")
+	requireReadings := flag.Bool("require-readings", false, "Answer 422 to PUTs that omit any of the three sensor readings instead of storing 0")
+	auditSize := flag.Int("audit-size", 0, "Keep this many recent writes and deletes for GET /admin/audit (0 disables)")
+	readingPlaces := flag.Int("reading-precision", -1, "Round sensor readings in read responses to this many decimals, 0 to 7 (-1 serves exact values)")
+	rootIndex := flag.Bool("root-index", true, "Serve a JSON list of endpoints on GET /; when false / answers 400 (key required)")
+	maxVersion := flag.Int("max-version", 0, "Roll an entry's modification_count over to 1 after this value (0 only at integer overflow)")
+	omitNilID := flag.Bool("omit-nil-id", false, `Leave "id" out of GET responses when it is the nil UUID`)
+	namespace := flag.String("namespace", "", `Store every key as "namespace:key", stripped again in responses, and scope purge, clear and size checks to it; -region-quotas then name "namespace:REGION"`)
+	defaultOnMiss := flag.Bool("default-on-miss", false, "Answer GET on an unknown key with 200 and a zero-valued entry instead of 404")
+	strictUUIDs := flag.Bool("strict-uuids", false, "Reject writes whose id is the nil UUID (00000000-...) with 400")
+	legacySize := flag.Bool("legacy-size-estimate", false, "Charge entries the old flat 100 bytes plus key and id against -max-size instead of their in-memory size, for capacities sized against it")
+	flag.Parse()
+
+	logger, err := internal.NewLogger(*logLevel)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	slog.SetDefault(logger)
+
+	if *segments < 1 {
+		return fmt.Errorf("invalid -segments %d: want at least 1", *segments)
+	}
+	poolManager := storage.NewBoundedPoolManager(*poolClasses)
+	tableOpts := []storage.TableOption{storage.WithLogger(logger)}
+	if *hashSalt != "" {
+		tableOpts = append(tableOpts, storage.WithHashSalt(*hashSalt))
+	}
+	if *evictSamples > 0 {
+		tableOpts = append(tableOpts, storage.WithEviction(*evictSamples))
+	}
+	if *regionQuotas != "" {
+		var quotas map[string]uint64
+		if err := json.Unmarshal([]byte(*regionQuotas), &quotas); err != nil {
+			return fmt.Errorf("invalid -region-quotas: %w", err)
+		}
+		tableOpts = append(tableOpts, storage.WithRegionQuotas(quotas))
+	}
+	if *lockWatchdog > 0 {
+		tableOpts = append(tableOpts, storage.WithLockWatchdog(*lockWatchdog))
+	}
+	if *touchOnRead {
+		tableOpts = append(tableOpts, storage.WithTouchOnRead())
+	}
+	if *hashSuffix {
+		tableOpts = append(tableOpts, storage.WithHashSuffix())
+	}
+	if *historyLen > 0 {
+		tableOpts = append(tableOpts, storage.WithHistory(*historyLen))
+	}
+	if *fairLocks {
+		tableOpts = append(tableOpts, storage.WithFairLocks())
+	}
+	switch *keyCase {
+	case "":
+	case "lower":
+		tableOpts = append(tableOpts, storage.WithKeyCase(storage.KeyCaseLower))
+	case "upper":
+		tableOpts = append(tableOpts, storage.WithKeyCase(storage.KeyCaseUpper))
+	default:
+		return fmt.Errorf("invalid -key-case %q", *keyCase)
+	}
+	switch *segmentHash {
+	case "fnv":
+	case "maphash":
+		tableOpts = append(tableOpts, storage.WithSegmentHash(storage.SegmentHashMaphash))
+	default:
+		return fmt.Errorf("invalid -segment-hash %q", *segmentHash)
+	}
+	if *balanced {
+		tableOpts = append(tableOpts, storage.WithBalancedPlacement())
+	}
+	if *defaultTTL > 0 {
+		tableOpts = append(tableOpts, storage.WithDefaultTTL(*defaultTTL))
+	}
+	if *legacySize {
+		tableOpts = append(tableOpts, storage.WithSizeEstimator(storage.LegacySizeEstimator))
+	}
+	if *selftest {
+		os.Exit(runSelfTest(tableOpts))
+	}
+	if *tuneKeys != "" {
+		os.Exit(runTuner(*tuneKeys, tableOpts))
+	}
+	segHashTable := storage.NewSegmentedHashTable(*segments, *storeSize, tableOpts...)
+	scope := func(store storage.Store) storage.Store { return store }
+	if *namespace != "" {
+		if err := storage.ValidateNamespace(*namespace); err != nil {
+			return fmt.Errorf("invalid -namespace: %w", err)
+		}
+		scope = func(store storage.Store) storage.Store {
+			ns, _ := storage.NewNamespaced(store, *namespace)
+			return ns
+		}
+	}
+	if *readingPlaces < -1 || *readingPlaces > internal.MaxReadingPrecision {
+		return fmt.Errorf("invalid -reading-precision %d: want 0 to %d, or -1 for exact values", *readingPlaces, internal.MaxReadingPrecision)
+	}
+	opts := []internal.ServerOption{
+		internal.WithMaxConcurrentScans(*maxScans, time.Second),
+		internal.WithLogger(logger, *logSample),
+		internal.WithMaxServeAge(*maxServeAge),
+		internal.WithEncodeBufferSize(*encodeBuffer),
+		internal.WithExportBufferSize(*exportBuffer),
+		internal.WithStreamThreshold(*streamThreshold),
+		internal.WithSlowRequestLog(*slowRequest),
+		internal.WithAuditLog(*auditSize),
+		internal.WithReadingPrecision(*readingPlaces),
+		internal.WithMaxBatchSize(*maxBatch),
+		internal.WithRootIndex(*rootIndex),
+		internal.WithMaxVersion(*maxVersion),
+		internal.WithRateLimit(*rateLimit, *rateBurst),
+		internal.WithMaxResults(*maxResults),
+		internal.WithMaxInflightWrites(*maxWrites),
+		internal.WithMaxRequestTimeout(*maxRequestTimeout),
+	}
+	if *alertThresholds != "" {
+		var thresholds internal.AlertThresholds
+		if err := json.Unmarshal([]byte(*alertThresholds), &thresholds); err != nil {
+			return fmt.Errorf("invalid -alert-thresholds: %w", err)
+		}
+		opts = append(opts, internal.WithAlertThresholds(thresholds))
+	}
+	if *routeLog != "" {
+		levels, err := internal.ParseRouteLogging(*routeLog)
+		if err != nil {
+			return fmt.Errorf("invalid -route-log: %w", err)
+		}
+		opts = append(opts, internal.WithRouteLogging(levels))
+	}
+	if *capacityHeaders {
+		opts = append(opts, internal.WithCapacityHeaders())
+	}
+	if *readyThreshold > 0 {
+		opts = append(opts, internal.WithCapacityReadiness(*readyThreshold, *readyGrace))
+	}
+	if *debug {
+		opts = append(opts, internal.WithDebug())
+	}
+	if *rawSize > 0 {
+		opts = append(opts, internal.WithRawStore(storage.NewBlobTable(16, *rawSize, poolManager)))
+	}
+	var keys []internal.APIKey
+	for _, spec := range strings.Split(*apiKeys, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		key, err := internal.ParseAPIKey(spec)
+		if err != nil {
+			return fmt.Errorf("invalid -api-keys: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if *apiKeysFile != "" {
+		fromFile, err := internal.LoadAPIKeys(*apiKeysFile)
+		if err != nil {
+			return fmt.Errorf("invalid -api-keys-file: %w", err)
+		}
+		keys = append(keys, fromFile...)
+	}
+	if len(keys) > 0 {
+		opts = append(opts, internal.WithAPIKeys(keys, *publicReads))
+	}
+	if *requireReadings {
+		opts = append(opts, internal.WithRequiredReadings())
+	}
+	if *adminPort > 0 {
+		opts = append(opts, internal.WithSeparateAdmin())
+	}
+	if *omitNilID {
+		opts = append(opts, internal.WithOmitNilID())
+	}
+	if *strictUUIDs {
+		opts = append(opts, internal.WithStrictUUIDs())
+	}
+	if *defaultOnMiss {
+		opts = append(opts, internal.WithDefaultOnMiss())
+	}
+	if *enableFaults {
+		opts = append(opts, internal.WithFaultInjection())
+	}
+	stopSweeper := segHashTable.StartSweeper(*sweepInterval)
+	defer stopSweeper()
+	stopWatchdog := segHashTable.StartLockWatchdog()
+	defer stopWatchdog()
+	if *verifyInterval > 0 {
+		stopVerifier := segHashTable.StartSizeVerifier(*verifyInterval)
+		defer stopVerifier()
+	}
+
+	server := internal.CreateServer(scope(segHashTable), poolManager, opts...)
+	listen := func() error { return server.Start(*port) }
+	if (*tlsCert == "") != (*tlsKey == "") || *tlsClientCA != "" && *tlsCert == "" {
+		return errors.New("-tls-cert and -tls-key go together, and -tls-client-ca needs both")
+	}
+	var tlsOpts []internal.TLSOption
+	if *tlsClientCA != "" {
+		pool, err := internal.LoadCertPool(*tlsClientCA)
+		if err != nil {
+			return fmt.Errorf("invalid -tls-client-ca: %w", err)
+		}
+		tlsOpts = append(tlsOpts, internal.WithClientCAs(pool))
+	}
+	if *tlsCert != "" {
+		listen = func() error { return server.StartTLS(*port, *tlsCert, *tlsKey, tlsOpts...) }
+	}
+	if *socket != "" {
+		listen = func() error { return server.StartUnix(*socket) }
+	}
+	// Stop gracefully on SIGINT/SIGTERM, or when any listener fails. Signals are
+	// caught from here on, so one arriving while the data file replays still
+	// gets a clean close once the replay is done.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	served := make(chan error, 3)
+	listeners := 0
+	start := func(serve func() error) {
+		listeners++
+		go func() { served <- serve() }()
+	}
+	if *grpcPort > 0 && *tlsCert != "" {
+		// The same certificates, and client CAs, as HTTPS
+		start(func() error { return server.StartGRPCTLS(*grpcPort, *tlsCert, *tlsKey, tlsOpts...) })
+	} else if *grpcPort > 0 {
+		start(func() error { return server.StartGRPC(*grpcPort) })
+	}
+	if *adminPort > 0 {
+		start(func() error { return server.StartAdmin(*adminPort) })
+	}
+	if *dataFile == "" {
+		start(listen)
+	} else {
+		// Listen straight away so orchestrators can poll /health/ready while the
+		// log replays; data endpoints answer 503 until the swap below
+		server.SetLoading(true)
+		start(listen)
+		logOpts := []storage.LogStoreOption{storage.WithAsyncAppends(*asyncQueue), storage.WithCompaction(*compactRatio)}
+		if *strictLayout {
+			logOpts = append(logOpts, storage.WithStrictLayout())
+		}
+		logStore, err := storage.OpenLogStore(*dataFile, segHashTable, logOpts...)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", *dataFile, err)
+		}
+		defer logStore.Close()
+		// Sweep through the log store from now on so expiries are logged as
+		// they happen
+		stopSweeper()
+		defer logStore.StartSweeper(*sweepInterval)()
+		server.SwapStore(scope(logStore))
+		server.SetLoading(false)
+		logger.Info("data file loaded", "path", *dataFile, "entries", logStore.Count())
+	}
+
+	var failed error
+	select {
+	case <-sigs:
+	case failed = <-served:
+		listeners--
+	}
+
+	// Every listener, gRPC and admin included, must have returned and every
+	// in-flight request finished before the deferred cleanup (log fsync and
+	// close, socket removal) runs
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stopped := server.Shutdown(ctx)
+	for ; listeners > 0; listeners-- {
+		if err := <-served; err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return errors.Join(failed, stopped)
+}
+
+func envOr(name, fallback string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return fallback
+}
+
+func envIntOr(name string, fallback int) int {
+	if v, ok := os.LookupEnv(name); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
 	}
+	return fallback
 }
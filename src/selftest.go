@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// runSelfTest exercises a fresh store end to end without starting the HTTP
+// server, prints PASS or FAIL, and returns the process exit code
+func runSelfTest(tableOpts []storage.TableOption) int {
+	if err := selfTest(tableOpts); err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return 1
+	}
+	fmt.Println("PASS")
+	return 0
+}
+
+func selfTest(tableOpts []storage.TableOption) error {
+	store := storage.NewSegmentedHashTable(16, 1024*1024, tableOpts...)
+	const key = "SELFTEST-1"
+	entry := storage.DataEntry{
+		Id:                uuid.New(),
+		LocationId:        key,
+		TemperatureC:      21.5,
+		ModificationCount: 1,
+	}
+
+	if err := store.Put(key, entry); err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+	got, err := store.Get(key)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if got.Id != entry.Id || got.TemperatureC != entry.TemperatureC {
+		return fmt.Errorf("get returned %+v, want %+v", got, entry)
+	}
+	if store.Count() != 1 || store.Size() == 0 {
+		return fmt.Errorf("after put: count=%d size=%d", store.Count(), store.Size())
+	}
+
+	if err := store.Delete(key); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if _, err := store.Get(key); err != storage.ErrKeyNotFound {
+		return fmt.Errorf("get after delete: got %v, want %v", err, storage.ErrKeyNotFound)
+	}
+	if store.Count() != 0 || store.Size() != 0 {
+		return fmt.Errorf("size accounting drifted: count=%d size=%d after deleting everything", store.Count(), store.Size())
+	}
+	return selfTestNamespaces(store, entry)
+}
+
+// selfTestNamespaces checks that the same key in two namespaces of one table
+// addresses two entries, each listed only in its own namespace
+func selfTestNamespaces(store storage.Store, entry storage.DataEntry) error {
+	a, err := storage.NewNamespaced(store, "SELFTEST_A")
+	if err != nil {
+		return err
+	}
+	b, err := storage.NewNamespaced(store, "SELFTEST_B")
+	if err != nil {
+		return err
+	}
+	key := entry.LocationId
+	other := entry
+	other.TemperatureC++
+	if err := a.Put(key, entry); err != nil {
+		return fmt.Errorf("namespaced put: %w", err)
+	}
+	if err := b.Put(key, other); err != nil {
+		return fmt.Errorf("namespaced put: %w", err)
+	}
+	gotA, errA := a.Get(key)
+	gotB, errB := b.Get(key)
+	if errA != nil || errB != nil || gotA.TemperatureC == gotB.TemperatureC {
+		return fmt.Errorf("namespaces collide: got %+v (%v) and %+v (%v)", gotA, errA, gotB, errB)
+	}
+	if keys := a.GetKeys(); len(keys) != 1 || keys[0] != a.NormalizeKey(key) || store.Count() != 2 {
+		return fmt.Errorf("namespaced keys %v, want [%s] of %d stored", keys, a.NormalizeKey(key), store.Count())
+	}
+	if err := a.Delete(key); err != nil {
+		return fmt.Errorf("namespaced delete: %w", err)
+	}
+	if _, err := b.Get(key); err != nil {
+		return fmt.Errorf("delete in one namespace reached another: %w", err)
+	}
+	return b.Delete(key)
+}
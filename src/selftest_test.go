@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// The self-test passes on a fresh store under the table options main can pass it
+func TestSelfTest(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []storage.TableOption
+	}{
+		{"defaults", nil},
+		{"history", []storage.TableOption{storage.WithHistory(3)}},
+		{"lower-case keys", []storage.TableOption{storage.WithKeyCase(storage.KeyCaseLower)}},
+		{"balanced placement", []storage.TableOption{storage.WithBalancedPlacement()}},
+		{"ttl", []storage.TableOption{storage.WithDefaultTTL(time.Hour)}},
+		{"legacy size estimate", []storage.TableOption{storage.WithSizeEstimator(storage.LegacySizeEstimator)}},
+	}
+	for _, tc := range cases {
+		if err := selfTest(tc.opts); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+	if code := runSelfTest(nil); code != 0 {
+		t.Errorf("runSelfTest exit code %d, want 0", code)
+	}
+}
+
+// A store whose accounting is broken fails the self-test with a reason, and a
+// nonzero exit code
+func TestSelfTestFails(t *testing.T) {
+	free := []storage.TableOption{storage.WithSizeEstimator(func(string, storage.DataEntry) uint64 { return 0 })}
+	err := selfTest(free)
+	if err == nil || !strings.Contains(err.Error(), "size=0") {
+		t.Errorf("selfTest with entries charged nothing: %v, want a size failure", err)
+	}
+	if code := runSelfTest(free); code != 1 {
+		t.Errorf("runSelfTest exit code %d on failure, want 1", code)
+	}
+}
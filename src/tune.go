@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/keshavrathinvael/Big-O-Solution/internal/storage"
+)
+
+// Segment counts tried by -tune-segments
+var tuneCandidates = []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+
+// Operations timed per candidate, split across GOMAXPROCS workers; one in
+// four is a Put, the rest Gets
+const tuneOps = 400000
+
+// A candidate is only recommended if it spreads keys at least this evenly and
+// is within tuneSlack of the best throughput; the smallest such count wins
+// since every segment costs a lock and a map.
+const (
+	tuneMinScore = 0.9
+	tuneSlack    = 0.10
+)
+
+type tuneResult struct {
+	segments  int
+	score     float64 // spreadScore of the keys over the segments
+	imbalance float64 // fullest segment relative to the mean of those the keys could fill
+	opsPerSec float64
+}
+
+// runTuner reads a sample of keys, one per line, from path, measures every
+// candidate segment count against them, prints a report and a recommended
+// -segments value, and returns the process exit code
+func runTuner(path string, tableOpts []storage.TableOption) int {
+	keys, err := readKeySample(path)
+	if err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return 1
+	}
+	if len(keys) == 0 {
+		fmt.Printf("FAIL: no keys in %s\n", path)
+		return 1
+	}
+
+	results := make([]tuneResult, len(tuneCandidates))
+	for i, n := range tuneCandidates {
+		results[i] = tuneCandidate(n, keys, tableOpts)
+	}
+	best := recommendSegments(results)
+	printTuneReport(os.Stdout, len(keys), results, best)
+	return 0
+}
+
+func readKeySample(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// tuneCandidate loads keys into an unlimited table with n segments, scores the
+// spread, then times a concurrent Get/Put mix over the same keys so lock
+// contention shows up as lost throughput
+func tuneCandidate(n int, keys []string, tableOpts []storage.TableOption) tuneResult {
+	table := storage.NewSegmentedHashTable(n, 0, tableOpts...)
+	entry := func(key string) storage.DataEntry {
+		return storage.DataEntry{LocationId: key, ModificationCount: 1}
+	}
+	for _, key := range keys {
+		table.Put(key, entry(key))
+	}
+
+	counts := make([]int, n)
+	for _, key := range keys {
+		counts[table.SegmentIndex(key)]++
+	}
+	fullest := 0
+	for _, c := range counts {
+		fullest = max(fullest, c)
+	}
+	usable := min(n, len(keys))
+
+	workers := runtime.GOMAXPROCS(0)
+	perWorker := tuneOps / workers
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				key := keys[(w*perWorker+i*7919)%len(keys)]
+				if i%4 == 0 {
+					table.Put(key, entry(key))
+				} else {
+					table.Get(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	return tuneResult{
+		segments:  n,
+		score:     spreadScore(counts),
+		imbalance: float64(fullest) * float64(usable) / float64(len(keys)),
+		opsPerSec: float64(perWorker*workers) / elapsed.Seconds(),
+	}
+}
+
+// spreadScore is the normalized Shannon entropy of the per-segment key counts,
+// like DistributionScore, but measured against the most segments the keys can
+// fill: with fewer keys than segments, one key per segment scores 1.0 rather
+// than being marked down for the segments left empty.
+func spreadScore(counts []int) float64 {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	usable := min(len(counts), total)
+	if usable < 2 {
+		return 1
+	}
+	var entropy float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(total)
+			entropy -= p * math.Log(p)
+		}
+	}
+	return entropy / math.Log(float64(usable))
+}
+
+// recommendSegments returns the index of the smallest candidate that spreads
+// keys evenly enough and comes within tuneSlack of the best throughput, falling
+// back to the fastest candidate if none qualifies
+func recommendSegments(results []tuneResult) int {
+	fastest := 0
+	for i, r := range results {
+		if r.opsPerSec > results[fastest].opsPerSec {
+			fastest = i
+		}
+	}
+	for i, r := range results {
+		if r.score >= tuneMinScore && r.opsPerSec >= results[fastest].opsPerSec*(1-tuneSlack) {
+			return i
+		}
+	}
+	return fastest
+}
+
+func printTuneReport(out io.Writer, keys int, results []tuneResult, best int) {
+	fmt.Fprintf(out, "%d distinct keys, %d ops per candidate on %d workers\n\n", keys, tuneOps, runtime.GOMAXPROCS(0))
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "segments\tdistribution\tmax/mean\tops/sec\t")
+	for i, r := range results {
+		mark := ""
+		if i == best {
+			mark = " <"
+		}
+		fmt.Fprintf(tw, "%d\t%.3f\t%.2f\t%.0f\t%s\n", r.segments, r.score, r.imbalance, r.opsPerSec, mark)
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "\nrecommended: -segments %d\n", results[best].segments)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSpreadScore(t *testing.T) {
+	cases := []struct {
+		name   string
+		counts []int
+		want   float64
+	}{
+		{"even", []int{5, 5, 5, 5}, 1},
+		{"all in one segment", []int{8, 0, 0, 0}, 0},
+		// Three keys can fill at most three of the eight segments
+		{"one key per segment", []int{1, 0, 1, 0, 0, 1, 0, 0}, 1},
+		{"two keys sharing", []int{2, 0, 1, 0, 0, 0, 0, 0}, (math.Log(3) - 2.0/3*math.Log(2)) / math.Log(3)},
+		{"single key", []int{0, 1, 0, 0}, 1},
+		{"no keys", []int{0, 0}, 1},
+	}
+	for _, tc := range cases {
+		if got := spreadScore(tc.counts); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: spreadScore(%v) = %.4f, want %.4f", tc.name, tc.counts, got, tc.want)
+		}
+	}
+}
+
+func TestRecommendSegments(t *testing.T) {
+	cases := []struct {
+		name    string
+		results []tuneResult
+		want    int
+	}{
+		{"smallest even candidate near the best throughput", []tuneResult{
+			{segments: 1, score: 1, opsPerSec: 100},
+			{segments: 4, score: 0.95, opsPerSec: 950},
+			{segments: 16, score: 0.97, opsPerSec: 1000},
+		}, 4},
+		{"even but too slow", []tuneResult{
+			{segments: 1, score: 1, opsPerSec: 100},
+			{segments: 4, score: 0.8, opsPerSec: 1000},
+			{segments: 16, score: 0.95, opsPerSec: 500},
+		}, 4},
+		// Nothing qualifies: contention decides, not the single segment's
+		// trivially perfect spread
+		{"fallback is the fastest", []tuneResult{
+			{segments: 1, score: 1, opsPerSec: 100},
+			{segments: 4, score: 0.5, opsPerSec: 1000},
+			{segments: 16, score: 0.6, opsPerSec: 800},
+		}, 4},
+	}
+	for _, tc := range cases {
+		if got := tc.results[recommendSegments(tc.results)].segments; got != tc.want {
+			t.Errorf("%s: recommended %d segments, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// With fewer sample keys than segments, a candidate that gives every key its
+// own lock isn't marked down for the segments left empty
+func TestTuneCandidateFewKeys(t *testing.T) {
+	keys := []string{"EU-A1", "US-B2", "AP-C3"}
+	var spread *tuneResult
+	for _, n := range []int{64, 128, 256, 512, 1024} {
+		r := tuneCandidate(n, keys, nil)
+		if r.score == 1 {
+			spread = &r
+			break
+		}
+	}
+	if spread == nil {
+		t.Fatal("no candidate up to 1024 segments gave the three keys a segment each")
+	}
+	if spread.imbalance != 1 {
+		t.Errorf("%d segments: max/mean = %.2f with a key per segment, want 1", spread.segments, spread.imbalance)
+	}
+}
+
+func TestReadKeySample(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	os.WriteFile(path, []byte("EU-A1\n\n  US-B2  \nEU-A1\nAP-C3\n"), 0o600)
+	keys, err := readKeySample(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"EU-A1", "US-B2", "AP-C3"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %q, want %q: trimmed, deduplicated, blanks skipped", keys, want)
+	}
+}